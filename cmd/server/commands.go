@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/signing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func runCommand(name string, args []string) error {
+	switch name {
+	case "keygen":
+		return runKeygen(args)
+	case "migrate":
+		return runMigrate(args)
+	case "config":
+		return runConfig(args)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+const configUsage = `usage: server [--config-dir DIR] config <command>
+
+commands:
+  print [-env]    print the effective config with secrets redacted, or with
+                  -env the environment variables that override it
+  validate        check the effective config and list every problem found`
+
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		return errors.New(configUsage)
+	}
+
+	switch args[0] {
+	case "print":
+		fs := flag.NewFlagSet("config print", flag.ExitOnError)
+		env := fs.Bool("env", false, "list the override environment variables instead")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *env {
+			for _, name := range config.EnvNames() {
+				fmt.Println(name)
+			}
+			return nil
+		}
+
+		cfg, err := config.Load(*configDir)
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(cfg.Redacted()); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case "validate":
+		cfg, err := config.Load(*configDir)
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		fmt.Println("Configuration is valid")
+		return nil
+	default:
+		return errors.New(configUsage)
+	}
+}
+
+// runKeygen writes a new private signing key that can be added to
+// auth.signing.keys in constants.yaml.
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	alg := fs.String("alg", "RS256", "signing algorithm: RS256 or EdDSA")
+	kid := fs.String("kid", time.Now().UTC().Format("20060102150405"), "key ID")
+	out := fs.String("out", "configs/keys", "directory to write the PEM file to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	pemBytes, err := signing.GenerateKey(*alg)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*out, 0o700); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
+	}
+	path := filepath.Join(*out, *kid+".pem")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create key file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(pemBytes); err != nil {
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+
+	fmt.Printf("Wrote %s key to %s\n\n", *alg, path)
+	fmt.Printf("Add it to auth.signing in configs/constants.yaml:\n\n")
+	fmt.Printf("  signing:\n    active_key: %q\n    keys:\n      - kid: %q\n        path: %q\n", *kid, *kid, path)
+	return nil
+}
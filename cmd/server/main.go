@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,21 +14,56 @@ import (
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/database"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/handlers"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/health"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/logging"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/metrics"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/middleware"
-	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/notify"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/problem"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/repository/implementation"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/services"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/signing"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/tracing"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/validation"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
+var configDir = flag.String("config-dir", config.Dir(), "directory containing app.yaml, database.yaml and constants.yaml")
+
 func main() {
+	flag.Parse()
+
+	// Subcommands, e.g. "server keygen"
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Arg(0), flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := config.Load(*configDir)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Initialize logging, also used by the standard library's log package
+	logger, logCloser, err := logging.New(&cfg.App.Logging)
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	defer logCloser.Close()
+	slog.SetDefault(logger)
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), &cfg.App.Tracing)
+	if err != nil {
+		fatal("Failed to set up tracing", "error", err)
+	}
 
 	// Set Gin mode
 	gin.SetMode(cfg.App.Server.Mode)
@@ -34,64 +71,148 @@ func main() {
 	// Initialize database
 	dbManager, err := database.NewManager(&cfg.Database)
 	if err != nil {
-		log.Fatalf("Failed to create database manager: %v", err)
+		fatal("Failed to create database manager", "error", err)
 	}
 
 	db, err := dbManager.Connect()
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to connect to database", "error", err)
 	}
 
-	// Auto-migrate database schema
-	if err := db.AutoMigrate(&models.User{}, &models.Product{}); err != nil {
-		log.Fatalf("Failed to migrate database: %v", err)
+	// Apply or check schema migrations
+	if err := prepareSchema(context.Background(), db, &cfg.Database); err != nil {
+		fatal("Failed to migrate database, one created before versioned migrations can be adopted with \"server migrate force <version>\"", "error", err)
 	}
 
 	// Initialize repositories
 	userRepo := implementation.NewUserRepository(db)
 	productRepo := implementation.NewProductRepository(db)
+	tokenRepo := implementation.NewTokenRepository(db)
+	userTokenRepo := implementation.NewUserTokenRepository(db)
+	recoveryCodeRepo := implementation.NewRecoveryCodeRepository(db)
+	apiKeyRepo := implementation.NewAPIKeyRepository(db)
+	loginThrottleRepo := implementation.NewLoginThrottleRepository(db)
+	auditLogRepo := implementation.NewAuditLogRepository(db)
+	roleRepo := implementation.NewRoleRepository(db)
+	idempotencyKeyRepo := implementation.NewIdempotencyKeyRepository(db)
+
+	// Load JWT signing keys
+	signingKeys, err := signing.LoadKeySet(&cfg.Constants.Auth)
+	if err != nil {
+		fatal("Failed to load signing keys", "error", err)
+	}
+
+	// Initialize notifier used for password reset and verification messages
+	notifier, err := notify.New(&cfg.App.Notifications)
+	if err != nil {
+		fatal("Failed to create notifier", "error", err)
+	}
 
 	// Initialize services
-	authService := services.NewAuthService(&cfg.Constants)
-	userService := services.NewUserService(userRepo, authService, &cfg.Constants)
-	productService := services.NewProductService(productRepo, userRepo, &cfg.Constants)
+	authService := services.NewAuthService(userRepo, tokenRepo, signingKeys, &cfg.Constants)
+	auditService := services.NewAuditService(auditLogRepo)
+	userService := services.NewUserService(userRepo, authService, auditService, &cfg.Constants)
+	productService := services.NewProductService(productRepo, userRepo, auditService, &cfg.Constants)
+	verificationService := services.NewEmailVerificationService(userRepo, userTokenRepo, notifier, &cfg.Constants)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, userRepo)
+	mfaService := services.NewMFAService(userRepo, recoveryCodeRepo, &cfg.Constants)
+	passwordResetService := services.NewPasswordResetService(userRepo, userTokenRepo, authService, notifier, &cfg.Constants)
+	loginGuard := services.NewLoginGuard(loginThrottleRepo, &cfg.Constants)
+	rbacService := services.NewRBACService(roleRepo, userRepo, &cfg.Constants)
+	idempotencyService := services.NewIdempotencyService(idempotencyKeyRepo, &cfg.App.Idempotency)
 
-	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(userService, authService)
-	userHandler := handlers.NewUserHandler(userService)
+	// Initialize handlers, whose request validation rules read their limits
+	// from the validation config
+	validation.SetLimits(&cfg.Constants.Validation)
+	authHandler := handlers.NewAuthHandler(userService, authService, verificationService, loginGuard, &cfg.Constants)
+	userHandler := handlers.NewUserHandler(userService, verificationService, loginGuard)
 	productHandler := handlers.NewProductHandler(productService)
+	passwordHandler := handlers.NewPasswordHandler(passwordResetService)
+	verificationHandler := handlers.NewVerificationHandler(verificationService)
+	mfaHandler := handlers.NewMFAHandler(mfaService, authService, loginGuard)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	roleHandler := handlers.NewRoleHandler(rbacService)
 
 	// Setup router
 	router := gin.New()
 
 	// Middleware
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
+	router.Use(middleware.RequestID())
+	router.Use(middleware.Tracing(cfg.App.Tracing.ServiceName, cfg.App.Metrics.Path, "/livez", "/readyz", "/health")...)
+	router.Use(middleware.RequestLogger(logger))
+	router.Use(middleware.Recovery())
+
+	// Prometheus metrics, on the API port or a separate admin port
+	var metricsServer *http.Server
+	if cfg.App.Metrics.Enabled {
+		sqlDB, err := db.DB()
+		if err != nil {
+			fatal("Failed to get database connection pool", "error", err)
+		}
+		if err := metrics.RegisterDB(sqlDB, cfg.Database.Driver); err != nil {
+			fatal("Failed to register database metrics", "error", err)
+		}
+		router.Use(middleware.Metrics())
+
+		if address := cfg.GetMetricsAddress(); address != "" {
+			mux := http.NewServeMux()
+			mux.Handle(cfg.App.Metrics.Path, metrics.Handler())
+			metricsServer = &http.Server{Addr: address, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		} else {
+			router.GET(cfg.App.Metrics.Path, gin.WrapH(metrics.Handler()))
+		}
+	}
 
 	// CORS middleware
-	corsConfig := cors.DefaultConfig()
-	corsConfig.AllowOrigins = cfg.App.CORS.AllowedOrigins
-	corsConfig.AllowMethods = cfg.App.CORS.AllowedMethods
-	corsConfig.AllowHeaders = cfg.App.CORS.AllowedHeaders
-	router.Use(cors.New(corsConfig))
-
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":    "ok",
-			"timestamp": time.Now().Format(time.RFC3339),
-			"database":  "connected",
-		})
-	})
+	corsMiddleware, err := middleware.NewCORS(cfg.App.CORS)
+	if err != nil {
+		fatal("Invalid CORS configuration", "error", err)
+	}
+	router.Use(corsMiddleware.Handler())
+
+	// Liveness and readiness probes
+	checker := health.NewChecker(time.Duration(cfg.App.Health.CheckTimeout) * time.Second)
+	checker.Register("database", dbManager.Ping)
+	schemaCheck, err := migrationsCheck(db, cfg.Database.Driver)
+	if err != nil {
+		fatal("Failed to load migrations", "error", err)
+	}
+	checker.Register("migrations", schemaCheck)
+	healthHandler := handlers.NewHealthHandler(checker)
+	healthHandler.RegisterRoutes(router)
+
+	// Errors for unknown routes use the same problem details body
+	router.NoRoute(problem.NoRoute)
+
+	// Public signing keys for token verification
+	authHandler.RegisterWellKnownRoutes(router)
 
 	// API routes
 	api := router.Group("/api/v1")
-	authHandler.RegisterRoutes(api) // /register and /login
+	authMiddleware := middleware.AuthMiddleware(authService, apiKeyService)
+	authHandler.RegisterRoutes(api, authMiddleware)         // /register, /login, /token/refresh and /logout
+	passwordHandler.RegisterRoutes(api)                     // /password/forgot and /password/reset
+	verificationHandler.RegisterRoutes(api, authMiddleware) // /verify-email and /verify-email/resend
+	mfaHandler.RegisterRoutes(api, authMiddleware)          // /login/mfa and /mfa/totp/*
+
+	requirePermission := func(permission string) gin.HandlerFunc {
+		return middleware.RequirePermission(rbacService, permission)
+	}
+	// Administrative routes can be restricted to MFA-authenticated tokens
+	requireAdminPermission := requirePermission
+	if cfg.Constants.Auth.MFA.RequiredForAdmin {
+		requireAdminPermission = func(permission string) gin.HandlerFunc {
+			return middleware.RequireMFAPermission(rbacService, permission)
+		}
+	}
 
 	protected := api.Group("")
-	protected.Use(middleware.AuthMiddleware(authService))
-	userHandler.RegisterRoutes(protected, middleware.AuthMiddleware(authService), middleware.RoleMiddleware(models.RoleAdmin))
-	productHandler.RegisterRoutes(protected)
+	protected.Use(authMiddleware, middleware.LoadPermissions(rbacService), middleware.Idempotency(idempotencyService))
+	userHandler.RegisterRoutes(protected, requireAdminPermission)
+	userHandler.RegisterMeRoutes(protected)
+	roleHandler.RegisterRoutes(protected, requireAdminPermission)
+	productHandler.RegisterRoutes(protected, requirePermission)
+	apiKeyHandler.RegisterRoutes(protected)
 
 	// Start server
 	srv := &http.Server{
@@ -104,31 +225,103 @@ func main() {
 	// Graceful shutdown
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server error: %v", err)
+			fatal("Server error", "error", err)
 		}
 	}()
 
-	log.Printf("Server starting on %s", cfg.GetAddress())
+	slog.Info("Server starting", "address", cfg.GetAddress())
+
+	if metricsServer != nil {
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("Metrics server error", "error", err)
+			}
+		}()
+		slog.Info("Metrics server starting", "address", metricsServer.Addr)
+	}
+
+	// Reload pagination, validation, business rules and CORS on SIGHUP, and
+	// on file changes when watching is enabled
+	reloader := config.NewReloader(*configDir, cfg)
+	reloader.OnReload(func(cfg *config.Config) {
+		productService.SetConstants(&cfg.Constants)
+		userService.SetConstants(&cfg.Constants)
+		passwordResetService.SetConstants(&cfg.Constants)
+		validation.SetLimits(&cfg.Constants.Validation)
+		if err := corsMiddleware.Update(cfg.App.CORS); err != nil {
+			slog.Error("Failed to apply reloaded CORS settings", "error", err)
+		}
+	})
+	var watchInterval time.Duration
+	if cfg.App.ConfigReload.Watch {
+		watchInterval = time.Duration(cfg.App.ConfigReload.Interval) * time.Second
+	}
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	go reloader.Watch(reloadCtx, watchInterval, syscall.SIGHUP)
+
+	// Periodically drop expired refresh tokens, denylist entries and
+	// idempotency keys
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-purgeCtx.Done():
+				return
+			case <-ticker.C:
+				if err := authService.PurgeExpiredTokens(purgeCtx); err != nil {
+					slog.Error("Failed to purge expired tokens", "error", err)
+				}
+				if err := idempotencyService.PurgeExpired(purgeCtx); err != nil {
+					slog.Error("Failed to purge expired idempotency keys", "error", err)
+				}
+			}
+		}
+	}()
 
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server...")
+	// Fail readiness first so load balancers stop routing here while
+	// requests are still being served
+	checker.Drain()
+	drainDelay := time.Duration(cfg.App.Health.DrainDelay) * time.Second
+	slog.Info("Draining before shutdown", "delay", drainDelay)
+	time.Sleep(drainDelay)
+
+	slog.Info("Shutting down server")
 
 	// Graceful shutdown with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+		fatal("Server forced to shutdown", "error", err)
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			slog.Error("Metrics server forced to shutdown", "error", err)
+		}
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
 	}
 
 	// Close database connection
 	if err := dbManager.Close(); err != nil {
-		log.Printf("Error closing database: %v", err)
+		slog.Error("Error closing database", "error", err)
 	}
 
-	log.Println("Server exited")
+	slog.Info("Server exited")
+}
+
+// fatal logs msg with args at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
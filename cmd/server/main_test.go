@@ -2,21 +2,37 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/database"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/handlers"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/health"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/metrics"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/middleware"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/notify"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/problem"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/repository/implementation"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/services"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/signing"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/totp"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func setupTestRouter() *gin.Engine {
@@ -27,11 +43,14 @@ func setupTestRouter() *gin.Engine {
 		SQLite: config.SQLiteConfig{
 			Path: ":memory:",
 		},
+		Migrations: config.MigrationsConfig{AutoApply: true},
 	}
 
 	dbManager, _ := database.NewManager(cfg)
 	db, _ := dbManager.Connect()
-	db.AutoMigrate(&models.User{}, &models.Product{})
+	if err := prepareSchema(context.Background(), db, cfg); err != nil {
+		panic(err)
+	}
 
 	constants := &config.Constants{
 		Pagination: config.PaginationConfig{
@@ -43,30 +62,85 @@ func setupTestRouter() *gin.Engine {
 			DefaultProductStatus: "active",
 		},
 		Auth: config.AuthConfig{
-			JWTSecret:       "test-secret-key-12345678901234567890123456789012",
-			TokenExpiration: 72,
-			PasswordCost:    4,
+			JWTSecret:              "test-secret-key-12345678901234567890123456789012",
+			AccessTokenExpiration:  15,
+			RefreshTokenExpiration: 168,
+			PasswordCost:           4,
+			MFA:                    config.MFAConfig{ChallengeExpiration: 5, RecoveryCodes: 10},
+			Lockout:                config.LockoutConfig{MaxFailures: 5, Duration: 15},
+		},
+		RBAC: config.RBACConfig{
+			Roles: map[string][]string{
+				"admin": {models.PermissionAll},
+				"user":  {models.PermissionProductsRead, models.PermissionProductsWrite},
+			},
 		},
 	}
 
-	authService := services.NewAuthService(constants)
 	userRepo := implementation.NewUserRepository(db)
 	productRepo := implementation.NewProductRepository(db)
-	userService := services.NewUserService(userRepo, authService, constants)
-	productService := services.NewProductService(productRepo, userRepo, constants)
+	tokenRepo := implementation.NewTokenRepository(db)
+	userTokenRepo := implementation.NewUserTokenRepository(db)
+	recoveryCodeRepo := implementation.NewRecoveryCodeRepository(db)
+	apiKeyRepo := implementation.NewAPIKeyRepository(db)
+	loginThrottleRepo := implementation.NewLoginThrottleRepository(db)
+	auditLogRepo := implementation.NewAuditLogRepository(db)
+	roleRepo := implementation.NewRoleRepository(db)
+	idempotencyKeyRepo := implementation.NewIdempotencyKeyRepository(db)
+	signingKeys, _ := signing.LoadKeySet(&constants.Auth)
+	notifier := &notify.LogNotifier{}
+	authService := services.NewAuthService(userRepo, tokenRepo, signingKeys, constants)
+	auditService := services.NewAuditService(auditLogRepo)
+	userService := services.NewUserService(userRepo, authService, auditService, constants)
+	productService := services.NewProductService(productRepo, userRepo, auditService, constants)
+	verificationService := services.NewEmailVerificationService(userRepo, userTokenRepo, notifier, constants)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, userRepo)
+	mfaService := services.NewMFAService(userRepo, recoveryCodeRepo, constants)
+	passwordResetService := services.NewPasswordResetService(userRepo, userTokenRepo, authService, notifier, constants)
+	loginGuard := services.NewLoginGuard(loginThrottleRepo, constants)
+	rbacService := services.NewRBACService(roleRepo, userRepo, constants)
+	idempotencyService := services.NewIdempotencyService(idempotencyKeyRepo, &config.IdempotencyConfig{TTL: 24, LockTimeout: 60})
 
-	authHandler := handlers.NewAuthHandler(userService, authService)
-	userHandler := handlers.NewUserHandler(userService)
+	authHandler := handlers.NewAuthHandler(userService, authService, verificationService, loginGuard, constants)
+	userHandler := handlers.NewUserHandler(userService, verificationService, loginGuard)
 	productHandler := handlers.NewProductHandler(productService)
+	passwordHandler := handlers.NewPasswordHandler(passwordResetService)
+	verificationHandler := handlers.NewVerificationHandler(verificationService)
+	mfaHandler := handlers.NewMFAHandler(mfaService, authService, loginGuard)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	roleHandler := handlers.NewRoleHandler(rbacService)
 
 	router := gin.New()
+	router.Use(middleware.RequestID())
+	router.Use(middleware.Tracing("marketplace-api", "/metrics")...)
+	router.Use(middleware.Metrics())
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	checker := health.NewChecker(time.Second)
+	checker.Register("database", dbManager.Ping)
+	schemaCheck, err := migrationsCheck(db, cfg.Driver)
+	if err != nil {
+		panic(err)
+	}
+	checker.Register("migrations", schemaCheck)
+	handlers.NewHealthHandler(checker).RegisterRoutes(router)
+	router.NoRoute(problem.NoRoute)
 	api := router.Group("/api/v1")
-	authHandler.RegisterRoutes(api)
+	authMiddleware := middleware.AuthMiddleware(authService, apiKeyService)
+	authHandler.RegisterRoutes(api, authMiddleware)
+	passwordHandler.RegisterRoutes(api)
+	verificationHandler.RegisterRoutes(api, authMiddleware)
+	mfaHandler.RegisterRoutes(api, authMiddleware)
 
 	protected := api.Group("")
-	protected.Use(middleware.AuthMiddleware(authService))
-	userHandler.RegisterRoutes(protected, middleware.AuthMiddleware(authService), middleware.RoleMiddleware(models.RoleAdmin))
-	productHandler.RegisterRoutes(protected)
+	protected.Use(authMiddleware, middleware.LoadPermissions(rbacService), middleware.Idempotency(idempotencyService))
+	requirePermission := func(permission string) gin.HandlerFunc {
+		return middleware.RequirePermission(rbacService, permission)
+	}
+	userHandler.RegisterRoutes(protected, requirePermission)
+	userHandler.RegisterMeRoutes(protected)
+	roleHandler.RegisterRoutes(protected, requirePermission)
+	productHandler.RegisterRoutes(protected, requirePermission)
+	apiKeyHandler.RegisterRoutes(protected)
 
 	return router
 }
@@ -126,3 +200,599 @@ func TestCreateProduct(t *testing.T) {
 	assert.Equal(t, "TEST001", response.Code)
 	assert.Equal(t, "active", response.Status)
 }
+
+func doJSON(router *gin.Engine, method, path, token string, body any) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req, _ := http.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func registerAndLogin(t *testing.T, router *gin.Engine, email string) string {
+	w := doJSON(router, "POST", "/api/v1/register", "", map[string]string{
+		"name":     "Test User",
+		"email":    email,
+		"password": "testpassword123",
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = doJSON(router, "POST", "/api/v1/login", "", map[string]string{
+		"email":    email,
+		"password": "testpassword123",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var loginResp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &loginResp)
+	return loginResp["token"]
+}
+
+func TestMeEndpoints(t *testing.T) {
+	router := setupTestRouter()
+	token := registerAndLogin(t, router, "me@example.com")
+	registerAndLogin(t, router, "other@example.com")
+
+	w := doJSON(router, "GET", "/api/v1/me", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var me models.User
+	json.Unmarshal(w.Body.Bytes(), &me)
+	assert.Equal(t, "me@example.com", me.Email)
+
+	// Only allow-listed fields can be changed
+	w = doJSON(router, "PATCH", "/api/v1/me", token, map[string]string{"role": "admin"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(router, "PATCH", "/api/v1/me", token, map[string]string{"name": "Renamed"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &me)
+	assert.Equal(t, "Renamed", me.Name)
+	assert.Equal(t, models.RoleUser, me.Role)
+
+	// Other users' accounts are off limits
+	w = doJSON(router, "GET", "/api/v1/users/2", token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doJSON(router, "PUT", "/api/v1/users/2", token, map[string]string{"email": "stolen@example.com"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doJSON(router, "PUT", "/api/v1/me/password", token, map[string]string{
+		"current_password": "wrong-password",
+		"new_password":     "newpassword123",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(router, "PUT", "/api/v1/me/password", token, map[string]string{
+		"current_password": "testpassword123",
+		"new_password":     "newpassword123",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The change signs every session out, so sign in again with the new password
+	w = doJSON(router, "POST", "/api/v1/login", "", map[string]string{
+		"email":    "me@example.com",
+		"password": "newpassword123",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	var loginResp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &loginResp)
+
+	w = doJSON(router, "DELETE", "/api/v1/me", loginResp["token"], nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRequestID(t *testing.T) {
+	router := setupTestRouter()
+
+	// A valid client ID is echoed in the header and in error bodies
+	req, _ := http.NewRequest("GET", "/api/v1/me", nil)
+	req.Header.Set("X-Request-ID", "client-req-42")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "client-req-42", w.Header().Get("X-Request-ID"))
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, "client-req-42", body["request_id"])
+	assert.Equal(t, "Authorization header missing", body["detail"])
+
+	// An invalid one is replaced
+	req, _ = http.NewRequest("GET", "/api/v1/me", nil)
+	req.Header.Set("X-Request-ID", "*/ DROP TABLE users; /*")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	generated := w.Header().Get("X-Request-ID")
+	assert.Len(t, generated, 32)
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, generated, body["request_id"])
+
+	// Successful responses are left alone
+	token := registerAndLogin(t, router, "reqid@example.com")
+	w = doJSON(router, "GET", "/api/v1/me", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
+	assert.NotContains(t, w.Body.String(), "request_id")
+}
+
+func TestProblemDetails(t *testing.T) {
+	router := setupTestRouter()
+	token := registerAndLogin(t, router, "problems@example.com")
+	decode := func(w *httptest.ResponseRecorder) problem.Details {
+		t.Helper()
+		assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+		var details problem.Details
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &details))
+		assert.Equal(t, w.Code, details.Status)
+		assert.Equal(t, w.Header().Get("X-Request-ID"), details.RequestID)
+		return details
+	}
+
+	product := map[string]any{"code": "DUP-1", "name": "Widget", "price": 100}
+	w := doJSON(router, "POST", "/api/v1/products", token, product)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	// A duplicate code is a conflict, not a server error
+	w = doJSON(router, "POST", "/api/v1/products", token, product)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	details := decode(w)
+	assert.Equal(t, "product_code_taken", details.Code)
+	assert.Equal(t, "product code is already in use: DUP-1", details.Detail)
+	assert.Equal(t, "/api/v1/products", details.Instance)
+
+	w = doJSON(router, "GET", "/api/v1/products/9999", token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "product_not_found", decode(w).Code)
+
+	// Every invalid field is reported by its JSON name
+	w = doJSON(router, "POST", "/api/v1/register", "", map[string]string{"email": "not-an-email", "password": "short"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	details = decode(w)
+	assert.Equal(t, "validation_failed", details.Code)
+	assert.Equal(t, []services.FieldError{
+		{Field: "name", Code: "required", Message: "is required"},
+		{Field: "email", Code: "email", Message: "must be a valid email address"},
+		{Field: "password", Code: "password_length", Message: "must be at least 8 characters and at most 72 bytes"},
+	}, details.Errors)
+
+	w = doJSON(router, "POST", "/api/v1/register", "", map[string]string{"name": "Again", "email": "problems@example.com", "password": "testpassword123"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "email_taken", decode(w).Code)
+
+	w = doJSON(router, "GET", "/api/v1/nowhere", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "route_not_found", decode(w).Code)
+}
+
+func TestProductValidation(t *testing.T) {
+	router := setupTestRouter()
+	token := registerAndLogin(t, router, "validation@example.com")
+
+	// Every rejected field is reported at once
+	w := doJSON(router, "POST", "/api/v1/products", token, map[string]any{
+		"code":   "bad code!",
+		"name":   strings.Repeat("n", 101),
+		"price":  0,
+		"status": "archived",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var details problem.Details
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &details))
+	var codes []string
+	for _, field := range details.Errors {
+		codes = append(codes, field.Field+":"+field.Code)
+	}
+	assert.Equal(t, []string{"code:product_code", "name:name_length", "price:gt", "status:product_status"}, codes)
+
+	w = doJSON(router, "POST", "/api/v1/products", token, map[string]any{"code": "VALID-1", "name": "Valid", "price": 5})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var product models.Product
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &product))
+
+	// A non-string code is a field error rather than a server error
+	path := fmt.Sprintf("/api/v1/products/%d", product.ID)
+	w = doJSON(router, "PATCH", path, token, map[string]any{"code": 42})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &details))
+	assert.Equal(t, []services.FieldError{{Field: "code", Code: "type", Message: "must be a string"}}, details.Errors)
+
+	w = doJSON(router, "PATCH", path, token, map[string]any{"name": " "})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(router, "PATCH", path, token, map[string]any{"status": "inactive"})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestProductUpdates(t *testing.T) {
+	router := setupTestRouter()
+	token := registerAndLogin(t, router, "updates@example.com")
+
+	w := doJSON(router, "POST", "/api/v1/products", token, map[string]any{
+		"code":        "UPD-1",
+		"name":        "Lamp",
+		"description": "Brass desk lamp",
+		"price":       40,
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var product models.Product
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &product))
+	path := fmt.Sprintf("/api/v1/products/%d", product.ID)
+
+	// A merge patch changes only what it names, and null clears a field
+	req, _ := http.NewRequest("PATCH", path, strings.NewReader(`{"price": 45, "description": null}`))
+	req.Header.Set("Content-Type", handlers.MergePatchContentType)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var updated models.Product
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, uint(45), updated.Price)
+	assert.Equal(t, "", updated.Description)
+	assert.Equal(t, "Lamp", updated.Name)
+	assert.Equal(t, "UPD-1", updated.Code)
+
+	req, _ = http.NewRequest("PATCH", path, strings.NewReader(`price=50`))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.Equal(t, handlers.MergePatchContentType, w.Header().Get("Accept-Patch"))
+
+	// Fields outside the allow-list are rejected, not silently written
+	w = doJSON(router, "PATCH", path, token, map[string]any{"id": 99, "created_at": "2020-01-01T00:00:00Z"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var details problem.Details
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &details))
+	assert.Equal(t, "unknown_field", details.Errors[0].Code)
+
+	// PUT replaces the whole product, so required fields must be present
+	w = doJSON(router, "PUT", path, token, map[string]any{"name": "Floor lamp"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(router, "PUT", path, token, map[string]any{
+		"code":   "UPD-2",
+		"name":   "Floor lamp",
+		"price":  120,
+		"status": "inactive",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, "UPD-2", updated.Code)
+	assert.Equal(t, "Floor lamp", updated.Name)
+	assert.Equal(t, "inactive", updated.Status)
+	assert.Equal(t, product.UserID, updated.UserID, "left out owner is kept")
+
+	w = doJSON(router, "GET", path, token, nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, uint(120), updated.Price)
+}
+
+func TestConditionalRequests(t *testing.T) {
+	router := setupTestRouter()
+	token := registerAndLogin(t, router, "etag@example.com")
+
+	w := doJSON(router, "POST", "/api/v1/products", token, map[string]any{"code": "ETAG-1", "name": "Chair", "price": 80})
+	require.Equal(t, http.StatusCreated, w.Code)
+	createdETag := w.Header().Get("ETag")
+	var product models.Product
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &product))
+	path := fmt.Sprintf("/api/v1/products/%d", product.ID)
+
+	send := func(method, header, etag string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req, _ := http.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(header, etag)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Editing the owner's profile leaves the product's ETag alone
+	w = doJSON(router, "PATCH", "/api/v1/me", token, map[string]any{"name": "Renamed Seller"})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doJSON(router, "GET", path, token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, createdETag, etag)
+
+	w = send("GET", "If-None-Match", etag, nil)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = send("PATCH", "If-Match", etag, map[string]any{"price": 85})
+	require.Equal(t, http.StatusOK, w.Code)
+	newETag := w.Header().Get("ETag")
+	assert.NotEqual(t, etag, newETag)
+
+	// A second seller still holding the old ETag must not overwrite the change
+	w = send("PATCH", "If-Match", etag, map[string]any{"price": 70})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	var details problem.Details
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &details))
+	assert.Equal(t, "version_mismatch", details.Code)
+
+	w = send("GET", "If-None-Match", etag, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &product))
+	assert.Equal(t, uint(85), product.Price)
+
+	w = send("DELETE", "If-Match", etag, nil)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = send("DELETE", "If-Match", newETag, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doJSON(router, "GET", "/api/v1/me", token, nil)
+	etag = w.Header().Get("ETag")
+	req, _ := http.NewRequest("GET", "/api/v1/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-None-Match", "W/"+etag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code, "If-None-Match compares weakly")
+}
+
+// enableTOTP turns on two-factor authentication for the user signed in with
+// token and returns the TOTP secret.
+func enableTOTP(t *testing.T, router *gin.Engine, token string) string {
+	w := doJSON(router, "POST", "/api/v1/mfa/totp/enroll", token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var enrollment services.TOTPEnrollment
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+	code, err := totp.GenerateCode(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+	w = doJSON(router, "POST", "/api/v1/mfa/totp/confirm", token, map[string]string{"code": code})
+	require.Equal(t, http.StatusOK, w.Code)
+	return enrollment.Secret
+}
+
+func TestMFALoginThrottling(t *testing.T) {
+	router := setupTestRouter()
+	token := registerAndLogin(t, router, "mfa@example.com")
+	enableTOTP(t, router, token)
+
+	challenge := func() string {
+		w := doJSON(router, "POST", "/api/v1/login", "", map[string]string{"email": "mfa@example.com", "password": "testpassword123"})
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp["mfa_token"].(string)
+	}
+
+	// A challenge is good for one guess
+	mfaToken := challenge()
+	w := doJSON(router, "POST", "/api/v1/login/mfa", "", map[string]string{"mfa_token": mfaToken, "code": "000000"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doJSON(router, "POST", "/api/v1/login/mfa", "", map[string]string{"mfa_token": mfaToken, "code": "000000"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	var details problem.Details
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &details))
+	assert.Equal(t, "invalid_mfa_challenge", details.Code)
+
+	// Wrong codes count towards the lockout even though the password is right
+	for i := 1; i < 5; i++ {
+		w = doJSON(router, "POST", "/api/v1/login/mfa", "", map[string]string{"mfa_token": challenge(), "code": "000000"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	w = doJSON(router, "POST", "/api/v1/login", "", map[string]string{"email": "mfa@example.com", "password": "testpassword123"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+func TestMFADisableThrottling(t *testing.T) {
+	router := setupTestRouter()
+	token := registerAndLogin(t, router, "mfa-disable@example.com")
+	secret := enableTOTP(t, router, token)
+
+	// A stolen session cannot be used to guess the code that turns MFA off
+	for range 5 {
+		w := doJSON(router, "POST", "/api/v1/mfa/totp/disable", token, map[string]string{"code": "000000"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+	code, err := totp.GenerateCode(secret, time.Now().Add(30*time.Second))
+	require.NoError(t, err)
+	w := doJSON(router, "POST", "/api/v1/mfa/totp/disable", token, map[string]string{"code": code})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func TestAPIKeyRestrictions(t *testing.T) {
+	router := setupTestRouter()
+	token := registerAndLogin(t, router, "apikey@example.com")
+
+	w := doJSON(router, "POST", "/api/v1/api-keys", token, map[string]any{"name": "unscoped"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Key string `json:"key"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	w = doJSON(router, "GET", "/api/v1/products", created.Key, nil)
+	assert.Equal(t, http.StatusOK, w.Code, "a key without scopes can read")
+	w = doJSON(router, "POST", "/api/v1/products", created.Key, map[string]any{"code": "KEY-1", "name": "Desk", "price": 100})
+	assert.Equal(t, http.StatusForbidden, w.Code, "but not write")
+
+	for _, route := range []struct{ method, path string }{
+		{"GET", "/api/v1/api-keys"},
+		{"POST", "/api/v1/api-keys"},
+		{"POST", "/api/v1/mfa/totp/disable"},
+		{"PUT", "/api/v1/me/password"},
+	} {
+		w = doJSON(router, route.method, route.path, created.Key, map[string]any{"name": "minted"})
+		require.Equal(t, http.StatusForbidden, w.Code, "%s %s", route.method, route.path)
+		var details problem.Details
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &details))
+		assert.Equal(t, "api_key_not_allowed", details.Code)
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	router := setupTestRouter()
+	token := registerAndLogin(t, router, "retry@example.com")
+	otherToken := registerAndLogin(t, router, "retry-other@example.com")
+
+	postTo := func(path, token, key string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(body)
+		req, _ := http.NewRequest("POST", path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(middleware.IdempotencyKeyHeader, key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	post := func(token, key string, body any) *httptest.ResponseRecorder {
+		return postTo("/api/v1/products", token, key, body)
+	}
+	product := map[string]any{"code": "RETRY-1", "name": "Kettle", "price": 30}
+
+	first := post(token, "create-kettle", product)
+	require.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(middleware.IdempotentReplayedHeader))
+
+	// A retry gets the first response rather than a duplicate code error
+	retry := post(token, "create-kettle", product)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get(middleware.IdempotentReplayedHeader))
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, first.Header().Get("Content-Type"), retry.Header().Get("Content-Type"))
+	assert.NotEmpty(t, retry.Header().Get("ETag"))
+	assert.Equal(t, first.Header().Get("ETag"), retry.Header().Get("ETag"))
+
+	w := doJSON(router, "GET", "/api/v1/products?code=RETRY", token, nil)
+	var page models.PaginatedResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, int64(1), page.Total)
+
+	w = post(token, "create-kettle", map[string]any{"code": "RETRY-2", "name": "Kettle", "price": 30})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var details problem.Details
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &details))
+	assert.Equal(t, "idempotency_key_reused", details.Code)
+
+	// Keys belong to the user who sent them
+	w = post(otherToken, "create-kettle", map[string]any{"code": "RETRY-3", "name": "Kettle", "price": 30})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Errors are replayed too, naming the request that ran in the logs
+	failed := post(token, "duplicate", product)
+	require.Equal(t, http.StatusConflict, failed.Code)
+	retry = post(token, "duplicate", product)
+	assert.Equal(t, http.StatusConflict, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get(middleware.IdempotentReplayedHeader))
+	require.NoError(t, json.Unmarshal(retry.Body.Bytes(), &details))
+	assert.Equal(t, "product_code_taken", details.Code)
+	assert.Equal(t, failed.Header().Get("X-Request-ID"), details.RequestID)
+
+	// Authorization failures are not, as the caller's permissions may change
+	role := map[string]any{"name": "retry-role", "permissions": []string{models.PermissionProductsRead}}
+	w = postTo("/api/v1/roles", token, "create-role", role)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	retry = postTo("/api/v1/roles", token, "create-role", role)
+	assert.Equal(t, http.StatusForbidden, retry.Code)
+	assert.Empty(t, retry.Header().Get(middleware.IdempotentReplayedHeader))
+}
+
+func TestMetrics(t *testing.T) {
+	router := setupTestRouter()
+	logins := testutil.ToFloat64(metrics.Logins.WithLabelValues("success"))
+	failures := testutil.ToFloat64(metrics.Logins.WithLabelValues("failure"))
+	registrations := testutil.ToFloat64(metrics.Registrations)
+
+	registerAndLogin(t, router, "metrics@example.com")
+	w := doJSON(router, "POST", "/api/v1/login", "", map[string]string{"email": "metrics@example.com", "password": "wrong-password"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	assert.Equal(t, registrations+1, testutil.ToFloat64(metrics.Registrations))
+	assert.Equal(t, logins+1, testutil.ToFloat64(metrics.Logins.WithLabelValues("success")))
+	assert.Equal(t, failures+1, testutil.ToFloat64(metrics.Logins.WithLabelValues("failure")))
+
+	w = doJSON(router, "GET", "/metrics", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `marketplace_http_requests_total{method="POST",route="/api/v1/login",status="401"}`)
+	assert.Contains(t, body, `marketplace_http_request_duration_seconds_bucket{method="POST",route="/api/v1/register",status="201",le="0.005"}`)
+	assert.Contains(t, body, `marketplace_password_hash_duration_seconds_count{operation="hash"}`)
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func TestHealthProbes(t *testing.T) {
+	router := setupTestRouter()
+
+	w := doJSON(router, "GET", "/livez", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doJSON(router, "GET", "/readyz", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var report struct {
+		Status string
+		Checks map[string]health.Result
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, "ok", report.Status)
+	assert.Equal(t, "ok", report.Checks["database"].Status)
+	assert.Equal(t, "ok", report.Checks["migrations"].Status)
+
+	// A database without the schema fails the migrations check
+	dbManager, err := database.NewManager(&config.DatabaseConfig{Driver: "sqlite", SQLite: config.SQLiteConfig{Path: ":memory:"}})
+	require.NoError(t, err)
+	db, err := dbManager.Connect()
+	require.NoError(t, err)
+	defer dbManager.Close()
+	check, err := migrationsCheck(db, "sqlite")
+	require.NoError(t, err)
+	assert.ErrorContains(t, check(context.Background()), "migrations are pending, the first is 1_create_users_table")
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	router := setupTestRouter()
+	token := registerAndLogin(t, router, "traced@example.com")
+
+	productJSON, _ := json.Marshal(map[string]any{"code": "TRACE001", "name": "Traced", "price": 10})
+	req, _ := http.NewRequest("POST", "/api/v1/products", bytes.NewBuffer(productJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("traceparent"), "00-4bf92f3577b34da6a3ce929d0e0e4736-"), "the response carries the caller's trace")
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	children := map[string][]string{}
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			continue
+		}
+		spans[span.Name()] = span
+		children[span.Parent().SpanID().String()] = append(children[span.Parent().SpanID().String()], span.Name())
+	}
+
+	server, ok := spans["POST /api/v1/products"]
+	require.True(t, ok, "the request span continues the caller's trace")
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+
+	service, ok := spans["ProductService.CreateProduct"]
+	require.True(t, ok)
+	assert.Equal(t, server.SpanContext().SpanID(), service.Parent().SpanID())
+	// The user lookup, the product limit and code checks, and the insert
+	assert.Equal(t, []string{"gorm.Query", "gorm.Query", "gorm.Query", "gorm.Create"}, children[service.SpanContext().SpanID().String()])
+}
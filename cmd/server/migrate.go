@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/database"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/health"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/migrate"
+	"github.com/MikeTeddyOmondi/marketplace-api/migrations"
+
+	"gorm.io/gorm"
+)
+
+const migrateUsage = `usage: server [--config-dir DIR] migrate <command>
+
+commands:
+  up [-n N]                      apply pending migrations, or only the next N
+  down [-n N]                    roll back the last N migrations (default 1)
+  status                         list migrations and whether they are applied
+  create [-drivers LIST] NAME    add empty migration files to the migrations directory
+  force VERSION                  mark migrations up to VERSION as applied without running them`
+
+func newMigrator(db *gorm.DB, driver string) (*migrate.Migrator, error) {
+	loaded, err := migrate.Load(migrations.FS, driver)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, loaded), nil
+}
+
+// prepareSchema brings the schema up to date before serving, or checks that
+// it is, depending on the migrations config.
+func prepareSchema(ctx context.Context, db *gorm.DB, cfg *config.DatabaseConfig) error {
+	migrator, err := newMigrator(db, cfg.Driver)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Migrations.AutoApply {
+		applied, err := migrator.Up(ctx, 0)
+		for _, migration := range applied {
+			slog.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+		}
+		return err
+	}
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if cfg.Migrations.FailOnPending {
+		return fmt.Errorf("%d migrations are pending, run \"server migrate up\"", len(pending))
+	}
+	slog.Warn("Migrations are pending, run \"server migrate up\"", "pending", len(pending))
+	return nil
+}
+
+// migrationsCheck is a readiness check failing while migrations known to
+// this binary are not applied, e.g. with auto_apply off before "migrate up".
+func migrationsCheck(db *gorm.DB, driver string) (health.Check, error) {
+	migrator, err := newMigrator(db, driver)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d migrations are pending, the first is %d_%s", len(pending), pending[0].Version, pending[0].Name)
+		}
+		return nil
+	}, nil
+}
+
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	command, args := args[0], args[1:]
+
+	// create only touches files, so it works without a database
+	if command == "create" {
+		fs := flag.NewFlagSet("migrate create", flag.ExitOnError)
+		drivers := fs.String("drivers", "", "comma separated drivers to write separate up files for, e.g. sqlite,postgres,mysql")
+		dir := fs.String("dir", "migrations", "migrations directory")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errors.New(migrateUsage)
+		}
+		var driverList []string
+		if *drivers != "" {
+			driverList = strings.Split(*drivers, ",")
+		}
+		paths, err := migrate.Create(*dir, fs.Arg(0), driverList)
+		for _, path := range paths {
+			fmt.Printf("Created %s\n", path)
+		}
+		return err
+	}
+
+	cfg, err := config.Load(*configDir)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	dbManager, err := database.NewManager(&cfg.Database)
+	if err != nil {
+		return err
+	}
+	db, err := dbManager.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	migrator, err := newMigrator(db, cfg.Database.Driver)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch command {
+	case "up", "down":
+		fs := flag.NewFlagSet("migrate "+command, flag.ExitOnError)
+		defaultSteps := 0
+		if command == "down" {
+			defaultSteps = 1
+		}
+		steps := fs.Int("n", defaultSteps, "number of migrations")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		var done []migrate.Migration
+		if command == "up" {
+			done, err = migrator.Up(ctx, *steps)
+		} else {
+			done, err = migrator.Down(ctx, *steps)
+		}
+		for _, migration := range done {
+			fmt.Printf("%s %03d_%s\n", map[string]string{"up": "Applied", "down": "Rolled back"}[command], migration.Version, migration.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("Nothing to do")
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Local().Format(time.RFC3339)
+			}
+			if status.Missing {
+				state += " (unknown to this binary)"
+			}
+			fmt.Printf("%03d_%-40s %s\n", status.Version, status.Name, state)
+		}
+		return nil
+	case "force":
+		if len(args) != 1 {
+			return errors.New(migrateUsage)
+		}
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		if err := migrator.Force(ctx, version); err != nil {
+			return err
+		}
+		fmt.Printf("Marked migrations up to %03d as applied\n", version)
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
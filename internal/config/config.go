@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
 
 	"gopkg.in/yaml.v3"
 )
@@ -14,9 +16,66 @@ type Config struct {
 }
 
 type AppConfig struct {
-	Server  ServerConfig  `yaml:"server"`
-	Logging LoggingConfig `yaml:"logging"`
-	CORS    CORSConfig    `yaml:"cors"`
+	Server        ServerConfig       `yaml:"server"`
+	Logging       LoggingConfig      `yaml:"logging"`
+	CORS          CORSConfig         `yaml:"cors"`
+	Notifications NotificationConfig `yaml:"notifications"`
+	ConfigReload  ConfigReloadConfig `yaml:"config_reload"`
+	Metrics       MetricsConfig      `yaml:"metrics"`
+	Tracing       TracingConfig      `yaml:"tracing"`
+	Health        HealthConfig       `yaml:"health"`
+	Idempotency   IdempotencyConfig  `yaml:"idempotency"`
+}
+
+// HealthConfig controls the readiness probe. On shutdown readiness fails for
+// DrainDelay seconds before the server stops accepting requests, giving load
+// balancers time to stop routing to it.
+type HealthConfig struct {
+	CheckTimeout int `yaml:"check_timeout"` // seconds each readiness check may take
+	DrainDelay   int `yaml:"drain_delay"`   // seconds
+}
+
+// IdempotencyConfig controls how long the response to a POST with an
+// Idempotency-Key header is kept for retries.
+type IdempotencyConfig struct {
+	TTL         int `yaml:"ttl"`          // hours a stored response is replayed
+	LockTimeout int `yaml:"lock_timeout"` // seconds before a request that never finished stops holding its key
+}
+
+// MetricsConfig controls the Prometheus metrics endpoint. With an AdminPort
+// it is served on that port instead of the API port.
+type MetricsConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Path      string `yaml:"path"`
+	AdminPort int    `yaml:"admin_port"`
+}
+
+// ConfigReloadConfig controls live reloading. A reload always happens on
+// SIGHUP; with Watch the config files are also polled for changes.
+type ConfigReloadConfig struct {
+	Watch    bool `yaml:"watch"`
+	Interval int  `yaml:"interval"` // seconds between checks for changed files
+}
+
+// TracingConfig controls OpenTelemetry tracing. Exporter is "otlp" to send
+// spans to a collector over OTLP/HTTP, or "stdout" or "file" to write them as
+// JSON for local debugging.
+type TracingConfig struct {
+	Enabled     bool       `yaml:"enabled"`
+	ServiceName string     `yaml:"service_name"`
+	Exporter    string     `yaml:"exporter"`
+	SampleRatio float64    `yaml:"sample_ratio"` // of new traces, traces started by a caller follow its decision
+	FilePath    string     `yaml:"file_path"`    // for the file exporter
+	OTLP        OTLPConfig `yaml:"otlp"`
+}
+
+// OTLPConfig configures the OTLP/HTTP exporter. Settings left empty fall back
+// to the standard OTEL_EXPORTER_OTLP_* environment variables.
+type OTLPConfig struct {
+	Endpoint string            `yaml:"endpoint"`              // host:port of the collector, e.g. localhost:4318
+	Insecure bool              `yaml:"insecure"`              // use plain HTTP
+	Headers  map[string]string `yaml:"headers" secret:"true"` // sent with every export, e.g. for authentication
+	Timeout  int               `yaml:"timeout"`               // seconds
 }
 
 type ServerConfig struct {
@@ -27,9 +86,19 @@ type ServerConfig struct {
 }
 
 type LoggingConfig struct {
-	Level  string `yaml:"level"`
-	Format string `yaml:"format"`
-	Output string `yaml:"output"`
+	Level  string        `yaml:"level"`  // debug, info, warn or error
+	Format string        `yaml:"format"` // json or text
+	Output string        `yaml:"output"` // stdout, stderr or file
+	File   LogFileConfig `yaml:"file"`
+}
+
+// LogFileConfig configures the rotating log file used when Output is "file".
+type LogFileConfig struct {
+	Path       string `yaml:"path"`
+	MaxSize    int    `yaml:"max_size"`    // megabytes before the file is rotated
+	MaxBackups int    `yaml:"max_backups"` // rotated files to keep, 0 keeps all
+	MaxAge     int    `yaml:"max_age"`     // days to keep rotated files, 0 keeps them
+	Compress   bool   `yaml:"compress"`    // gzip rotated files
 }
 
 type CORSConfig struct {
@@ -38,12 +107,28 @@ type CORSConfig struct {
 	AllowedHeaders []string `yaml:"allowed_headers"`
 }
 
+type NotificationConfig struct {
+	Driver   string `yaml:"driver"`
+	FilePath string `yaml:"file_path"`
+}
+
 type DatabaseConfig struct {
 	Driver         string               `yaml:"driver"`
 	SQLite         SQLiteConfig         `yaml:"sqlite"`
 	Postgres       PostgresConfig       `yaml:"postgres"`
 	MySQL          MySQLConfig          `yaml:"mysql"`
 	ConnectionPool ConnectionPoolConfig `yaml:"connection_pool"`
+	Migrations     MigrationsConfig     `yaml:"migrations"`
+	// SlowQueryThreshold is the duration in milliseconds above which a
+	// query is logged as a warning. 0 turns slow query warnings off.
+	SlowQueryThreshold int `yaml:"slow_query_threshold"`
+}
+
+// MigrationsConfig controls what the server does with pending migrations on
+// startup. They can always be applied with "server migrate up".
+type MigrationsConfig struct {
+	AutoApply     bool `yaml:"auto_apply"`      // apply pending migrations before serving
+	FailOnPending bool `yaml:"fail_on_pending"` // refuse to start while migrations are pending
 }
 
 type SQLiteConfig struct {
@@ -54,21 +139,33 @@ type PostgresConfig struct {
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
 	User     string `yaml:"user"`
-	Password string `yaml:"password"`
+	Password string `yaml:"password" secret:"true"`
 	DBName   string `yaml:"dbname"`
 	SSLMode  string `yaml:"sslmode"`
 	TimeZone string `yaml:"timezone"`
 }
 
 type MySQLConfig struct {
-	Host      string `yaml:"host"`
-	Port      int    `yaml:"port"`
-	User      string `yaml:"user"`
-	Password  string `yaml:"password"`
-	DBName    string `yaml:"dbname"`
-	Charset   string `yaml:"charset"`
-	ParseTime bool   `yaml:"parse_time"`
-	Loc       string `yaml:"loc"`
+	Host      string         `yaml:"host"`
+	Port      int            `yaml:"port"`
+	User      string         `yaml:"user"`
+	Password  string         `yaml:"password" secret:"true"`
+	DBName    string         `yaml:"dbname"`
+	Charset   string         `yaml:"charset"`
+	ParseTime bool           `yaml:"parse_time"`
+	Loc       string         `yaml:"loc"`
+	TLS       MySQLTLSConfig `yaml:"tls"`
+}
+
+// MySQLTLSConfig configures encryption of MySQL connections. Mode is one of
+// "false" (the default), "true", "skip-verify" or "preferred". Setting any of
+// the certificate options implies "true" unless Mode is "skip-verify".
+type MySQLTLSConfig struct {
+	Mode       string `yaml:"mode"`
+	CACert     string `yaml:"ca_cert"`     // PEM file with the CA to verify the server against
+	ClientCert string `yaml:"client_cert"` // PEM client certificate, for X509 accounts
+	ClientKey  string `yaml:"client_key"`
+	ServerName string `yaml:"server_name"` // name to verify instead of the host
 }
 
 type ConnectionPoolConfig struct {
@@ -78,9 +175,52 @@ type ConnectionPoolConfig struct {
 }
 
 type AuthConfig struct {
-    JWTSecret       string `yaml:"jwt_secret"`
-    TokenExpiration int    `yaml:"token_expiration"`
-    PasswordCost    int    `yaml:"password_cost"`
+    JWTSecret               string                  `yaml:"jwt_secret" secret:"true"`
+    AccessTokenExpiration   int                     `yaml:"access_token_expiration"`   // minutes
+    RefreshTokenExpiration  int                     `yaml:"refresh_token_expiration"`  // hours
+    PasswordCost            int                     `yaml:"password_cost"`
+    PasswordResetExpiration int                     `yaml:"password_reset_expiration"` // minutes
+    Signing                 SigningConfig           `yaml:"signing"`
+    EmailVerification       EmailVerificationConfig `yaml:"email_verification"`
+    MFA                     MFAConfig               `yaml:"mfa"`
+    Lockout                 LockoutConfig           `yaml:"lockout"`
+}
+
+// LockoutConfig throttles failed logins per account and per client IP.
+type LockoutConfig struct {
+	MaxFailures      int `yaml:"max_failures"`        // per account before a lockout
+	MaxFailuresPerIP int `yaml:"max_failures_per_ip"` // per client IP before a lockout
+	Duration         int `yaml:"duration"`            // minutes
+	DelayAfter       int `yaml:"delay_after"`         // failures before progressive delays start
+	BaseDelay        int `yaml:"base_delay"`          // seconds, doubled for every further failure
+	MaxDelay         int `yaml:"max_delay"`           // seconds
+	ResetAfter       int `yaml:"reset_after"`         // minutes without failures before counting restarts
+}
+
+type MFAConfig struct {
+	Issuer              string `yaml:"issuer"`               // shown in authenticator apps
+	ChallengeExpiration int    `yaml:"challenge_expiration"` // minutes
+	RecoveryCodes       int    `yaml:"recovery_codes"`
+	RequiredForAdmin    bool   `yaml:"required_for_admin"`
+}
+
+type EmailVerificationConfig struct {
+	TokenExpiration     int  `yaml:"token_expiration"` // hours
+	RequiredForLogin    bool `yaml:"required_for_login"`
+	RequiredForProducts bool `yaml:"required_for_products"`
+}
+
+// SigningConfig lists the asymmetric JWT keys. Tokens are signed with
+// ActiveKey; the other keys are retired and only used for verification.
+// With no keys configured tokens are signed with HS256 and JWTSecret.
+type SigningConfig struct {
+	ActiveKey string             `yaml:"active_key"`
+	Keys      []SigningKeyConfig `yaml:"keys"`
+}
+
+type SigningKeyConfig struct {
+	KID  string `yaml:"kid"`
+	Path string `yaml:"path"`
 }
 
 type Constants struct {
@@ -88,6 +228,13 @@ type Constants struct {
     Validation    ValidationConfig    `yaml:"validation"`
     BusinessRules BusinessRulesConfig `yaml:"business_rules"`
     Auth          AuthConfig          `yaml:"auth"`
+    RBAC          RBACConfig          `yaml:"rbac"`
+}
+
+// RBACConfig defines the built-in roles as sets of permissions. Further roles
+// can be created at runtime and are stored in the database.
+type RBACConfig struct {
+	Roles map[string][]string `yaml:"roles"`
 }
 
 type PaginationConfig struct {
@@ -95,46 +242,127 @@ type PaginationConfig struct {
 	MaxPageSize     int `yaml:"max_page_size"`
 }
 
+// ValidationConfig holds the limits checked by the request validation rules.
 type ValidationConfig struct {
-	MinPasswordLength int `yaml:"min_password_length"`
-	MaxNameLength     int `yaml:"max_name_length"`
+	MinPasswordLength    int `yaml:"min_password_length"`
+	MaxNameLength        int `yaml:"max_name_length"`
+	MaxDescriptionLength int `yaml:"max_description_length"`
 }
 
 type BusinessRulesConfig struct {
 	MaxProductsPerUser   int    `yaml:"max_products_per_user"`
 	DefaultProductStatus string `yaml:"default_product_status"`
+	RequireIfMatch       bool   `yaml:"require_if_match"` // writes to products and users must name the version they change
+}
+
+// DefaultDir is the config directory used when neither the --config-dir
+// flag nor MARKETPLACE_CONFIG_DIR is set.
+const DefaultDir = "configs"
+
+// Dir returns the config directory named by MARKETPLACE_CONFIG_DIR, or
+// DefaultDir.
+func Dir() string {
+	if dir := os.Getenv(EnvPrefix + "_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	return DefaultDir
 }
 
-func Load() (*Config, error) {
+// Load reads app.yaml, database.yaml and constants.yaml from dir, expanding
+// ${VAR} references in their values, and then applies MARKETPLACE_*
+// environment overrides.
+func Load(dir string) (*Config, error) {
+	return load(dir, os.LookupEnv)
+}
+
+func load(dir string, lookup func(string) (string, bool)) (*Config, error) {
 	config := &Config{}
 
 	// Load app config
-	if err := loadYAMLFile("configs/app.yaml", &config.App); err != nil {
+	if err := loadYAMLFile(filepath.Join(dir, "app.yaml"), &config.App, lookup); err != nil {
 		return nil, fmt.Errorf("failed to load app config: %w", err)
 	}
 
 	// Load database config
-	if err := loadYAMLFile("configs/database.yaml", &config.Database); err != nil {
+	if err := loadYAMLFile(filepath.Join(dir, "database.yaml"), &config.Database, lookup); err != nil {
 		return nil, fmt.Errorf("failed to load database config: %w", err)
 	}
 
 	// Load constants
-	if err := loadYAMLFile("configs/constants.yaml", &config.Constants); err != nil {
+	if err := loadYAMLFile(filepath.Join(dir, "constants.yaml"), &config.Constants, lookup); err != nil {
 		return nil, fmt.Errorf("failed to load constants: %w", err)
 	}
 
+	if err := applyEnv(reflect.ValueOf(config).Elem(), EnvPrefix, lookup); err != nil {
+		return nil, err
+	}
+
+	config.applyDefaults()
 	return config, nil
 }
 
-func loadYAMLFile(filename string, out interface{}) error {
+// applyDefaults fills in optional settings left out of the YAML files.
+func (c *Config) applyDefaults() {
+	pool := &c.Database.ConnectionPool
+	if pool.MaxOpenConns == 0 {
+		pool.MaxOpenConns = 100
+	}
+	if pool.MaxIdleConns == 0 {
+		pool.MaxIdleConns = min(10, pool.MaxOpenConns)
+	}
+	if pool.ConnMaxLifetime == 0 {
+		pool.ConnMaxLifetime = 3600 // seconds
+	}
+
+	if c.App.Metrics.Path == "" {
+		c.App.Metrics.Path = "/metrics"
+	}
+	if c.App.Tracing.ServiceName == "" {
+		c.App.Tracing.ServiceName = "marketplace-api"
+	}
+	if c.Constants.Validation.MaxDescriptionLength == 0 {
+		c.Constants.Validation.MaxDescriptionLength = 2000
+	}
+	if c.App.Health.CheckTimeout == 0 {
+		c.App.Health.CheckTimeout = 2
+	}
+	idempotency := &c.App.Idempotency
+	if idempotency.TTL == 0 {
+		idempotency.TTL = 24
+	}
+	if idempotency.LockTimeout == 0 {
+		idempotency.LockTimeout = 60
+	}
+}
+
+func loadYAMLFile(filename string, out interface{}, lookup func(string) (string, bool)) error {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return err
 	}
 
-	return yaml.Unmarshal(data, out)
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	if node.Kind == 0 {
+		return nil // empty file
+	}
+	if err := interpolate(&node, lookup); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return node.Decode(out)
 }
 
 func (c *Config) GetAddress() string {
 	return fmt.Sprintf("%s:%d", c.App.Server.Host, c.App.Server.Port)
 }
+
+// GetMetricsAddress returns the address of the metrics admin server, or ""
+// when metrics are served on the API port.
+func (c *Config) GetMetricsAddress() string {
+	if c.App.Metrics.AdminPort == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", c.App.Server.Host, c.App.Metrics.AdminPort)
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigDir(t *testing.T, app, database, constants string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{"app.yaml": app, "database.yaml": database, "constants.yaml": constants} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	return dir
+}
+
+func envLookup(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestLoadInterpolatesEnvironment(t *testing.T) {
+	dir := writeConfigDir(t,
+		"server:\n  host: ${HOST:-0.0.0.0}\n  port: ${PORT}\n# ${IN_A_COMMENT}\n",
+		"driver: mysql\nmysql:\n  password: \"${DB_PASSWORD}\"\n  dbname: 'market_${ENVIRONMENT}'\n",
+		"auth:\n  jwt_secret: ${JWT_SECRET:-}\n",
+	)
+
+	cfg, err := load(dir, envLookup(map[string]string{"PORT": "9000", "DB_PASSWORD": "s3cr#t: x", "ENVIRONMENT": "staging"}))
+	require.NoError(t, err)
+	assert.Equal(t, "0.0.0.0", cfg.App.Server.Host)
+	assert.Equal(t, 9000, cfg.App.Server.Port)
+	assert.Equal(t, "s3cr#t: x", cfg.Database.MySQL.Password)
+	assert.Equal(t, "market_staging", cfg.Database.MySQL.DBName)
+	assert.Empty(t, cfg.Constants.Auth.JWTSecret)
+
+	_, err = load(dir, envLookup(map[string]string{"PORT": "9000"}))
+	assert.ErrorContains(t, err, "DB_PASSWORD is not set")
+}
+
+func TestLoadAppliesEnvOverrides(t *testing.T) {
+	dir := writeConfigDir(t,
+		"server:\n  port: 8080\ncors:\n  allowed_origins: [\"*\"]\n",
+		"driver: sqlite\n",
+		"auth:\n  jwt_secret: from-yaml\nrbac:\n  roles:\n    admin: [\"*\"]\n    user: [\"products:read\"]\n",
+	)
+	secretFile := filepath.Join(t.TempDir(), "db-password")
+	require.NoError(t, os.WriteFile(secretFile, []byte("from-file\n"), 0o600))
+
+	cfg, err := load(dir, envLookup(map[string]string{
+		"MARKETPLACE_APP_SERVER_PORT":                       "9090",
+		"MARKETPLACE_APP_CORS_ALLOWED_ORIGINS":              "https://a.example, https://b.example",
+		"MARKETPLACE_DATABASE_DRIVER":                       "postgres",
+		"MARKETPLACE_DATABASE_POSTGRES_PASSWORD_FILE":       secretFile,
+		"MARKETPLACE_CONSTANTS_AUTH_JWT_SECRET":             "from-env",
+		"MARKETPLACE_CONSTANTS_AUTH_MFA_REQUIRED_FOR_ADMIN": "true",
+		"MARKETPLACE_CONSTANTS_RBAC_ROLES":                  `{admin: ["*"]}`,
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, 9090, cfg.App.Server.Port)
+	assert.Equal(t, []string{"https://a.example", "https://b.example"}, cfg.App.CORS.AllowedOrigins)
+	assert.Equal(t, "postgres", cfg.Database.Driver)
+	assert.Equal(t, "from-file", cfg.Database.Postgres.Password)
+	assert.Equal(t, "from-env", cfg.Constants.Auth.JWTSecret)
+	assert.True(t, cfg.Constants.Auth.MFA.RequiredForAdmin)
+	assert.Equal(t, map[string][]string{"admin": {"*"}}, cfg.Constants.RBAC.Roles, "maps are replaced, not merged")
+}
+
+func TestLoadRejectsInvalidOverrides(t *testing.T) {
+	dir := writeConfigDir(t, "server:\n  port: 8080\n", "driver: sqlite\n", "")
+
+	_, err := load(dir, envLookup(map[string]string{"MARKETPLACE_APP_SERVER_PORT": "eighty"}))
+	assert.ErrorContains(t, err, "MARKETPLACE_APP_SERVER_PORT")
+
+	_, err = load(dir, envLookup(map[string]string{
+		"MARKETPLACE_DATABASE_MYSQL_PASSWORD":      "a",
+		"MARKETPLACE_DATABASE_MYSQL_PASSWORD_FILE": "b",
+	}))
+	assert.ErrorContains(t, err, "both MARKETPLACE_DATABASE_MYSQL_PASSWORD and MARKETPLACE_DATABASE_MYSQL_PASSWORD_FILE are set")
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := &Config{}
+	cfg.Constants.Auth.JWTSecret = "secret"
+	cfg.Database.MySQL.Password = "password"
+	cfg.Database.MySQL.User = "app"
+	cfg.App.Tracing.OTLP.Headers = map[string]string{"Authorization": "Bearer token"}
+
+	redacted := cfg.Redacted()
+	assert.Equal(t, RedactedValue, redacted.Constants.Auth.JWTSecret)
+	assert.Equal(t, RedactedValue, redacted.Database.MySQL.Password)
+	assert.Empty(t, redacted.Database.Postgres.Password, "unset secrets stay empty")
+	assert.Equal(t, "app", redacted.Database.MySQL.User)
+	assert.Equal(t, "secret", cfg.Constants.Auth.JWTSecret, "the original is unchanged")
+	assert.Equal(t, map[string]string{"Authorization": RedactedValue}, redacted.App.Tracing.OTLP.Headers)
+	assert.Equal(t, "Bearer token", cfg.App.Tracing.OTLP.Headers["Authorization"], "maps are copied, not masked in place")
+}
+
+func TestEnvNames(t *testing.T) {
+	names := EnvNames()
+	assert.Contains(t, names, "MARKETPLACE_APP_SERVER_PORT")
+	assert.Contains(t, names, "MARKETPLACE_DATABASE_MYSQL_TLS_CA_CERT")
+	assert.Contains(t, names, "MARKETPLACE_CONSTANTS_AUTH_LOCKOUT_MAX_FAILURES")
+	assert.NotContains(t, names, "MARKETPLACE_DATABASE_MYSQL")
+}
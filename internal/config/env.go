@@ -0,0 +1,194 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the name of every environment variable read by the
+// config package.
+//
+// Every field can be overridden by a variable named after its YAML path, e.g.
+// database.mysql.password is MARKETPLACE_DATABASE_MYSQL_PASSWORD and
+// constants.auth.jwt_secret is MARKETPLACE_CONSTANTS_AUTH_JWT_SECRET. The
+// same name with a _FILE suffix reads the value from a file instead, for
+// secrets mounted into a container. Lists take comma separated values; other
+// non-string fields take YAML, e.g. a flow mapping for rbac.roles.
+const EnvPrefix = "MARKETPLACE"
+
+// RedactedValue replaces secrets in Redacted configs.
+const RedactedValue = "[redacted]"
+
+// interpolationPattern matches ${NAME} and ${NAME:-default}.
+var interpolationPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// interpolate expands ${NAME} references in the scalar values of node. A
+// reference to an unset variable without a default is an error.
+func interpolate(node *yaml.Node, lookup func(string) (string, bool)) error {
+	if node.Kind == yaml.ScalarNode {
+		if !interpolationPattern.MatchString(node.Value) {
+			return nil
+		}
+		// Let an unquoted value be resolved again, so ${PORT} can fill an int.
+		if node.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) == 0 {
+			node.Tag = ""
+		}
+		var missing []string
+		node.Value = interpolationPattern.ReplaceAllStringFunc(node.Value, func(ref string) string {
+			match := interpolationPattern.FindStringSubmatch(ref)
+			if value, ok := lookup(match[1]); ok {
+				return value
+			}
+			if strings.Contains(ref, ":-") {
+				return match[2]
+			}
+			missing = append(missing, match[1])
+			return ref
+		})
+		if len(missing) > 0 {
+			return fmt.Errorf("line %d: environment variable %s is not set", node.Line, strings.Join(missing, ", "))
+		}
+		return nil
+	}
+	for _, child := range node.Content {
+		if err := interpolate(child, lookup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyEnv overrides the fields of the struct v from environment variables
+// named prefix followed by each field's YAML path.
+func applyEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := yamlName(t.Field(i))
+		if !ok {
+			continue
+		}
+		envName := prefix + "_" + strings.ToUpper(name)
+		field := v.Field(i)
+
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field, envName, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok, err := lookupEnv(envName, lookup)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", envName, err)
+		}
+	}
+	return nil
+}
+
+// lookupEnv reads name, or the file named by name_FILE.
+func lookupEnv(name string, lookup func(string) (string, bool)) (string, bool, error) {
+	value, ok := lookup(name)
+	path, fromFile := lookup(name + "_FILE")
+	switch {
+	case ok && fromFile:
+		return "", false, fmt.Errorf("both %s and %s_FILE are set", name, name)
+	case fromFile:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to read %s_FILE: %w", name, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	default:
+		return value, ok, nil
+	}
+}
+
+func setField(field reflect.Value, value string) error {
+	switch {
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+		return nil
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "["):
+		items := reflect.MakeSlice(field.Type(), 0, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = reflect.Append(items, reflect.ValueOf(item).Convert(field.Type().Elem()))
+			}
+		}
+		field.Set(items)
+		return nil
+	default:
+		// Replace rather than merge maps and slices.
+		field.Set(reflect.Zero(field.Type()))
+		return yaml.Unmarshal([]byte(value), field.Addr().Interface())
+	}
+}
+
+func yamlName(field reflect.StructField) (string, bool) {
+	name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	return name, name != "" && name != "-" && field.IsExported()
+}
+
+// Redacted returns a copy of c with every field tagged secret:"true" that is
+// set replaced by RedactedValue, for printing. Maps keep their keys and have
+// each value replaced.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redact(reflect.ValueOf(&redacted).Elem())
+	return &redacted
+}
+
+func redact(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct:
+			redact(field)
+		case t.Field(i).Tag.Get("secret") != "true":
+		case field.Kind() == reflect.String && field.String() != "":
+			field.SetString(RedactedValue)
+		case field.Kind() == reflect.Map && field.Len() > 0:
+			// Build a new map, the copy shares the original's.
+			masked := reflect.MakeMapWithSize(field.Type(), field.Len())
+			for _, key := range field.MapKeys() {
+				masked.SetMapIndex(key, reflect.ValueOf(RedactedValue).Convert(field.Type().Elem()))
+			}
+			field.Set(masked)
+		}
+	}
+}
+
+// EnvNames lists the environment variables that override config fields, in
+// field order.
+func EnvNames() []string {
+	var names []string
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := yamlName(t.Field(i))
+			if !ok {
+				continue
+			}
+			envName := prefix + "_" + strings.ToUpper(name)
+			if t.Field(i).Type.Kind() == reflect.Struct {
+				walk(t.Field(i).Type, envName)
+				continue
+			}
+			names = append(names, envName)
+		}
+	}
+	walk(reflect.TypeOf(Config{}), EnvPrefix)
+	return names
+}
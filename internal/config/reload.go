@@ -0,0 +1,214 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reloadable lists the YAML paths of the settings a reload applies while
+// serving. A change anywhere else is reported as needing a restart and is
+// not applied.
+var Reloadable = []string{
+	"app.cors",
+	"constants.pagination",
+	"constants.validation",
+	"constants.business_rules",
+}
+
+// configFiles are the files in the config directory read by Load.
+var configFiles = []string{"app.yaml", "database.yaml", "constants.yaml"}
+
+// ReloadResult lists the changed settings found by a reload.
+type ReloadResult struct {
+	Applied         []string // YAML paths now in effect
+	RestartRequired []string // YAML paths ignored until the next restart
+}
+
+// Reloader re-reads the config directory and hands the reloadable settings
+// to the callbacks registered with OnReload.
+type Reloader struct {
+	dir     string
+	load    func(dir string) (*Config, error)
+	mu      sync.Mutex // serialises reloads
+	current atomic.Pointer[Config]
+	apply   []func(*Config)
+	stamp   string // of the config files when current was loaded
+}
+
+// NewReloader returns a Reloader for the config directory dir, from which
+// cfg was just loaded.
+func NewReloader(dir string, cfg *Config) *Reloader {
+	r := &Reloader{dir: dir, load: Load}
+	r.current.Store(cfg)
+	r.stamp = r.fileStamp()
+	return r
+}
+
+// Current returns the config in effect. It must not be modified.
+func (r *Reloader) Current() *Config {
+	return r.current.Load()
+}
+
+// OnReload registers apply to be called with the new config after a reload
+// changed a reloadable setting.
+func (r *Reloader) OnReload(apply func(cfg *Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.apply = append(r.apply, apply)
+}
+
+// Reload loads and validates the config directory and swaps in its
+// reloadable settings. An invalid config is rejected as a whole.
+func (r *Reloader) Reload() (*ReloadResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	loaded, err := r.load(r.dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := loaded.Validate(); err != nil {
+		return nil, err
+	}
+
+	current := r.current.Load()
+	result := &ReloadResult{}
+	for _, path := range diffFields(reflect.ValueOf(*current), reflect.ValueOf(*loaded), "") {
+		if reloadable(path) {
+			result.Applied = append(result.Applied, path)
+		} else {
+			result.RestartRequired = append(result.RestartRequired, path)
+		}
+	}
+	if len(result.Applied) == 0 {
+		return result, nil
+	}
+
+	next := *current
+	for _, path := range Reloadable {
+		fieldByPath(reflect.ValueOf(&next).Elem(), path).Set(fieldByPath(reflect.ValueOf(loaded).Elem(), path))
+	}
+	r.current.Store(&next)
+	for _, apply := range r.apply {
+		apply(&next)
+	}
+	return result, nil
+}
+
+// Watch reloads on each of signals and, if interval is positive, whenever a
+// config file's modification time or size changes, until ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, signals ...os.Signal) {
+	sigCh := make(chan os.Signal, 1)
+	if len(signals) > 0 {
+		signal.Notify(sigCh, signals...)
+		defer signal.Stop(sigCh)
+	}
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigCh:
+			slog.Info("Reloading configuration", "signal", sig.String())
+		case <-tick:
+			next := r.fileStamp()
+			if next == r.stamp {
+				continue
+			}
+			r.stamp = next
+			slog.Info("Configuration files changed, reloading")
+		}
+		r.logReload(r.Reload())
+	}
+}
+
+// fileStamp summarises the modification times and sizes of the config files.
+func (r *Reloader) fileStamp() string {
+	var b strings.Builder
+	for _, name := range configFiles {
+		if info, err := os.Stat(filepath.Join(r.dir, name)); err == nil {
+			fmt.Fprintf(&b, "%s:%d:%d;", name, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return b.String()
+}
+
+func (r *Reloader) logReload(result *ReloadResult, err error) {
+	if err != nil {
+		slog.Error("Configuration reload rejected, keeping the current config", "error", err)
+		return
+	}
+	if len(result.Applied) > 0 {
+		slog.Info("Configuration reloaded", "applied", result.Applied)
+	}
+	if len(result.RestartRequired) > 0 {
+		slog.Warn("Configuration changes need a restart to take effect", "restart_required", result.RestartRequired)
+	}
+	if len(result.Applied) == 0 && len(result.RestartRequired) == 0 {
+		slog.Info("Configuration reloaded, nothing changed")
+	}
+}
+
+func reloadable(path string) bool {
+	return slices.ContainsFunc(Reloadable, func(prefix string) bool {
+		return path == prefix || strings.HasPrefix(path, prefix+".")
+	})
+}
+
+// diffFields returns the YAML paths of the leaf fields that differ between
+// the structs a and b.
+func diffFields(a, b reflect.Value, prefix string) []string {
+	var paths []string
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := yamlName(t.Field(i))
+		if !ok {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		if t.Field(i).Type.Kind() == reflect.Struct {
+			paths = append(paths, diffFields(a.Field(i), b.Field(i), path)...)
+		} else if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// fieldByPath returns the field of struct v at the dotted YAML path.
+func fieldByPath(v reflect.Value, path string) reflect.Value {
+	for _, name := range strings.Split(path, ".") {
+		t, index := v.Type(), -1
+		for i := 0; i < t.NumField(); i++ {
+			if fieldName, ok := yamlName(t.Field(i)); ok && fieldName == name {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			panic("config: unknown field " + path)
+		}
+		v = v.Field(index)
+	}
+	return v
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// copyRepoConfig copies the configs directory shipped with the repository
+// into a temporary directory a test can edit.
+func copyRepoConfig(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range configFiles {
+		data, err := os.ReadFile(filepath.Join("../../configs", name))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+	}
+	return dir
+}
+
+func editConfigFile(t *testing.T, dir, name, old, new string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), old)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(data), old, new, 1)), 0o600))
+}
+
+func newTestReloader(t *testing.T, dir string) *Reloader {
+	t.Helper()
+	loadDir := func(dir string) (*Config, error) { return load(dir, envLookup(nil)) }
+	cfg, err := loadDir(dir)
+	require.NoError(t, err)
+	r := NewReloader(dir, cfg)
+	r.load = loadDir
+	return r
+}
+
+func TestReloadAppliesReloadableSettings(t *testing.T) {
+	dir := copyRepoConfig(t)
+	r := newTestReloader(t, dir)
+	var applied []*Config
+	r.OnReload(func(cfg *Config) { applied = append(applied, cfg) })
+
+	editConfigFile(t, dir, "constants.yaml", "default_page_size: 10", "default_page_size: 25")
+	editConfigFile(t, dir, "app.yaml", `allowed_origins: ["*"]`, `allowed_origins: ["https://shop.example"]`)
+	editConfigFile(t, dir, "database.yaml", `driver: "sqlite"`, `driver: "postgres"`+"\npostgres:\n  host: db\n  port: 5432\n  user: app\n  dbname: market\n  sslmode: disable\n")
+
+	result, err := r.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app.cors.allowed_origins", "constants.pagination.default_page_size"}, result.Applied)
+	assert.Contains(t, result.RestartRequired, "database.driver")
+
+	current := r.Current()
+	require.Len(t, applied, 1)
+	assert.Same(t, current, applied[0])
+	assert.Equal(t, 25, current.Constants.Pagination.DefaultPageSize)
+	assert.Equal(t, []string{"https://shop.example"}, current.App.CORS.AllowedOrigins)
+	assert.Equal(t, "sqlite", current.Database.Driver, "settings that need a restart are not applied")
+}
+
+func TestReloadWithoutReloadableChanges(t *testing.T) {
+	dir := copyRepoConfig(t)
+	r := newTestReloader(t, dir)
+	before := r.Current()
+	r.OnReload(func(*Config) { t.Error("OnReload called without a reloadable change") })
+
+	result, err := r.Reload()
+	require.NoError(t, err)
+	assert.Empty(t, result.Applied)
+	assert.Empty(t, result.RestartRequired)
+
+	editConfigFile(t, dir, "app.yaml", "port: 8080", "port: 9090")
+	result, err = r.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app.server.port"}, result.RestartRequired)
+	assert.Same(t, before, r.Current())
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	dir := copyRepoConfig(t)
+	r := newTestReloader(t, dir)
+	before := r.Current()
+
+	editConfigFile(t, dir, "constants.yaml", "default_page_size: 10", "default_page_size: 25")
+	editConfigFile(t, dir, "constants.yaml", "max_page_size: 100", "max_page_size: 20")
+	_, err := r.Reload()
+	assert.Equal(t, []string{"constants.pagination.max_page_size"}, problemFields(err))
+	assert.Same(t, before, r.Current())
+
+	editConfigFile(t, dir, "constants.yaml", "max_page_size: 20", "max_page_size: [")
+	_, err = r.Reload()
+	assert.Error(t, err)
+	assert.Same(t, before, r.Current())
+}
+
+func TestWatchReloadsChangedFiles(t *testing.T) {
+	dir := copyRepoConfig(t)
+	r := newTestReloader(t, dir)
+	reloaded := make(chan *Config, 1)
+	r.OnReload(func(cfg *Config) { reloaded <- cfg })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+
+	// The size changes too, so the edit is seen even with coarse mtimes.
+	editConfigFile(t, dir, "constants.yaml", "default_page_size: 10", "default_page_size: 5")
+	select {
+	case cfg := <-reloaded:
+		assert.Equal(t, 5, cfg.Constants.Pagination.DefaultPageSize)
+	case <-time.After(5 * time.Second):
+		t.Fatal("config change was not picked up")
+	}
+}
+
+func TestDiffFields(t *testing.T) {
+	a, b := &Config{}, &Config{}
+	b.App.Server.Port = 1
+	b.Constants.RBAC.Roles = map[string][]string{"admin": {"*"}}
+
+	assert.Equal(t, []string{"app.server.port", "constants.rbac.roles"}, diffFields(reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem(), ""))
+	assert.Panics(t, func() { fieldByPath(reflect.ValueOf(a).Elem(), "app.nope") })
+}
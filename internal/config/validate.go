@@ -0,0 +1,306 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinJWTSecretLength is the shortest jwt_secret accepted in release mode.
+const MinJWTSecretLength = 32
+
+// weakJWTSecretMarkers appear in placeholder secrets, which are refused in
+// release mode whatever their length.
+var weakJWTSecretMarkers = []string{"strong-secret-key", "your-secret", "changeme", "change-me", "change_me", "example"}
+
+// weakJWTSecret reports whether secret looks like a placeholder or has too
+// few distinct characters to be random, e.g. 32 times "a".
+func weakJWTSecret(secret string) bool {
+	lower := strings.ToLower(secret)
+	for _, marker := range weakJWTSecretMarkers {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	distinct := map[rune]bool{}
+	for _, r := range secret {
+		distinct[r] = true
+	}
+	return len(distinct) < 8
+}
+
+// Problem is one invalid config field, identified by its YAML path.
+type Problem struct {
+	Field   string
+	Message string
+}
+
+func (p Problem) String() string {
+	return p.Field + ": " + p.Message
+}
+
+// ValidationError lists every problem found by Validate.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems)+1)
+	lines = append(lines, fmt.Sprintf("invalid configuration (%d problems):", len(e.Problems)))
+	for _, problem := range e.Problems {
+		lines = append(lines, "  "+problem.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+type validator struct {
+	problems []Problem
+}
+
+func (v *validator) add(field, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) oneOf(field, value string, allowed ...string) {
+	if !slices.Contains(allowed, value) {
+		v.add(field, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+	}
+}
+
+func (v *validator) atLeast(field string, value, min int) {
+	if value < min {
+		v.add(field, "must be at least %d, got %d", min, value)
+	}
+}
+
+func (v *validator) between(field string, value, min, max int) {
+	if value < min || value > max {
+		v.add(field, "must be between %d and %d, got %d", min, max, value)
+	}
+}
+
+func (v *validator) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, "is required")
+	}
+}
+
+// Validate checks c and returns a *ValidationError listing every problem, or
+// nil if there are none.
+func (c *Config) Validate() error {
+	v := &validator{}
+	c.validateApp(v)
+	c.validateDatabase(v)
+	c.validateConstants(v)
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+func (c *Config) validateApp(v *validator) {
+	server := c.App.Server
+	v.between("app.server.port", server.Port, 1, 65535)
+	v.oneOf("app.server.mode", server.Mode, "debug", "release", "test")
+	v.atLeast("app.server.timeout", server.Timeout, 0)
+
+	v.oneOf("app.logging.level", c.App.Logging.Level, "", "debug", "info", "warn", "error")
+	v.oneOf("app.logging.format", c.App.Logging.Format, "", "json", "text")
+	v.oneOf("app.logging.output", c.App.Logging.Output, "", "stdout", "stderr", "file")
+	if c.App.Logging.Output == "file" {
+		logFile := c.App.Logging.File
+		v.required("app.logging.file.path", logFile.Path)
+		v.atLeast("app.logging.file.max_size", logFile.MaxSize, 0)
+		v.atLeast("app.logging.file.max_backups", logFile.MaxBackups, 0)
+		v.atLeast("app.logging.file.max_age", logFile.MaxAge, 0)
+	}
+
+	if c.App.ConfigReload.Watch {
+		v.atLeast("app.config_reload.interval", c.App.ConfigReload.Interval, 1)
+	}
+	for i, origin := range c.App.CORS.AllowedOrigins {
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			v.add(fmt.Sprintf("app.cors.allowed_origins[%d]", i), "must be \"*\" or start with http:// or https://, got %q", origin)
+		}
+	}
+
+	metrics := c.App.Metrics
+	if metrics.Enabled {
+		if !strings.HasPrefix(metrics.Path, "/") {
+			v.add("app.metrics.path", "must start with /, got %q", metrics.Path)
+		}
+		v.between("app.metrics.admin_port", metrics.AdminPort, 0, 65535)
+		if metrics.AdminPort != 0 && metrics.AdminPort == server.Port {
+			v.add("app.metrics.admin_port", "must differ from app.server.port (%d)", server.Port)
+		}
+	}
+
+	tracing := c.App.Tracing
+	if tracing.Enabled {
+		v.oneOf("app.tracing.exporter", tracing.Exporter, "otlp", "stdout", "file")
+		if tracing.SampleRatio < 0 || tracing.SampleRatio > 1 {
+			v.add("app.tracing.sample_ratio", "must be between 0 and 1, got %g", tracing.SampleRatio)
+		}
+		if tracing.Exporter == "file" {
+			v.required("app.tracing.file_path", tracing.FilePath)
+		}
+		v.atLeast("app.tracing.otlp.timeout", tracing.OTLP.Timeout, 0)
+	}
+
+	v.atLeast("app.health.check_timeout", c.App.Health.CheckTimeout, 1)
+	v.atLeast("app.health.drain_delay", c.App.Health.DrainDelay, 0)
+	v.atLeast("app.idempotency.ttl", c.App.Idempotency.TTL, 1)
+	v.atLeast("app.idempotency.lock_timeout", c.App.Idempotency.LockTimeout, 1)
+
+	notifications := c.App.Notifications
+	v.oneOf("app.notifications.driver", notifications.Driver, "", "log", "file")
+	if notifications.Driver == "file" {
+		v.required("app.notifications.file_path", notifications.FilePath)
+	}
+}
+
+func (c *Config) validateDatabase(v *validator) {
+	db := c.Database
+	v.oneOf("database.driver", db.Driver, "sqlite", "postgres", "mysql")
+
+	switch db.Driver {
+	case "sqlite":
+		v.required("database.sqlite.path", db.SQLite.Path)
+	case "postgres":
+		v.required("database.postgres.host", db.Postgres.Host)
+		v.between("database.postgres.port", db.Postgres.Port, 1, 65535)
+		v.required("database.postgres.user", db.Postgres.User)
+		v.required("database.postgres.dbname", db.Postgres.DBName)
+		v.oneOf("database.postgres.sslmode", db.Postgres.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+		if db.Postgres.TimeZone != "" {
+			if _, err := time.LoadLocation(db.Postgres.TimeZone); err != nil {
+				v.add("database.postgres.timezone", "unknown time zone %q", db.Postgres.TimeZone)
+			}
+		}
+	case "mysql":
+		v.required("database.mysql.host", db.MySQL.Host)
+		v.between("database.mysql.port", db.MySQL.Port, 1, 65535)
+		v.required("database.mysql.user", db.MySQL.User)
+		v.required("database.mysql.dbname", db.MySQL.DBName)
+		if !db.MySQL.ParseTime {
+			v.add("database.mysql.parse_time", "must be true, timestamps are read into time.Time")
+		}
+		if db.MySQL.Loc != "" {
+			if _, err := time.LoadLocation(db.MySQL.Loc); err != nil {
+				v.add("database.mysql.loc", "unknown time zone %q", db.MySQL.Loc)
+			}
+		}
+		tls := db.MySQL.TLS
+		v.oneOf("database.mysql.tls.mode", tls.Mode, "", "false", "true", "skip-verify", "preferred")
+		if (tls.ClientCert == "") != (tls.ClientKey == "") {
+			v.add("database.mysql.tls", "client_cert and client_key must be set together")
+		}
+		if (tls.CACert != "" || tls.ClientCert != "" || tls.ServerName != "") && (tls.Mode == "false" || tls.Mode == "preferred") {
+			v.add("database.mysql.tls.mode", "%q cannot be combined with certificate options", tls.Mode)
+		}
+	}
+
+	v.atLeast("database.slow_query_threshold", db.SlowQueryThreshold, 0)
+
+	pool := db.ConnectionPool
+	v.atLeast("database.connection_pool.max_idle_conns", pool.MaxIdleConns, 0)
+	v.atLeast("database.connection_pool.max_open_conns", pool.MaxOpenConns, 1)
+	v.atLeast("database.connection_pool.conn_max_lifetime", pool.ConnMaxLifetime, 0)
+	if pool.MaxOpenConns > 0 && pool.MaxIdleConns > pool.MaxOpenConns {
+		v.add("database.connection_pool.max_idle_conns", "must not exceed max_open_conns (%d), got %d", pool.MaxOpenConns, pool.MaxIdleConns)
+	}
+}
+
+func (c *Config) validateConstants(v *validator) {
+	constants := c.Constants
+
+	v.atLeast("constants.pagination.default_page_size", constants.Pagination.DefaultPageSize, 1)
+	if constants.Pagination.MaxPageSize < constants.Pagination.DefaultPageSize {
+		v.add("constants.pagination.max_page_size", "must be at least default_page_size (%d), got %d", constants.Pagination.DefaultPageSize, constants.Pagination.MaxPageSize)
+	}
+
+	// bcrypt ignores everything after 72 bytes
+	v.between("constants.validation.min_password_length", constants.Validation.MinPasswordLength, 1, 72)
+	// users.name is a VARCHAR(100)
+	v.between("constants.validation.max_name_length", constants.Validation.MaxNameLength, 1, 100)
+	v.atLeast("constants.validation.max_description_length", constants.Validation.MaxDescriptionLength, 1)
+
+	v.atLeast("constants.business_rules.max_products_per_user", constants.BusinessRules.MaxProductsPerUser, 1)
+	v.oneOf("constants.business_rules.default_product_status", constants.BusinessRules.DefaultProductStatus, models.ProductStatuses...)
+
+	c.validateAuth(v)
+
+	roles := constants.RBAC.Roles
+	for _, name := range []models.Role{models.RoleAdmin, models.RoleUser} {
+		if _, ok := roles[string(name)]; !ok {
+			v.add("constants.rbac.roles", "must define the built-in role %q", name)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(roles)) {
+		for _, permission := range roles[name] {
+			if permission != models.PermissionAll && !slices.Contains(models.Permissions, permission) {
+				v.add("constants.rbac.roles."+name, "unknown permission %q", permission)
+			}
+		}
+	}
+}
+
+func (c *Config) validateAuth(v *validator) {
+	auth := c.Constants.Auth
+
+	if len(auth.Signing.Keys) == 0 {
+		secret := auth.JWTSecret
+		switch {
+		case secret == "":
+			v.add("constants.auth.jwt_secret", "is required unless signing keys are configured")
+		case c.App.Server.Mode == "release" && len(secret) < MinJWTSecretLength:
+			v.add("constants.auth.jwt_secret", "must be at least %d characters in release mode, got %d", MinJWTSecretLength, len(secret))
+		case c.App.Server.Mode == "release" && weakJWTSecret(secret):
+			v.add("constants.auth.jwt_secret", "looks like a placeholder and is refused in release mode")
+		}
+	} else {
+		kids := map[string]bool{}
+		for i, key := range auth.Signing.Keys {
+			field := fmt.Sprintf("constants.auth.signing.keys[%d]", i)
+			v.required(field+".kid", key.KID)
+			v.required(field+".path", key.Path)
+			if kids[key.KID] {
+				v.add(field+".kid", "duplicate kid %q", key.KID)
+			}
+			kids[key.KID] = true
+		}
+		if !kids[auth.Signing.ActiveKey] {
+			v.add("constants.auth.signing.active_key", "must be the kid of one of the keys, got %q", auth.Signing.ActiveKey)
+		}
+	}
+
+	v.atLeast("constants.auth.access_token_expiration", auth.AccessTokenExpiration, 1)
+	v.atLeast("constants.auth.refresh_token_expiration", auth.RefreshTokenExpiration, 1)
+	v.between("constants.auth.password_cost", auth.PasswordCost, bcrypt.MinCost, bcrypt.MaxCost)
+	v.atLeast("constants.auth.password_reset_expiration", auth.PasswordResetExpiration, 1)
+	v.atLeast("constants.auth.email_verification.token_expiration", auth.EmailVerification.TokenExpiration, 1)
+
+	v.required("constants.auth.mfa.issuer", auth.MFA.Issuer)
+	v.atLeast("constants.auth.mfa.challenge_expiration", auth.MFA.ChallengeExpiration, 1)
+	v.between("constants.auth.mfa.recovery_codes", auth.MFA.RecoveryCodes, 1, 100)
+
+	// A zero max_failures or max_failures_per_ip turns that lockout off.
+	lockout := auth.Lockout
+	v.atLeast("constants.auth.lockout.max_failures", lockout.MaxFailures, 0)
+	v.atLeast("constants.auth.lockout.max_failures_per_ip", lockout.MaxFailuresPerIP, 0)
+	if lockout.MaxFailures > 0 || lockout.MaxFailuresPerIP > 0 {
+		v.atLeast("constants.auth.lockout.duration", lockout.Duration, 1)
+	}
+	v.atLeast("constants.auth.lockout.delay_after", lockout.DelayAfter, 0)
+	v.atLeast("constants.auth.lockout.base_delay", lockout.BaseDelay, 0)
+	if lockout.MaxDelay < lockout.BaseDelay {
+		v.add("constants.auth.lockout.max_delay", "must be at least base_delay (%d), got %d", lockout.BaseDelay, lockout.MaxDelay)
+	}
+	v.atLeast("constants.auth.lockout.reset_after", lockout.ResetAfter, 0)
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadRepoConfig loads the configs directory shipped with the repository.
+func loadRepoConfig(t *testing.T, env map[string]string) *Config {
+	t.Helper()
+	cfg, err := load("../../configs", envLookup(env))
+	require.NoError(t, err)
+	return cfg
+}
+
+func problemFields(err error) []string {
+	var fields []string
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		for _, problem := range validationErr.Problems {
+			fields = append(fields, problem.Field)
+		}
+	}
+	return fields
+}
+
+func TestRepoConfigIsValid(t *testing.T) {
+	assert.NoError(t, loadRepoConfig(t, nil).Validate())
+}
+
+func TestLoadAppliesConnectionPoolDefaults(t *testing.T) {
+	pool := loadRepoConfig(t, nil).Database.ConnectionPool
+	assert.Equal(t, ConnectionPoolConfig{MaxIdleConns: 10, MaxOpenConns: 100, ConnMaxLifetime: 3600}, pool)
+
+	pool = loadRepoConfig(t, map[string]string{"MARKETPLACE_DATABASE_CONNECTION_POOL_MAX_OPEN_CONNS": "4"}).Database.ConnectionPool
+	assert.Equal(t, 4, pool.MaxOpenConns)
+	assert.Equal(t, 4, pool.MaxIdleConns, "idle connections are capped by open connections")
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := loadRepoConfig(t, nil)
+	cfg.App.Server.Port = 0
+	cfg.Database.ConnectionPool.MaxOpenConns = -1
+	cfg.Constants.Auth.JWTSecret = ""
+	cfg.Constants.Auth.PasswordCost = 2
+	cfg.Constants.BusinessRules.DefaultProductStatus = "archived"
+	cfg.Constants.RBAC.Roles["user"] = []string{"products:read", "products:destroy"}
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Equal(t, []string{
+		"app.server.port",
+		"database.connection_pool.max_open_conns",
+		"constants.business_rules.default_product_status",
+		"constants.auth.jwt_secret",
+		"constants.auth.password_cost",
+		"constants.rbac.roles.user",
+	}, problemFields(err))
+	assert.Contains(t, err.Error(), `constants.rbac.roles.user: unknown permission "products:destroy"`)
+	assert.True(t, strings.HasPrefix(err.Error(), "invalid configuration (6 problems):"))
+}
+
+func TestValidateJWTSecretInReleaseMode(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		valid  bool
+	}{
+		{name: "shipped placeholder", secret: "strong-secret-key"},
+		{name: "long placeholder", secret: "please-changeme-before-going-live-0123"},
+		{name: "low entropy", secret: strings.Repeat("ab", 20)},
+		{name: "random", secret: "q8Vd3kX0fL2mN7pR4tY6wZ1bC5gH9jK0", valid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadRepoConfig(t, map[string]string{
+				"MARKETPLACE_APP_SERVER_MODE":           "release",
+				"MARKETPLACE_CONSTANTS_AUTH_JWT_SECRET": tt.secret,
+			})
+			err := cfg.Validate()
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, []string{"constants.auth.jwt_secret"}, problemFields(err))
+			}
+		})
+	}
+
+	// Debug mode accepts the placeholder so the repo runs out of the box.
+	assert.NoError(t, loadRepoConfig(t, map[string]string{"MARKETPLACE_CONSTANTS_AUTH_JWT_SECRET": "short"}).Validate())
+}
+
+func TestValidateDriverSettings(t *testing.T) {
+	cfg := loadRepoConfig(t, map[string]string{
+		"MARKETPLACE_DATABASE_DRIVER":               "mysql",
+		"MARKETPLACE_DATABASE_MYSQL_HOST":           "localhost",
+		"MARKETPLACE_DATABASE_MYSQL_PORT":           "3306",
+		"MARKETPLACE_DATABASE_MYSQL_USER":           "app",
+		"MARKETPLACE_DATABASE_MYSQL_DBNAME":         "market",
+		"MARKETPLACE_DATABASE_MYSQL_LOC":            "Nowhere/City",
+		"MARKETPLACE_DATABASE_MYSQL_TLS_CLIENT_KEY": "client.key",
+	})
+	assert.Equal(t, []string{
+		"database.mysql.parse_time",
+		"database.mysql.loc",
+		"database.mysql.tls",
+	}, problemFields(cfg.Validate()))
+
+	cfg = loadRepoConfig(t, map[string]string{"MARKETPLACE_DATABASE_DRIVER": "postgres"})
+	assert.Equal(t, []string{
+		"database.postgres.host",
+		"database.postgres.port",
+		"database.postgres.user",
+		"database.postgres.dbname",
+		"database.postgres.sslmode",
+	}, problemFields(cfg.Validate()))
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLDSNEscaping(t *testing.T) {
+	db := NewMySQLDB(&config.DatabaseConfig{MySQL: config.MySQLConfig{
+		Host:      "db.internal",
+		Port:      3306,
+		User:      "app",
+		Password:  "p@ss:w/rd?&x=1",
+		DBName:    "market",
+		Charset:   "utf8mb4",
+		ParseTime: true,
+		Loc:       "Africa/Nairobi",
+	}})
+
+	parsed, err := mysqldriver.ParseDSN(db.GetDSN())
+	require.NoError(t, err)
+	assert.Equal(t, "p@ss:w/rd?&x=1", parsed.Passwd)
+	assert.Equal(t, "app", parsed.User)
+	assert.Equal(t, "db.internal:3306", parsed.Addr)
+	assert.Equal(t, "market", parsed.DBName)
+	assert.True(t, parsed.ParseTime)
+	assert.Equal(t, "Africa/Nairobi", parsed.Loc.String())
+	assert.Equal(t, "utf8mb4", parsed.Params["charset"])
+	assert.Empty(t, parsed.TLSConfig)
+}
+
+func TestMySQLTLSModes(t *testing.T) {
+	tests := []struct {
+		name    string
+		tls     config.MySQLTLSConfig
+		want    string
+		wantErr bool
+	}{
+		{name: "default", want: ""},
+		{name: "disabled", tls: config.MySQLTLSConfig{Mode: "false"}, want: ""},
+		{name: "verify", tls: config.MySQLTLSConfig{Mode: "true"}, want: "true"},
+		{name: "preferred", tls: config.MySQLTLSConfig{Mode: "preferred"}, want: "preferred"},
+		{name: "custom CA", tls: config.MySQLTLSConfig{CACert: "ca.pem"}, want: mysqlTLSConfigName},
+		{name: "custom CA without verification", tls: config.MySQLTLSConfig{Mode: "skip-verify", CACert: "ca.pem"}, want: mysqlTLSConfigName},
+		{name: "certificates with TLS off", tls: config.MySQLTLSConfig{Mode: "false", CACert: "ca.pem"}, wantErr: true},
+		{name: "unknown mode", tls: config.MySQLTLSConfig{Mode: "required"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := NewMySQLDB(&config.DatabaseConfig{MySQL: config.MySQLConfig{Host: "localhost", Port: 3306, TLS: tt.tls}})
+			dsnConfig, err := db.dsnConfig()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, dsnConfig.TLSConfig)
+		})
+	}
+}
+
+func TestMySQLInvalidLocation(t *testing.T) {
+	db := NewMySQLDB(&config.DatabaseConfig{MySQL: config.MySQLConfig{Host: "localhost", Port: 3306, Loc: "Mars/Olympus"}})
+	_, err := db.Connect()
+	assert.ErrorContains(t, err, "invalid MySQL loc")
+}
+
+func TestPostgresDSNEscaping(t *testing.T) {
+	db := NewPostgresDB(&config.DatabaseConfig{Postgres: config.PostgresConfig{
+		Host:     "localhost",
+		Port:     5432,
+		User:     "app",
+		Password: `it's a \secret`,
+		DBName:   "market",
+		SSLMode:  "disable",
+		TimeZone: "UTC",
+	}})
+
+	parsed, err := pgconn.ParseConfig(db.GetDSN())
+	require.NoError(t, err)
+	assert.Equal(t, `it's a \secret`, parsed.Password)
+	assert.Equal(t, "app", parsed.User)
+	assert.Equal(t, "market", parsed.Database)
+	assert.Equal(t, uint16(5432), parsed.Port)
+}
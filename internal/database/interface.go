@@ -1,10 +1,14 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"time"
 
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/logging"
 
 	"gorm.io/gorm"
 )
@@ -12,6 +16,7 @@ import (
 type Database interface {
 	Connect() (*gorm.DB, error)
 	GetDSN() string
+	Ping(ctx context.Context) error
 	Close() error
 }
 
@@ -21,7 +26,7 @@ type Manager struct {
 }
 
 func NewManager(cfg *config.DatabaseConfig) (Database, error) {
-	log.Printf("Database config received: driver=%s", cfg.Driver)
+	slog.Info("Database config received", "driver", cfg.Driver)
 	var db Database
 
 	switch cfg.Driver {
@@ -31,10 +36,37 @@ func NewManager(cfg *config.DatabaseConfig) (Database, error) {
 		db = NewPostgresDB(cfg)
 	case "mysql":
 		db = NewMySQLDB(cfg)
-		log.Fatalf("MySQL support is not implemented yet")
 	default:
 		return nil, fmt.Errorf("unsupported database driver: %s", cfg.Driver)
 	}
 
 	return db, nil
 }
+
+// gormConfig sends GORM's logs, including slow query warnings, to slog,
+// tags the queries run for a request with its request ID and traces them.
+// Driver errors are translated, so unique violations surface as
+// gorm.ErrDuplicatedKey on every driver.
+func gormConfig(cfg *config.DatabaseConfig) *gorm.Config {
+	plugins := map[string]gorm.Plugin{}
+	for _, plugin := range []gorm.Plugin{requestIDComments{}, newQueryTracing(cfg.Driver)} {
+		plugins[plugin.Name()] = plugin
+	}
+	return &gorm.Config{
+		Logger:         logging.NewGormLogger(time.Duration(cfg.SlowQueryThreshold) * time.Millisecond),
+		Plugins:        plugins,
+		TranslateError: true,
+	}
+}
+
+// ping checks that db, which is nil before Connect, can reach the database.
+func ping(ctx context.Context, db *gorm.DB) error {
+	if db == nil {
+		return errors.New("database is not connected")
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
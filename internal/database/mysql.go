@@ -1,14 +1,27 @@
 package database
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
+// mysqlTLSConfigName is the name the custom TLS config is registered under
+// with the MySQL driver when certificates are configured.
+const mysqlTLSConfigName = "marketplace"
+
 type MySQLDB struct {
 	config *config.DatabaseConfig
 	db     *gorm.DB
@@ -19,7 +32,17 @@ func NewMySQLDB(cfg *config.DatabaseConfig) *MySQLDB {
 }
 
 func (m *MySQLDB) Connect() (*gorm.DB, error) {
-	db, err := gorm.Open(mysql.Open(m.GetDSN()), &gorm.Config{})
+	dsnConfig, err := m.dsnConfig()
+	if err != nil {
+		return nil, err
+	}
+	if dsnConfig.TLSConfig == mysqlTLSConfigName {
+		if err := m.registerTLS(); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := gorm.Open(mysql.New(mysql.Config{DSNConfig: dsnConfig}), gormConfig(m.config))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to MySQL: %w", err)
 	}
@@ -38,18 +61,97 @@ func (m *MySQLDB) Connect() (*gorm.DB, error) {
 	return db, nil
 }
 
+// GetDSN formats the configured connection with the driver's own encoder, so
+// credentials and names containing ':', '@', '/' or '?' survive intact. Bad
+// loc or TLS settings are rejected by config validation; if one gets this far
+// it is logged instead of silently leaving its option out of the DSN.
 func (m *MySQLDB) GetDSN() string {
+	dsnConfig, err := m.dsnConfig()
+	if err != nil {
+		slog.Error("Invalid MySQL connection settings", "error", err)
+	}
+	return dsnConfig.FormatDSN()
+}
+
+func (m *MySQLDB) dsnConfig() (*mysqldriver.Config, error) {
 	cfg := m.config.MySQL
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=%t&loc=%s",
-		cfg.User,
-		cfg.Password,
-		cfg.Host,
-		cfg.Port,
-		cfg.DBName,
-		cfg.Charset,
-		cfg.ParseTime,
-		cfg.Loc,
-	)
+
+	dsnConfig := mysqldriver.NewConfig()
+	dsnConfig.User = cfg.User
+	dsnConfig.Passwd = cfg.Password
+	dsnConfig.Net = "tcp"
+	dsnConfig.Addr = net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	dsnConfig.DBName = cfg.DBName
+	dsnConfig.ParseTime = cfg.ParseTime
+	if cfg.Charset != "" {
+		dsnConfig.Params = map[string]string{"charset": cfg.Charset}
+	}
+
+	if cfg.Loc != "" {
+		loc, err := time.LoadLocation(cfg.Loc)
+		if err != nil {
+			return dsnConfig, fmt.Errorf("invalid MySQL loc %q: %w", cfg.Loc, err)
+		}
+		dsnConfig.Loc = loc
+	}
+
+	switch mode := cfg.TLS.Mode; {
+	case cfg.TLS.CACert != "" || cfg.TLS.ClientCert != "" || cfg.TLS.ClientKey != "" || cfg.TLS.ServerName != "":
+		if mode == "false" || mode == "preferred" {
+			return dsnConfig, fmt.Errorf("MySQL TLS mode %q cannot be combined with certificate options", mode)
+		}
+		dsnConfig.TLSConfig = mysqlTLSConfigName
+	case mode == "" || mode == "false":
+	case mode == "true" || mode == "skip-verify" || mode == "preferred":
+		dsnConfig.TLSConfig = mode
+	default:
+		return dsnConfig, fmt.Errorf("invalid MySQL TLS mode %q", mode)
+	}
+
+	return dsnConfig, nil
+}
+
+// registerTLS builds a TLS config from the configured certificates and
+// registers it with the driver under mysqlTLSConfigName.
+func (m *MySQLDB) registerTLS() error {
+	cfg := m.config.MySQL.TLS
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.Mode == "skip-verify",
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = m.config.MySQL.Host
+	}
+
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return fmt.Errorf("failed to read MySQL CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", cfg.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCert != "" || cfg.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return fmt.Errorf("failed to load MySQL client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if err := mysqldriver.RegisterTLSConfig(mysqlTLSConfigName, tlsConfig); err != nil {
+		return fmt.Errorf("failed to register MySQL TLS config: %w", err)
+	}
+	return nil
+}
+
+func (m *MySQLDB) Ping(ctx context.Context) error {
+	return ping(ctx, m.db)
 }
 
 func (m *MySQLDB) Close() error {
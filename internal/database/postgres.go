@@ -1,7 +1,9 @@
 package database
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
@@ -20,7 +22,7 @@ func NewPostgresDB(cfg *config.DatabaseConfig) *PostgresDB {
 }
 
 func (p *PostgresDB) Connect() (*gorm.DB, error) {
-	db, err := gorm.Open(postgres.Open(p.GetDSN()), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(p.GetDSN()), gormConfig(p.config))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
 	}
@@ -42,7 +44,21 @@ func (p *PostgresDB) Connect() (*gorm.DB, error) {
 func (p *PostgresDB) GetDSN() string {
 	cfg := p.config.Postgres
 	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
-		cfg.Host, cfg.User, cfg.Password, cfg.DBName, cfg.Port, cfg.SSLMode, cfg.TimeZone)
+		quoteDSNValue(cfg.Host), quoteDSNValue(cfg.User), quoteDSNValue(cfg.Password), quoteDSNValue(cfg.DBName),
+		cfg.Port, quoteDSNValue(cfg.SSLMode), quoteDSNValue(cfg.TimeZone))
+}
+
+// quoteDSNValue quotes a value for a libpq keyword/value connection string
+// when it is empty or contains spaces, quotes or backslashes.
+func quoteDSNValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " '\\\t\n") {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+func (p *PostgresDB) Ping(ctx context.Context) error {
+	return ping(ctx, p.db)
 }
 
 func (p *PostgresDB) Close() error {
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/requestid"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// requestIDComments is a GORM plugin tagging every query run with a request
+// ID in its context with a comment like "/* request_id=abc */", so the query
+// can be traced back to the request in the database's logs.
+type requestIDComments struct{}
+
+func (requestIDComments) Name() string {
+	return "marketplace:request_id_comments"
+}
+
+func (requestIDComments) Initialize(db *gorm.DB) error {
+	const name = "marketplace:request_id"
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Query().Before("gorm:query").Register(name, commentClause("SELECT")),
+		callbacks.Create().Before("gorm:create").Register(name, commentClause("INSERT")),
+		callbacks.Update().Before("gorm:update").Register(name, commentClause("UPDATE")),
+		callbacks.Delete().Before("gorm:delete").Register(name, commentClause("DELETE")),
+		callbacks.Row().Before("gorm:row").Register(name, commentClause("SELECT")),
+		callbacks.Raw().Before("gorm:raw").Register(name, commentClause("")),
+	)
+}
+
+// commentClause returns a callback adding the comment in front of the named
+// clause, or in front of SQL given with Raw or Exec. INSERT gets it after the
+// keyword instead, as SQLite builds that clause itself.
+func commentClause(name string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		stmt := db.Statement
+		id := requestid.FromContext(stmt.Context)
+		// Valid IDs cannot contain "*/", but check anyway as this is SQL.
+		if id == "" || !requestid.Valid(id) {
+			return
+		}
+		comment := "/* request_id=" + id + " */"
+
+		switch {
+		case stmt.SQL.Len() > 0:
+			sql := stmt.SQL.String()
+			stmt.SQL.Reset()
+			stmt.SQL.WriteString(comment + " " + sql)
+		case name == "INSERT":
+			c := stmt.Clauses[name]
+			insert, _ := c.Expression.(clause.Insert)
+			if !strings.Contains(insert.Modifier, comment) {
+				insert.Modifier = strings.TrimSpace(comment + " " + insert.Modifier)
+			}
+			c.Name, c.Expression = name, insert
+			stmt.Clauses[name] = c
+		case name != "":
+			c := stmt.Clauses[name]
+			c.BeforeExpression = clause.Expr{SQL: comment}
+			stmt.Clauses[name] = c
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/logging"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/requestid"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type widget struct {
+	ID   uint
+	Name string
+}
+
+// loggedSQL returns the SQL of the queries logged at debug level to buf.
+func loggedSQL(t *testing.T, buf *bytes.Buffer) []string {
+	t.Helper()
+	var statements []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record struct {
+			SQL string `json:"sql"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		statements = append(statements, record.SQL)
+	}
+	buf.Reset()
+	return statements
+}
+
+func TestQueriesAreTaggedWithRequestID(t *testing.T) {
+	db, err := NewSQLiteDB(&config.DatabaseConfig{SQLite: config.SQLiteConfig{Path: ":memory:"}}).Connect()
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&widget{}))
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	ctx := logging.WithLogger(requestid.NewContext(context.Background(), "req-1"), logger)
+	tx := db.WithContext(ctx)
+
+	w := widget{Name: "a"}
+	require.NoError(t, tx.Create(&w).Error)
+	require.NoError(t, tx.Model(&w).Update("name", "b").Error)
+	var found widget
+	require.NoError(t, tx.First(&found, w.ID).Error)
+	var count int64
+	require.NoError(t, tx.Raw("SELECT COUNT(*) FROM widgets").Scan(&count).Error)
+	require.NoError(t, tx.Exec("UPDATE widgets SET name = ?", "c").Error)
+	require.NoError(t, tx.Delete(&found).Error)
+
+	statements := loggedSQL(t, &buf)
+	require.Len(t, statements, 6)
+	assert.True(t, strings.HasPrefix(statements[0], "INSERT /* request_id=req-1 */ INTO"), statements[0])
+	for _, sql := range statements[1:] {
+		assert.True(t, strings.HasPrefix(sql, "/* request_id=req-1 */ "), sql)
+	}
+	assert.Equal(t, "b", found.Name)
+	assert.EqualValues(t, 1, count)
+
+	// Queries outside a request are left alone
+	require.NoError(t, db.WithContext(logging.WithLogger(context.Background(), logger)).Find(&[]widget{}).Error)
+	assert.NotContains(t, loggedSQL(t, &buf)[0], "request_id")
+}
@@ -1,7 +1,9 @@
 package database
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
@@ -20,7 +22,7 @@ func NewSQLiteDB(cfg *config.DatabaseConfig) *SQLiteDB {
 }
 
 func (s *SQLiteDB) Connect() (*gorm.DB, error) {
-	db, err := gorm.Open(sqlite.Open(s.GetDSN()), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(s.GetDSN()), gormConfig(s.config))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to SQLite: %w", err)
 	}
@@ -35,6 +37,14 @@ func (s *SQLiteDB) Connect() (*gorm.DB, error) {
 	sqlDB.SetMaxOpenConns(s.config.ConnectionPool.MaxOpenConns)
 	sqlDB.SetConnMaxLifetime(time.Duration(s.config.ConnectionPool.ConnMaxLifetime) * time.Second)
 
+	// Every connection to ":memory:" opens its own empty database, so keep
+	// exactly one connection open for the lifetime of the pool.
+	if s.isMemory() {
+		sqlDB.SetMaxIdleConns(1)
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+	}
+
 	s.db = db
 	return db, nil
 }
@@ -43,6 +53,15 @@ func (s *SQLiteDB) GetDSN() string {
 	return s.config.SQLite.Path
 }
 
+func (s *SQLiteDB) isMemory() bool {
+	path := s.config.SQLite.Path
+	return path == ":memory:" || strings.HasPrefix(path, "file::memory:")
+}
+
+func (s *SQLiteDB) Ping(ctx context.Context) error {
+	return ping(ctx, s.db)
+}
+
 func (s *SQLiteDB) Close() error {
 	if s.db != nil {
 		sqlDB, err := s.db.DB()
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// spanKey stores a statement's span between the tracing callbacks.
+const spanKey = "marketplace:span"
+
+// queryTracing is a GORM plugin running every query in a span named after
+// the operation, e.g. "gorm.Query", with the SQL as an attribute. Queries
+// started from a service method are children of its span.
+type queryTracing struct {
+	system string // db.system, e.g. "postgresql"
+}
+
+func newQueryTracing(driver string) queryTracing {
+	if driver == "postgres" {
+		return queryTracing{system: "postgresql"}
+	}
+	return queryTracing{system: driver}
+}
+
+func (queryTracing) Name() string {
+	return "marketplace:tracing"
+}
+
+func (p queryTracing) Initialize(db *gorm.DB) error {
+	const start, end = "marketplace:tracing_start", "marketplace:tracing_end"
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("*").Register(start, p.start("gorm.Create")),
+		callbacks.Create().After("*").Register(end, p.end),
+		callbacks.Query().Before("*").Register(start, p.start("gorm.Query")),
+		callbacks.Query().After("*").Register(end, p.end),
+		callbacks.Update().Before("*").Register(start, p.start("gorm.Update")),
+		callbacks.Update().After("*").Register(end, p.end),
+		callbacks.Delete().Before("*").Register(start, p.start("gorm.Delete")),
+		callbacks.Delete().After("*").Register(end, p.end),
+		callbacks.Row().Before("*").Register(start, p.start("gorm.Row")),
+		callbacks.Row().After("*").Register(end, p.end),
+		callbacks.Raw().Before("*").Register(start, p.start("gorm.Raw")),
+		callbacks.Raw().After("*").Register(end, p.end),
+	)
+}
+
+func (p queryTracing) start(name string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx, span := tracing.Start(db.Statement.Context, name, trace.WithSpanKind(trace.SpanKindClient))
+		db.Statement.Context = ctx
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+func (p queryTracing) end(db *gorm.DB) {
+	value, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+	if !span.IsRecording() {
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("db.system", p.system),
+		attribute.String("db.statement", db.Statement.SQL.String()),
+		attribute.String("db.sql.table", db.Statement.Table),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+	if err := db.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
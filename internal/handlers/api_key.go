@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/problem"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHandler struct {
+	service *services.APIKeyService
+}
+
+func NewAPIKeyHandler(service *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{service: service}
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type CreateAPIKeyResponse struct {
+	*models.APIKey
+	Key string `json:"key"` // Only returned once
+}
+
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.BindError(c, err)
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		problem.Error(c, services.NewValidationError("request has invalid fields", services.FieldError{
+			Field:   "expires_at",
+			Code:    "future",
+			Message: "must be in the future",
+		}))
+		return
+	}
+
+	key, rawKey, err := h.service.CreateKey(c.Request.Context(), c.GetUint("userID"), req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateAPIKeyResponse{APIKey: key, Key: rawKey})
+}
+
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.service.ListKeys(c.Request.Context(), c.GetUint("userID"))
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": keys})
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		problem.Abort(c, http.StatusBadRequest, "invalid_id", "invalid API key ID")
+		return
+	}
+
+	if err := h.service.RevokeKey(c.Request.Context(), c.GetUint("userID"), uint(id)); err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
+
+func (h *APIKeyHandler) RegisterRoutes(router *gin.RouterGroup) {
+	keys := router.Group("/api-keys")
+	{
+		keys.POST("", h.CreateAPIKey)
+		keys.GET("", h.ListAPIKeys)
+		keys.DELETE("/:id", h.RevokeAPIKey)
+	}
+}
@@ -1,26 +1,46 @@
 package handlers
 
 import (
+    "errors"
+    "io"
+    "math"
     "net/http"
+    "strconv"
+    "time"
 
     "github.com/gin-gonic/gin"
+    "github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+    "github.com/MikeTeddyOmondi/marketplace-api/internal/logging"
+    "github.com/MikeTeddyOmondi/marketplace-api/internal/metrics"
     "github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+    "github.com/MikeTeddyOmondi/marketplace-api/internal/problem"
     "github.com/MikeTeddyOmondi/marketplace-api/internal/services"
 )
 
 type AuthHandler struct {
-    userService *services.UserService
-    authService *services.AuthService
+    userService         *services.UserService
+    authService         *services.AuthService
+    verificationService *services.EmailVerificationService
+    loginGuard          *services.LoginGuard
+    constants           *config.Constants
 }
 
-func NewAuthHandler(userService *services.UserService, authService *services.AuthService) *AuthHandler {
-    return &AuthHandler{userService: userService, authService: authService}
+func NewAuthHandler(userService *services.UserService, authService *services.AuthService, verificationService *services.EmailVerificationService, loginGuard *services.LoginGuard, constants *config.Constants) *AuthHandler {
+    return &AuthHandler{
+        userService:         userService,
+        authService:         authService,
+        verificationService: verificationService,
+        loginGuard:          loginGuard,
+        constants:           constants,
+    }
 }
 
+// RegisterRequest is the body of /register, and of POST /users for admins
+// creating an account.
 type RegisterRequest struct {
-    Name     string `json:"name" binding:"required"`
-    Email    string `json:"email" binding:"required,email"`
-    Password string `json:"password" binding:"required,min=8"`
+    Name     string `json:"name" binding:"required,name_length"`
+    Email    string `json:"email" binding:"required,email,max=100"`
+    Password string `json:"password" binding:"required,password_length"`
 }
 
 type LoginRequest struct {
@@ -28,15 +48,23 @@ type LoginRequest struct {
     Password string `json:"password" binding:"required"`
 }
 
+type RefreshRequest struct {
+    RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+    RefreshToken string `json:"refresh_token"`
+}
+
 func (h *AuthHandler) Register(c *gin.Context) {
     var req RegisterRequest
     if err := c.ShouldBindJSON(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        problem.BindError(c, err)
         return
     }
     hash, err := h.authService.HashPassword(req.Password)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+        problem.Error(c, err)
         return
     }
     user := &models.User{
@@ -46,32 +74,150 @@ func (h *AuthHandler) Register(c *gin.Context) {
         Role:     models.RoleUser,
     }
     if err := h.userService.CreateUser(c.Request.Context(), user); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        problem.Error(c, err)
         return
     }
-    c.JSON(http.StatusCreated, gin.H{"message": "user registered successfully"})
+    metrics.Registrations.Inc()
+    // The account exists even if the mail fails; the user can ask for a resend.
+    if err := h.verificationService.SendVerification(c.Request.Context(), user); err != nil {
+        logging.FromContext(c.Request.Context()).Error("Failed to send verification email", "user_id", user.ID, "error", err)
+    }
+    c.JSON(http.StatusCreated, gin.H{"message": "user registered successfully, check your email to verify your account"})
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
     var req LoginRequest
     if err := c.ShouldBindJSON(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        problem.BindError(c, err)
+        return
+    }
+    ctx := c.Request.Context()
+    ip := c.ClientIP()
+    retryAfter, err := h.loginGuard.Check(ctx, req.Email, ip)
+    if err != nil {
+        problem.Error(c, err)
+        return
+    }
+    if retryAfter > 0 {
+        abortTooManyAttempts(c, retryAfter)
+        return
+    }
+    // Unknown emails and wrong passwords look the same, including in timing.
+    user, err := h.userService.GetUserByEmail(ctx, req.Email)
+    if err != nil {
+        user = nil
+    }
+    if !h.authService.VerifyPassword(user, req.Password) {
+        metrics.Logins.WithLabelValues("failure").Inc()
+        if err := h.loginGuard.RecordFailure(ctx, req.Email, ip); err != nil {
+            logging.FromContext(ctx).Error("Failed to record login failure", "error", err)
+        }
+        problem.Abort(c, http.StatusUnauthorized, "invalid_credentials", "invalid credentials")
+        return
+    }
+    // With MFA the failures are only cleared once the second factor passes,
+    // so repeating the password step cannot reset the count of wrong codes.
+    if !user.MFAEnabled() {
+        if err := h.loginGuard.RecordSuccess(ctx, req.Email); err != nil {
+            logging.FromContext(ctx).Error("Failed to reset login failures", "user_id", user.ID, "error", err)
+        }
+    }
+    if h.constants.Auth.EmailVerification.RequiredForLogin && !user.IsVerified() {
+        metrics.Logins.WithLabelValues("failure").Inc()
+        problem.Error(c, services.ErrEmailNotVerified)
+        return
+    }
+    // With MFA the login is counted once the second factor is verified.
+    if user.MFAEnabled() {
+        challenge, err := h.authService.GenerateMFAChallenge(user)
+        if err != nil {
+            problem.Error(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": challenge})
+        return
+    }
+    tokens, err := h.authService.IssueTokens(ctx, user, []string{services.AMRPassword})
+    if err != nil {
+        problem.Error(c, err)
         return
     }
-    user, err := h.userService.GetUserByEmail(c.Request.Context(), req.Email)
-    if err != nil || !h.authService.CheckPasswordHash(req.Password, user.Password) {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+    metrics.Logins.WithLabelValues("success").Inc()
+    c.JSON(http.StatusOK, tokenResponse(tokens))
+}
+
+// abortTooManyAttempts answers a login step made while the LoginGuard still
+// asks the client to wait.
+func abortTooManyAttempts(c *gin.Context, retryAfter time.Duration) {
+    metrics.Logins.WithLabelValues("failure").Inc()
+    setRetryAfter(c, retryAfter)
+    problem.Abort(c, http.StatusTooManyRequests, "too_many_attempts", "too many login attempts, try again later")
+}
+
+// setRetryAfter tells the client how many whole seconds to wait.
+func setRetryAfter(c *gin.Context, retryAfter time.Duration) {
+    c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+}
+
+func (h *AuthHandler) Refresh(c *gin.Context) {
+    var req RefreshRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        problem.BindError(c, err)
         return
     }
-    token, err := h.authService.GenerateToken(user)
+    tokens, err := h.authService.RefreshTokens(c.Request.Context(), req.RefreshToken)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+        // Reuse is reported like any invalid token
+        if errors.Is(err, services.ErrRefreshTokenReused) {
+            err = services.ErrInvalidRefreshToken
+        }
+        problem.Error(c, err)
         return
     }
-    c.JSON(http.StatusOK, gin.H{"token": token})
+    c.JSON(http.StatusOK, tokenResponse(tokens))
 }
 
-func (h *AuthHandler) RegisterRoutes(router *gin.RouterGroup) {
+func (h *AuthHandler) Logout(c *gin.Context) {
+    var req LogoutRequest
+    // The body is optional: without a refresh token only the access token is revoked.
+    if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+        problem.BindError(c, err)
+        return
+    }
+    value, _ := c.Get("claims")
+    claims, ok := value.(*services.Claims)
+    if !ok {
+        problem.Abort(c, http.StatusUnauthorized, "invalid_token", "invalid token")
+        return
+    }
+    if err := h.authService.Logout(c.Request.Context(), claims, req.RefreshToken); err != nil {
+        problem.Error(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "logged out successfully"})
+}
+
+func (h *AuthHandler) JWKS(c *gin.Context) {
+    c.Header("Cache-Control", "public, max-age=300")
+    c.JSON(http.StatusOK, h.authService.JWKS())
+}
+
+func tokenResponse(tokens *services.TokenPair) gin.H {
+    return gin.H{
+        "token":         tokens.AccessToken,
+        "refresh_token": tokens.RefreshToken,
+        "token_type":    "Bearer",
+        "expires_at":    tokens.ExpiresAt.Format(time.RFC3339),
+    }
+}
+
+func (h *AuthHandler) RegisterRoutes(router *gin.RouterGroup, authMiddleware gin.HandlerFunc) {
     router.POST("/register", h.Register)
     router.POST("/login", h.Login)
+    router.POST("/token/refresh", h.Refresh)
+    router.POST("/logout", authMiddleware, h.Logout)
+}
+
+func (h *AuthHandler) RegisterWellKnownRoutes(router gin.IRoutes) {
+    router.GET("/.well-known/jwks.json", h.JWKS)
 }
\ No newline at end of file
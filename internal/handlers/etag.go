@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/problem"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// productETag is the strong ETag of a product. It is built from the
+// product's own version only, so owners editing their profile do not make
+// If-Match fail on all of their products.
+func productETag(product *models.Product) string {
+	return fmt.Sprintf(`"%d-%d"`, product.ID, product.Version)
+}
+
+func userETag(user *models.User) string {
+	return fmt.Sprintf(`"%d-%d"`, user.ID, user.Version)
+}
+
+// notModified sets the ETag header to tag and, if the client's
+// If-None-Match already has it, responds 304 and reports true.
+func notModified(c *gin.Context, tag string) bool {
+	c.Header("ETag", tag)
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// If-None-Match compares weakly
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+			c.AbortWithStatus(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatch checks the If-Match header against tag, the ETag of the current
+// representation at version, and returns the version a conditional write
+// must apply to, or 0 if the client sent no If-Match. On a mismatch it
+// responds 412 and reports false.
+func ifMatch(c *gin.Context, tag string, version uint) (uint, bool) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return 0, true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// If-Match compares strongly, so weak tags never match
+		if candidate == "*" || candidate == tag {
+			return version, true
+		}
+	}
+	problem.Error(c, services.ErrVersionMismatch)
+	return 0, false
+}
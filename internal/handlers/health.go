@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/health"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+// Live reports that the process is up and serving requests. It checks no
+// dependencies, so an unreachable database doesn't get the server restarted.
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":    health.StatusOK,
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
+// Ready runs the readiness checks and responds 503 with the failing checks
+// if any fails or the server is shutting down.
+func (h *HealthHandler) Ready(c *gin.Context) {
+	report := h.checker.Ready(c.Request.Context())
+	status := http.StatusOK
+	if !report.OK() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{
+		"status":    report.Status,
+		"timestamp": time.Now().Format(time.RFC3339),
+		"checks":    report.Checks,
+	})
+}
+
+// RegisterRoutes serves /livez and /readyz, and /health as an alias of
+// /readyz for existing monitors.
+func (h *HealthHandler) RegisterRoutes(router gin.IRoutes) {
+	router.GET("/livez", h.Live)
+	router.GET("/readyz", h.Ready)
+	router.GET("/health", h.Ready)
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/logging"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/metrics"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/problem"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MFAHandler struct {
+	mfaService  *services.MFAService
+	authService *services.AuthService
+	loginGuard  *services.LoginGuard
+}
+
+func NewMFAHandler(mfaService *services.MFAService, authService *services.AuthService, loginGuard *services.LoginGuard) *MFAHandler {
+	return &MFAHandler{mfaService: mfaService, authService: authService, loginGuard: loginGuard}
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	enrollment, err := h.mfaService.Enroll(c.Request.Context(), c.GetUint("userID"))
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+func (h *MFAHandler) Confirm(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.BindError(c, err)
+		return
+	}
+
+	var codes []string
+	ok := h.checkCode(c, func(ctx context.Context, userID uint) (err error) {
+		codes, err = h.mfaService.Confirm(ctx, userID, req.Code)
+		return err
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (h *MFAHandler) Disable(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.BindError(c, err)
+		return
+	}
+
+	ok := h.checkCode(c, func(ctx context.Context, userID uint) error {
+		return h.mfaService.Disable(ctx, userID, req.Code)
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+}
+
+// checkCode runs verify, which checks a code sent by the signed-in user,
+// unless the user has sent too many wrong codes lately, and counts wrong
+// ones. It reports whether verify succeeded and has answered the request
+// otherwise. A stolen session therefore cannot be used to guess codes.
+func (h *MFAHandler) checkCode(c *gin.Context, verify func(ctx context.Context, userID uint) error) bool {
+	ctx := c.Request.Context()
+	userID := c.GetUint("userID")
+	retryAfter, err := h.loginGuard.CheckMFA(ctx, userID)
+	if err != nil {
+		problem.Error(c, err)
+		return false
+	}
+	if retryAfter > 0 {
+		setRetryAfter(c, retryAfter)
+		problem.Abort(c, http.StatusTooManyRequests, "too_many_attempts", "too many two-factor attempts, try again later")
+		return false
+	}
+
+	if err := verify(ctx, userID); err != nil {
+		if errors.Is(err, services.ErrInvalidMFACode) {
+			if err := h.loginGuard.RecordMFAFailure(ctx, userID); err != nil {
+				logging.FromContext(ctx).Error("Failed to record two-factor failure", "user_id", userID, "error", err)
+			}
+		}
+		problem.Error(c, err)
+		return false
+	}
+	if err := h.loginGuard.RecordMFASuccess(ctx, userID); err != nil {
+		logging.FromContext(ctx).Error("Failed to reset two-factor failures", "user_id", userID, "error", err)
+	}
+	return true
+}
+
+// Login exchanges the challenge token returned by /login plus a TOTP or
+// recovery code for a full session. Wrong codes count as failed logins for
+// the account.
+func (h *MFAHandler) Login(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.BindError(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	ip := c.ClientIP()
+	// A challenge allows a single guess; the password step must be repeated.
+	claims, err := h.authService.ConsumeMFAChallenge(ctx, req.MFAToken)
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+	// The challenge's subject is the email the password step was throttled on
+	email := claims.Subject
+	retryAfter, err := h.loginGuard.Check(ctx, email, ip)
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+	if retryAfter > 0 {
+		abortTooManyAttempts(c, retryAfter)
+		return
+	}
+
+	user, err := h.mfaService.VerifyLogin(ctx, claims.UserID, req.Code)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidMFACode) || errors.Is(err, services.ErrMFANotEnabled) {
+			metrics.Logins.WithLabelValues("failure").Inc()
+			if err := h.loginGuard.RecordFailure(ctx, email, ip); err != nil {
+				logging.FromContext(ctx).Error("Failed to record login failure", "error", err)
+			}
+			problem.Abort(c, http.StatusUnauthorized, services.ErrInvalidMFACode.Code, services.ErrInvalidMFACode.Error())
+			return
+		}
+		problem.Error(c, err)
+		return
+	}
+
+	if err := h.loginGuard.RecordSuccess(ctx, email); err != nil {
+		logging.FromContext(ctx).Error("Failed to reset login failures", "user_id", user.ID, "error", err)
+	}
+	tokens, err := h.authService.IssueTokens(ctx, user, []string{services.AMRPassword, services.AMROTP, services.AMRMFA})
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+	metrics.Logins.WithLabelValues("success").Inc()
+	c.JSON(http.StatusOK, tokenResponse(tokens))
+}
+
+func (h *MFAHandler) RegisterRoutes(router *gin.RouterGroup, authMiddleware gin.HandlerFunc) {
+	router.POST("/login/mfa", h.Login)
+
+	mfa := router.Group("/mfa/totp")
+	mfa.Use(authMiddleware)
+	{
+		mfa.POST("/enroll", h.Enroll)
+		mfa.POST("/confirm", h.Confirm)
+		mfa.POST("/disable", h.Disable)
+	}
+}
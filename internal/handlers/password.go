@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/problem"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PasswordHandler struct {
+	service *services.PasswordResetService
+}
+
+func NewPasswordHandler(service *services.PasswordResetService) *PasswordHandler {
+	return &PasswordHandler{service: service}
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,password_length"`
+}
+
+func (h *PasswordHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.BindError(c, err)
+		return
+	}
+
+	if err := h.service.RequestReset(c.Request.Context(), req.Email); err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	// Same response whether or not the account exists
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the account exists, a reset token has been sent"})
+}
+
+func (h *PasswordHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.BindError(c, err)
+		return
+	}
+
+	if err := h.service.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password reset successfully"})
+}
+
+func (h *PasswordHandler) RegisterRoutes(router *gin.RouterGroup) {
+	password := router.Group("/password")
+	{
+		password.POST("/forgot", h.ForgotPassword)
+		password.POST("/reset", h.ResetPassword)
+	}
+}
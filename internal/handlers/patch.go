@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/problem"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// MergePatchContentType is the media type of RFC 7396 JSON Merge Patch
+// bodies. PATCH also accepts plain application/json with the same meaning.
+const MergePatchContentType = "application/merge-patch+json"
+
+// bindMergePatch applies the merge patch in the request body to current, the
+// resource's writable fields, and stores the result in obj, which must be of
+// the same type. Members set to null in the patch are reset, and members obj
+// does not declare are rejected. The result is validated like a full body.
+func bindMergePatch(c *gin.Context, current, obj any) error {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	var patch any
+	if err := json.Unmarshal(body, &patch); err != nil {
+		if len(bytes.TrimSpace(body)) == 0 {
+			return io.EOF
+		}
+		return err
+	}
+	if _, ok := patch.(map[string]any); !ok {
+		return fmt.Errorf("merge patch must be a JSON object")
+	}
+
+	document, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	var target any
+	if err := json.Unmarshal(document, &target); err != nil {
+		return err
+	}
+	merged, err := json.Marshal(mergePatch(target, patch))
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(obj); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// mergePatch implements the MergePatch algorithm of RFC 7396.
+func mergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
+
+// requirePatchContentType rejects PATCH bodies that are neither a merge
+// patch nor plain JSON, and reports whether the request may go on.
+func requirePatchContentType(c *gin.Context) bool {
+	switch c.ContentType() {
+	case MergePatchContentType, binding.MIMEJSON:
+		return true
+	}
+	c.Header("Accept-Patch", MergePatchContentType)
+	problem.Abort(c, http.StatusUnsupportedMediaType, "unsupported_media_type",
+		fmt.Sprintf("PATCH bodies must be %s or %s", MergePatchContentType, binding.MIMEJSON))
+	return false
+}
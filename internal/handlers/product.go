@@ -5,6 +5,8 @@ import (
 	"strconv"
 
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/policy"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/problem"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -18,18 +20,74 @@ func NewProductHandler(service *services.ProductService) *ProductHandler {
 	return &ProductHandler{service: service}
 }
 
+// CreateProductRequest is the body of POST /products. The caller becomes
+// the owner; server-set fields such as id and user_id are ignored.
+type CreateProductRequest struct {
+	Code        string `json:"code" binding:"required,product_code"`
+	Name        string `json:"name" binding:"required,name_length"`
+	Description string `json:"description" binding:"description_length"`
+	Price       uint   `json:"price" binding:"gt=0"`
+	Status      string `json:"status" binding:"omitempty,product_status"` // defaults to business_rules.default_product_status
+}
+
+// ProductFields are the product fields clients can write: the body of
+// PUT /products/:id, and the document a PATCH merges into. Any other field
+// in the body is rejected.
+type ProductFields struct {
+	Code        string `json:"code" binding:"required,product_code"`
+	Name        string `json:"name" binding:"required,name_length"`
+	Description string `json:"description" binding:"description_length"`
+	Price       uint   `json:"price" binding:"gt=0"`
+	Status      string `json:"status" binding:"required,product_status"`
+	UserID      uint   `json:"user_id" binding:"omitempty,gt=0"` // only with products:manage_any, left out keeps the owner
+}
+
+func productFields(product *models.Product) ProductFields {
+	return ProductFields{
+		Code:        product.Code,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+		Status:      product.Status,
+		UserID:      product.UserID,
+	}
+}
+
+// update sets every field of f, leaving the owner alone if f has none.
+func (f *ProductFields) update() services.ProductUpdate {
+	update := services.ProductUpdate{
+		Code:        &f.Code,
+		Name:        &f.Name,
+		Description: &f.Description,
+		Price:       &f.Price,
+		Status:      &f.Status,
+	}
+	if f.UserID != 0 {
+		update.UserID = &f.UserID
+	}
+	return update
+}
+
 func (h *ProductHandler) CreateProduct(c *gin.Context) {
-	var product models.Product
-	if err := c.ShouldBindJSON(&product); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var req CreateProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.BindError(c, err)
 		return
 	}
 
-	if err := h.service.CreateProduct(c.Request.Context(), &product); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	product := models.Product{
+		Code:        req.Code,
+		Name:        req.Name,
+		Description: req.Description,
+		Price:       req.Price,
+		Status:      req.Status,
+	}
+	if err := h.service.CreateProduct(c.Request.Context(), actorFromContext(c), &product); err != nil {
+		problem.Error(c, err)
 		return
 	}
 
+	c.Header("ETag", productETag(&product))
 	c.JSON(http.StatusCreated, product)
 }
 
@@ -37,13 +95,16 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		problem.Abort(c, http.StatusBadRequest, "invalid_id", "invalid product ID")
 		return
 	}
 
 	product, err := h.service.GetProduct(c.Request.Context(), uint(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		problem.Error(c, err)
+		return
+	}
+	if notModified(c, productETag(product)) {
 		return
 	}
 
@@ -56,69 +117,134 @@ func (h *ProductHandler) ListProducts(c *gin.Context) {
 
 	// Bind query parameters
 	if err := c.ShouldBindQuery(&filter); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.BindError(c, err)
 		return
 	}
 
 	if err := c.ShouldBindQuery(&pagination); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.BindError(c, err)
 		return
 	}
 
 	response, err := h.service.ListProducts(c.Request.Context(), &filter, &pagination)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		problem.Error(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
-func (h *ProductHandler) UpdateProduct(c *gin.Context) {
+// ReplaceProduct replaces every writable field of the product with the body.
+func (h *ProductHandler) ReplaceProduct(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		problem.Abort(c, http.StatusBadRequest, "invalid_id", "invalid product ID")
+		return
+	}
+
+	h.updateProduct(c, uint(id), false)
+}
+
+// PatchProduct applies the JSON Merge Patch in the body to the product.
+func (h *ProductHandler) PatchProduct(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		problem.Abort(c, http.StatusBadRequest, "invalid_id", "invalid product ID")
+		return
+	}
+
+	h.updateProduct(c, uint(id), true)
+}
+
+// updateProduct writes the body to product id, as a merge patch if patch is
+// set and as a full replacement otherwise.
+func (h *ProductHandler) updateProduct(c *gin.Context, id uint, patch bool) {
+	if patch && !requirePatchContentType(c) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	current, err := h.service.GetProduct(ctx, id)
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+	version, ok := ifMatch(c, productETag(current), current.Version)
+	if !ok {
 		return
 	}
 
-	var updates map[string]interface{}
-	if err := c.ShouldBindJSON(&updates); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var fields ProductFields
+	if patch {
+		err = bindMergePatch(c, productFields(current), &fields)
+	} else {
+		err = bindStrictJSON(c, &fields)
+	}
+	if err != nil {
+		problem.BindError(c, err)
 		return
 	}
 
-	if err := h.service.UpdateProduct(c.Request.Context(), uint(id), updates); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	product, err := h.service.UpdateProduct(ctx, actorFromContext(c), id, version, fields.update())
+	if err != nil {
+		problem.Error(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "product updated successfully"})
+	c.Header("ETag", productETag(product))
+	c.JSON(http.StatusOK, product)
 }
 
 func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		problem.Abort(c, http.StatusBadRequest, "invalid_id", "invalid product ID")
 		return
 	}
 
-	if err := h.service.DeleteProduct(c.Request.Context(), uint(id)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	ctx := c.Request.Context()
+	current, err := h.service.GetProduct(ctx, uint(id))
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+	version, ok := ifMatch(c, productETag(current), current.Version)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteProduct(ctx, actorFromContext(c), uint(id), version); err != nil {
+		problem.Error(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "product deleted successfully"})
 }
 
-func (h *ProductHandler) RegisterRoutes(router *gin.RouterGroup) {
+// actorFromContext builds the policy actor from what AuthMiddleware and
+// RequirePermission set.
+func actorFromContext(c *gin.Context) policy.Actor {
+	role, _ := c.Get("userRole")
+	actorRole, _ := role.(models.Role)
+	return policy.Actor{
+		UserID:      c.GetUint("userID"),
+		Role:        actorRole,
+		Permissions: c.GetStringSlice("permissions"),
+	}
+}
+
+func (h *ProductHandler) RegisterRoutes(router *gin.RouterGroup, requirePermission func(permission string) gin.HandlerFunc) {
 	products := router.Group("/products")
 	{
-		products.POST("", h.CreateProduct)
-		products.GET("", h.ListProducts)
-		products.GET("/:id", h.GetProduct)
-		products.PUT("/:id", h.UpdateProduct)
-		products.DELETE("/:id", h.DeleteProduct)
+		products.POST("", requirePermission(models.PermissionProductsWrite), h.CreateProduct)
+		products.GET("", requirePermission(models.PermissionProductsRead), h.ListProducts)
+		products.GET("/:id", requirePermission(models.PermissionProductsRead), h.GetProduct)
+		products.PUT("/:id", requirePermission(models.PermissionProductsWrite), h.ReplaceProduct)
+		products.PATCH("/:id", requirePermission(models.PermissionProductsWrite), h.PatchProduct)
+		products.DELETE("/:id", requirePermission(models.PermissionProductsWrite), h.DeleteProduct)
 	}
 }
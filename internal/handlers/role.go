@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/problem"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleHandler struct {
+	service *services.RBACService
+}
+
+func NewRoleHandler(service *services.RBACService) *RoleHandler {
+	return &RoleHandler{service: service}
+}
+
+type RoleRequest struct {
+	Name        models.Role `json:"name" binding:"required"`
+	Description string      `json:"description" binding:"max=255"`
+	Permissions []string    `json:"permissions"`
+}
+
+type UpdateRoleRequest struct {
+	Description string   `json:"description" binding:"max=255"`
+	Permissions []string `json:"permissions"`
+}
+
+type AssignRoleRequest struct {
+	Role models.Role `json:"role" binding:"required"`
+}
+
+type RoleResponse struct {
+	*models.RoleDefinition
+	Permissions []string `json:"permissions"`
+}
+
+func roleResponse(role *models.RoleDefinition) RoleResponse {
+	return RoleResponse{RoleDefinition: role, Permissions: role.PermissionList()}
+}
+
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	roles, err := h.service.ListRoles(c.Request.Context())
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	data := make([]RoleResponse, 0, len(roles))
+	for _, role := range roles {
+		data = append(data, roleResponse(role))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data, "permissions": models.Permissions})
+}
+
+func (h *RoleHandler) GetRole(c *gin.Context) {
+	role, err := h.service.GetRole(c.Request.Context(), models.Role(c.Param("name")))
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, roleResponse(role))
+}
+
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.BindError(c, err)
+		return
+	}
+
+	role, err := h.service.CreateRole(c.Request.Context(), actorFromContext(c), req.Name, req.Description, req.Permissions)
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, roleResponse(role))
+}
+
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.BindError(c, err)
+		return
+	}
+
+	role, err := h.service.UpdateRole(c.Request.Context(), actorFromContext(c), models.Role(c.Param("name")), req.Description, req.Permissions)
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, roleResponse(role))
+}
+
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	if err := h.service.DeleteRole(c.Request.Context(), models.Role(c.Param("name"))); err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "role deleted successfully"})
+}
+
+func (h *RoleHandler) AssignRole(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		problem.Abort(c, http.StatusBadRequest, "invalid_id", "invalid user ID")
+		return
+	}
+
+	var req AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.BindError(c, err)
+		return
+	}
+
+	if err := h.service.AssignRole(c.Request.Context(), actorFromContext(c), uint(id), req.Role); err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "role assigned successfully"})
+}
+
+func (h *RoleHandler) RegisterRoutes(router *gin.RouterGroup, requirePermission func(permission string) gin.HandlerFunc) {
+	roles := router.Group("/roles")
+	{
+		roles.GET("", requirePermission(models.PermissionRolesRead), h.ListRoles)
+		roles.GET("/:name", requirePermission(models.PermissionRolesRead), h.GetRole)
+		roles.POST("", requirePermission(models.PermissionRolesWrite), h.CreateRole)
+		roles.PUT("/:name", requirePermission(models.PermissionRolesWrite), h.UpdateRole)
+		roles.DELETE("/:name", requirePermission(models.PermissionRolesWrite), h.DeleteRole)
+	}
+	router.PUT("/users/:id/role", requirePermission(models.PermissionRolesWrite), h.AssignRole)
+}
@@ -1,34 +1,67 @@
 package handlers
 
 import (
-	"errors"
+	"encoding/json"
 	"net/http"
 	"strconv"
 
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/logging"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/problem"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/services"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
+	"github.com/gin-gonic/gin/binding"
 )
 
 type UserHandler struct {
-	service *services.UserService
+	service             *services.UserService
+	verificationService *services.EmailVerificationService
+	loginGuard          *services.LoginGuard
 }
 
-func NewUserHandler(service *services.UserService) *UserHandler {
-	return &UserHandler{service: service}
+func NewUserHandler(service *services.UserService, verificationService *services.EmailVerificationService, loginGuard *services.LoginGuard) *UserHandler {
+	return &UserHandler{
+		service:             service,
+		verificationService: verificationService,
+		loginGuard:          loginGuard,
+	}
+}
+
+// ProfileFields is the allow-list of fields a user can edit: the body of
+// PUT /users/:id and PUT /me, and the document a PATCH merges into. Any other
+// field in the body is rejected.
+type ProfileFields struct {
+	Name  string `json:"name" binding:"required,name_length"`
+	Email string `json:"email" binding:"required,email,max=100"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,password_length"`
+}
+
+// bindStrictJSON is ShouldBindJSON that also fails on fields obj does not
+// declare.
+func bindStrictJSON(c *gin.Context, obj any) error {
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(obj); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(obj)
 }
 
 func (h *UserHandler) CreateUser(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.BindError(c, err)
 		return
 	}
 
-	if err := h.service.CreateUser(c.Request.Context(), &user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	user := models.User{Name: req.Name, Email: req.Email, Role: models.RoleUser}
+	if err := h.service.CreateUserWithPassword(c.Request.Context(), &user, req.Password); err != nil {
+		problem.Error(c, err)
 		return
 	}
 
@@ -39,17 +72,16 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		problem.Abort(c, http.StatusBadRequest, "invalid_id", "invalid user ID")
 		return
 	}
 
-	user, err := h.service.GetUser(c.Request.Context(), uint(id))
+	user, err := h.service.GetUserFor(c.Request.Context(), actorFromContext(c), uint(id))
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		problem.Error(c, err)
+		return
+	}
+	if notModified(c, userETag(user)) {
 		return
 	}
 
@@ -61,69 +93,213 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 	var pagination models.PaginationParams
 
 	if err := c.ShouldBindQuery(&filter); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.BindError(c, err)
 		return
 	}
 
 	if err := c.ShouldBindQuery(&pagination); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.BindError(c, err)
 		return
 	}
 
 	response, err := h.service.ListUsers(c.Request.Context(), &filter, &pagination)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		problem.Error(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
-func (h *UserHandler) UpdateUser(c *gin.Context) {
+// ReplaceUser replaces every editable field of the user with the body.
+func (h *UserHandler) ReplaceUser(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		problem.Abort(c, http.StatusBadRequest, "invalid_id", "invalid user ID")
 		return
 	}
 
-	var updates map[string]interface{}
-	if err := c.ShouldBindJSON(&updates); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	h.updateUser(c, uint(id), false)
+}
+
+// PatchUser applies the JSON Merge Patch in the body to the user.
+func (h *UserHandler) PatchUser(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		problem.Abort(c, http.StatusBadRequest, "invalid_id", "invalid user ID")
 		return
 	}
 
-	if err := h.service.UpdateUser(c.Request.Context(), uint(id), updates); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	h.updateUser(c, uint(id), true)
+}
+
+// updateUser writes the body to user id, as a merge patch if patch is set and
+// as a full replacement otherwise.
+func (h *UserHandler) updateUser(c *gin.Context, id uint, patch bool) {
+	if patch && !requirePatchContentType(c) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "user updated successfully"})
+	ctx := c.Request.Context()
+	actor := actorFromContext(c)
+	current, err := h.service.GetUserFor(ctx, actor, id)
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+	version, ok := ifMatch(c, userETag(current), current.Version)
+	if !ok {
+		return
+	}
+
+	var fields ProfileFields
+	if patch {
+		err = bindMergePatch(c, ProfileFields{Name: current.Name, Email: current.Email}, &fields)
+	} else {
+		err = bindStrictJSON(c, &fields)
+	}
+	if err != nil {
+		problem.BindError(c, err)
+		return
+	}
+
+	user, err := h.service.UpdateUser(ctx, actor, id, version, services.ProfileUpdate{Name: &fields.Name, Email: &fields.Email})
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+	// A changed address needs confirming again.
+	if user.Email != current.Email && !user.IsVerified() {
+		if err := h.verificationService.SendVerification(ctx, user); err != nil {
+			logging.FromContext(ctx).Error("Failed to send verification email", "user_id", user.ID, "error", err)
+		}
+	}
+
+	c.Header("ETag", userETag(user))
+	c.JSON(http.StatusOK, user)
 }
 
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		problem.Abort(c, http.StatusBadRequest, "invalid_id", "invalid user ID")
+		return
+	}
+
+	if h.deleteUser(c, uint(id)) {
+		c.JSON(http.StatusOK, gin.H{"message": "user deleted successfully"})
+	}
+}
+
+// deleteUser deletes user id, on the condition in If-Match if any, and
+// reports whether it did. Otherwise it has responded with the problem.
+func (h *UserHandler) deleteUser(c *gin.Context, id uint) bool {
+	ctx := c.Request.Context()
+	current, err := h.service.GetUser(ctx, id)
+	if err != nil {
+		problem.Error(c, err)
+		return false
+	}
+	version, ok := ifMatch(c, userETag(current), current.Version)
+	if !ok {
+		return false
+	}
+
+	if err := h.service.DeleteUser(ctx, id, version); err != nil {
+		problem.Error(c, err)
+		return false
+	}
+	return true
+}
+
+// UnlockUser lifts a login lockout on the user's account before it expires.
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		problem.Abort(c, http.StatusBadRequest, "invalid_id", "invalid user ID")
+		return
+	}
+
+	user, err := h.service.GetUser(c.Request.Context(), uint(id))
+	if err != nil {
+		problem.Error(c, err)
 		return
 	}
 
-	if err := h.service.DeleteUser(c.Request.Context(), uint(id)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.loginGuard.Unlock(c.Request.Context(), user.Email); err != nil {
+		problem.Error(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "user deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "user unlocked successfully"})
 }
 
-func (h *UserHandler) RegisterRoutes(router *gin.RouterGroup, authMiddleware gin.HandlerFunc, roleMiddleware gin.HandlerFunc) {
-    users := router.Group("/users")
-    users.Use(authMiddleware) // Require authentication for all /users routes
+func (h *UserHandler) GetMe(c *gin.Context) {
+	user, err := h.service.GetUserFor(c.Request.Context(), actorFromContext(c), c.GetUint("userID"))
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+	if notModified(c, userETag(user)) {
+		return
+	}
 
-    users.POST("", roleMiddleware, h.CreateUser)
-    users.GET("", roleMiddleware, h.ListUsers) // Only admin can list users
-    users.GET("/:id", h.GetUser) // Authenticated users can get user info
-    users.PUT("/:id", h.UpdateUser) // Add roleMiddleware if only admin/self can update
-    users.DELETE("/:id", roleMiddleware, h.DeleteUser) // Only admin can delete users
-}
\ No newline at end of file
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *UserHandler) ReplaceMe(c *gin.Context) {
+	h.updateUser(c, c.GetUint("userID"), false)
+}
+
+func (h *UserHandler) PatchMe(c *gin.Context) {
+	h.updateUser(c, c.GetUint("userID"), true)
+}
+
+func (h *UserHandler) DeleteMe(c *gin.Context) {
+	if h.deleteUser(c, c.GetUint("userID")) {
+		c.JSON(http.StatusOK, gin.H{"message": "account deleted successfully"})
+	}
+}
+
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.BindError(c, err)
+		return
+	}
+
+	if err := h.service.ChangePassword(c.Request.Context(), c.GetUint("userID"), req.CurrentPassword, req.NewPassword); err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password changed successfully, sign in again"})
+}
+
+func (h *UserHandler) RegisterRoutes(router *gin.RouterGroup, requirePermission func(permission string) gin.HandlerFunc) {
+    users := router.Group("/users") // Authentication comes from the router group
+
+    users.POST("", requirePermission(models.PermissionUsersWrite), h.CreateUser)
+    users.GET("", requirePermission(models.PermissionUsersRead), h.ListUsers)
+    users.GET("/:id", h.GetUser) // Admins or the user themselves
+    users.PUT("/:id", h.ReplaceUser) // Admins or the user themselves
+    users.PATCH("/:id", h.PatchUser) // Admins or the user themselves
+    users.DELETE("/:id", requirePermission(models.PermissionUsersWrite), h.DeleteUser)
+    users.POST("/:id/unlock", requirePermission(models.PermissionUsersWrite), h.UnlockUser) // Lifts a login lockout
+}
+
+// RegisterMeRoutes adds the self-service routes for the caller's own account.
+func (h *UserHandler) RegisterMeRoutes(router *gin.RouterGroup) {
+	me := router.Group("/me")
+	{
+		me.GET("", h.GetMe)
+		me.PUT("", h.ReplaceMe)
+		me.PATCH("", h.PatchMe)
+		me.DELETE("", h.DeleteMe)
+		me.PUT("/password", h.ChangePassword)
+	}
+}
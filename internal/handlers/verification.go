@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/problem"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type VerificationHandler struct {
+	service *services.EmailVerificationService
+}
+
+func NewVerificationHandler(service *services.EmailVerificationService) *VerificationHandler {
+	return &VerificationHandler{service: service}
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+func (h *VerificationHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.BindError(c, err)
+		return
+	}
+
+	if err := h.service.Verify(c.Request.Context(), req.Token); err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "email verified successfully"})
+}
+
+func (h *VerificationHandler) ResendVerification(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	if err := h.service.ResendVerification(c.Request.Context(), userID); err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "verification email sent"})
+}
+
+func (h *VerificationHandler) RegisterRoutes(router *gin.RouterGroup, authMiddleware gin.HandlerFunc) {
+	router.POST("/verify-email", h.VerifyEmail)
+	router.POST("/verify-email/resend", authMiddleware, h.ResendVerification)
+}
@@ -0,0 +1,142 @@
+// Package health runs the dependency checks behind the readiness probe.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check reports whether a dependency is usable. It should give up once ctx
+// is done.
+type Check func(ctx context.Context) error
+
+const (
+	StatusOK           = "ok"
+	StatusFailing      = "failing"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Result is the outcome of a single check.
+type Result struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report is the outcome of all checks, keyed by check name. Status is
+// StatusOK only if every check passed.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// OK reports whether the server is ready to receive traffic.
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+type namedCheck struct {
+	name    string
+	timeout time.Duration
+	check   Check
+}
+
+// Checker holds the registered checks and whether the server is draining
+// for shutdown.
+type Checker struct {
+	timeout  time.Duration
+	draining atomic.Bool
+
+	mu     sync.RWMutex
+	checks []namedCheck
+}
+
+// NewChecker returns a Checker giving each check timeout to complete unless
+// it is registered with its own.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Register adds a check run with the default timeout.
+func (c *Checker) Register(name string, check Check) {
+	c.RegisterWithTimeout(name, 0, check)
+}
+
+// RegisterWithTimeout adds a check that fails if it takes longer than
+// timeout, or the default timeout if timeout is not positive.
+func (c *Checker) RegisterWithTimeout(name string, timeout time.Duration, check Check) {
+	if timeout <= 0 {
+		timeout = c.timeout
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name: name, timeout: timeout, check: check})
+}
+
+// Drain makes readiness fail from now on, so load balancers stop sending
+// requests before the server shuts down.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Ready runs every check concurrently and reports their results. While
+// draining it reports StatusShuttingDown without running them.
+func (c *Checker) Ready(ctx context.Context) Report {
+	if c.draining.Load() {
+		return Report{Status: StatusShuttingDown}
+	}
+
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	for i, check := range checks {
+		if results[i].Status != StatusOK {
+			report.Status = StatusFailing
+		}
+		report.Checks[check.name] = results[i]
+	}
+	return report
+}
+
+// run runs check, giving up on it after its timeout even if it ignores its
+// context.
+func run(ctx context.Context, check namedCheck) Result {
+	ctx, cancel := context.WithTimeout(ctx, check.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check.check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", check.timeout)
+	}
+
+	result := Result{Status: StatusOK, Duration: time.Since(start).Round(time.Microsecond).String()}
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,69 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadyRunsChecks(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.Register("database", func(ctx context.Context) error { return nil })
+	checker.Register("cache", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	report := checker.Ready(context.Background())
+	assert.False(t, report.OK())
+	assert.Equal(t, StatusFailing, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["database"].Status)
+	assert.Equal(t, StatusFailing, report.Checks["cache"].Status)
+	assert.Equal(t, "connection refused", report.Checks["cache"].Error)
+	assert.NotEmpty(t, report.Checks["cache"].Duration)
+}
+
+func TestReadyWithoutChecks(t *testing.T) {
+	report := NewChecker(time.Second).Ready(context.Background())
+	assert.True(t, report.OK())
+	assert.Empty(t, report.Checks)
+}
+
+func TestReadyTimesOutSlowChecks(t *testing.T) {
+	checker := NewChecker(50 * time.Millisecond)
+	block := make(chan struct{})
+	defer close(block)
+	// Ignores its context, so only the checker's own timeout ends it
+	checker.RegisterWithTimeout("stuck", 20*time.Millisecond, func(ctx context.Context) error {
+		<-block
+		return nil
+	})
+	checker.Register("respects context", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	report := checker.Ready(context.Background())
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, StatusFailing, report.Status)
+	assert.Equal(t, "timed out after 20ms", report.Checks["stuck"].Error)
+	assert.Equal(t, StatusFailing, report.Checks["respects context"].Status)
+}
+
+func TestDrainFailsReadiness(t *testing.T) {
+	checker := NewChecker(time.Second)
+	ran := false
+	checker.Register("database", func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	assert.True(t, checker.Ready(context.Background()).OK())
+
+	ran = false
+	checker.Drain()
+	report := checker.Ready(context.Background())
+	assert.Equal(t, StatusShuttingDown, report.Status)
+	assert.False(t, report.OK())
+	assert.False(t, ran)
+}
@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+type contextKey struct{}
+
+// New builds the logger described by cfg. The returned closer releases the
+// log file when Output is "file" and is a no-op otherwise.
+func New(cfg *config.LoggingConfig) (*slog.Logger, io.Closer, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var out io.WriteCloser
+	switch cfg.Output {
+	case "", "stdout":
+		out = nopCloser{os.Stdout}
+	case "stderr":
+		out = nopCloser{os.Stderr}
+	case "file":
+		out = &lumberjack.Logger{
+			Filename:   cfg.File.Path,
+			MaxSize:    cfg.File.MaxSize,
+			MaxBackups: cfg.File.MaxBackups,
+			MaxAge:     cfg.File.MaxAge,
+			Compress:   cfg.File.Compress,
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported log output: %s", cfg.Output)
+	}
+
+	handler, err := NewHandler(out, cfg.Format, level)
+	if err != nil {
+		return nil, nil, err
+	}
+	return slog.New(handler), out, nil
+}
+
+// NewHandler returns a JSON or text handler writing records at level and
+// above to w.
+func NewHandler(w io.Writer, format string, level slog.Leveler) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "", "json":
+		return slog.NewJSONHandler(w, opts), nil
+	case "text":
+		return slog.NewTextHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("unsupported log format: %s", format)
+	}
+}
+
+// ParseLevel parses debug, info, warn or error. An empty level is info.
+func ParseLevel(level string) (slog.Level, error) {
+	var parsed slog.Level
+	if level == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := parsed.UnmarshalText([]byte(strings.ToLower(level))); err != nil {
+		return 0, fmt.Errorf("unsupported log level: %s", level)
+	}
+	return parsed, nil
+}
+
+// WithLogger returns a copy of ctx carrying logger, e.g. one with the
+// request ID of the request being served.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger stored by WithLogger, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// records decodes the JSON lines written by a JSON handler.
+func records(t *testing.T, data []byte) []map[string]interface{} {
+	t.Helper()
+	var out []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		out = append(out, record)
+	}
+	return out
+}
+
+func TestNewWritesToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "server.log")
+	logger, closer, err := New(&config.LoggingConfig{
+		Level:  "warn",
+		Format: "json",
+		Output: "file",
+		File:   config.LogFileConfig{Path: path, MaxSize: 1},
+	})
+	require.NoError(t, err)
+
+	logger.Info("dropped")
+	logger.Warn("kept", "user_id", 7)
+	require.NoError(t, closer.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	logged := records(t, data)
+	require.Len(t, logged, 1)
+	assert.Equal(t, "kept", logged[0]["msg"])
+	assert.Equal(t, "WARN", logged[0]["level"])
+	assert.EqualValues(t, 7, logged[0]["user_id"])
+}
+
+func TestNewRejectsUnknownSettings(t *testing.T) {
+	_, _, err := New(&config.LoggingConfig{Level: "loud"})
+	assert.ErrorContains(t, err, "unsupported log level: loud")
+
+	_, _, err = New(&config.LoggingConfig{Format: "xml"})
+	assert.ErrorContains(t, err, "unsupported log format: xml")
+
+	_, _, err = New(&config.LoggingConfig{Output: "syslog"})
+	assert.ErrorContains(t, err, "unsupported log output: syslog")
+}
+
+func TestParseLevel(t *testing.T) {
+	for level, want := range map[string]slog.Level{"": slog.LevelInfo, "debug": slog.LevelDebug, "WARN": slog.LevelWarn, "error": slog.LevelError} {
+		got, err := ParseLevel(level)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got, level)
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := NewHandler(&buf, "text", slog.LevelInfo)
+	require.NoError(t, err)
+
+	slog.New(handler).Info("hello", "route", "/api/v1/products")
+	assert.Contains(t, buf.String(), `msg=hello route=/api/v1/products`)
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Same(t, slog.Default(), FromContext(context.Background()))
+
+	logger := slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))
+	assert.Same(t, logger, FromContext(WithLogger(context.Background(), logger)))
+}
+
+func TestGormLoggerTrace(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := NewHandler(&buf, "json", slog.LevelInfo)
+	require.NoError(t, err)
+	ctx := WithLogger(context.Background(), slog.New(handler).With("request_id", "abc"))
+	gormLogger := NewGormLogger(100 * time.Millisecond)
+	query := func() (string, int64) { return "SELECT * FROM products", 3 }
+
+	gormLogger.Trace(ctx, time.Now(), query, nil)
+	gormLogger.Trace(ctx, time.Now(), query, gorm.ErrRecordNotFound)
+	assert.Empty(t, buf.String(), "fast queries are only logged at debug level")
+
+	gormLogger.Trace(ctx, time.Now().Add(-time.Second), query, nil)
+	gormLogger.Trace(ctx, time.Now(), query, errors.New("no such table: products"))
+
+	logged := records(t, buf.Bytes())
+	require.Len(t, logged, 2)
+	assert.Equal(t, "Slow query", logged[0]["msg"])
+	assert.Equal(t, "WARN", logged[0]["level"])
+	assert.Equal(t, "SELECT * FROM products", logged[0]["sql"])
+	assert.EqualValues(t, 3, logged[0]["rows"])
+	assert.Equal(t, "abc", logged[0]["request_id"])
+	assert.Equal(t, "Query failed", logged[1]["msg"])
+	assert.Equal(t, "no such table: products", logged[1]["error"])
+}
+
+func TestGormLoggerTraceAtDebugLevel(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := NewHandler(&buf, "json", slog.LevelDebug)
+	require.NoError(t, err)
+	ctx := WithLogger(context.Background(), slog.New(handler))
+
+	// Without a threshold slow queries are not singled out.
+	NewGormLogger(0).Trace(ctx, time.Now().Add(-time.Second), func() (string, int64) { return "SELECT 1", 1 }, nil)
+
+	logged := records(t, buf.Bytes())
+	require.Len(t, logged, 1)
+	assert.Equal(t, "Query", logged[0]["msg"])
+	assert.Equal(t, "DEBUG", logged[0]["level"])
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestRegisterDB(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Ping())
+
+	require.NoError(t, RegisterDB(db, "sqlite"))
+	assert.Error(t, RegisterDB(db, "sqlite"), "a pool is registered once")
+
+	expected := `
+# HELP go_sql_max_open_connections Maximum number of open connections to the database.
+# TYPE go_sql_max_open_connections gauge
+go_sql_max_open_connections{db_name="sqlite"} 0
+# HELP go_sql_open_connections The number of established connections both in use and idle.
+# TYPE go_sql_open_connections gauge
+go_sql_open_connections{db_name="sqlite"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(Registry, strings.NewReader(expected), "go_sql_max_open_connections", "go_sql_open_connections"))
+}
@@ -1,56 +1,177 @@
 package middleware
 
 import (
-    "slices"
 	"net/http"
     "strings"
 
     "github.com/gin-gonic/gin"
     "github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+    "github.com/MikeTeddyOmondi/marketplace-api/internal/problem"
     "github.com/MikeTeddyOmondi/marketplace-api/internal/services"
 )
 
-func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
+// AuthMiddleware accepts either a JWT access token or a personal API key,
+// sent as "X-API-Key: mk_..." or "Authorization: Bearer mk_...".
+func AuthMiddleware(authService *services.AuthService, apiKeyService *services.APIKeyService) gin.HandlerFunc {
     return func(c *gin.Context) {
+        if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+            authenticateAPIKey(c, apiKeyService, apiKey)
+            return
+        }
         authHeader := c.GetHeader("Authorization")
         if authHeader == "" {
-            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing"})
+            problem.Abort(c, http.StatusUnauthorized, "missing_credentials", "Authorization header missing")
             return
         }
         tokenParts := strings.Split(authHeader, " ")
         if len(tokenParts) != 2 || strings.ToLower(tokenParts[0]) != "bearer" {
-            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
+            problem.Abort(c, http.StatusUnauthorized, "invalid_authorization", "Invalid authorization format")
             return
         }
         token := tokenParts[1]
-        claims, err := authService.ValidateToken(token)
+        if strings.HasPrefix(token, models.APIKeyPrefix) {
+            authenticateAPIKey(c, apiKeyService, token)
+            return
+        }
+        claims, err := authService.ValidateToken(c.Request.Context(), token)
         if err != nil {
-            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+            problem.Error(c, err)
             return
         }
+        revoked, err := authService.IsTokenRevoked(c.Request.Context(), claims.ID)
+        if err != nil {
+            problem.Error(c, err)
+            return
+        }
+        if revoked {
+            problem.Abort(c, http.StatusUnauthorized, "token_revoked", "Token has been revoked")
+            return
+        }
+        c.Set("claims", claims)
         c.Set("userID", claims.UserID)
         c.Set("userRole", claims.Role)
+        c.Set("mfa", claims.HasMFA())
+        withUserLogger(c, claims.UserID)
         c.Next()
     }
 }
 
-func RoleMiddleware(allowedRoles ...models.Role) gin.HandlerFunc {
+func authenticateAPIKey(c *gin.Context, apiKeyService *services.APIKeyService, rawKey string) {
+    key, user, err := apiKeyService.Authenticate(c.Request.Context(), rawKey)
+    if err != nil {
+        problem.Error(c, err)
+        return
+    }
+    if isAccountSecurityRoute(c) {
+        problem.Abort(c, http.StatusForbidden, "api_key_not_allowed", "API keys cannot be used to manage account security")
+        return
+    }
+    if scope := requiredScope(c); !key.Allows(scope) {
+        problem.Abort(c, http.StatusForbidden, "insufficient_scope", "API key lacks scope "+scope)
+        return
+    }
+    c.Set("apiKeyID", key.ID)
+    c.Set("userID", user.ID)
+    c.Set("userRole", user.Role)
+    c.Set("mfa", false)
+    withUserLogger(c, user.ID)
+    c.Next()
+}
+
+// accountSecurityRoutes are refused to API keys whatever their scopes, so a
+// leaked key cannot mint more keys, turn off two-factor authentication or
+// change the password.
+var accountSecurityRoutes = []string{"/api-keys", "/mfa", "/password", "/me/password"}
+
+func isAccountSecurityRoute(c *gin.Context) bool {
+    path := strings.TrimPrefix(c.FullPath(), "/api/v1")
+    for _, route := range accountSecurityRoutes {
+        if path == route || strings.HasPrefix(path, route+"/") {
+            return true
+        }
+    }
+    return false
+}
+
+// requiredScope derives the scope a route needs from its resource, e.g.
+// GET /api/v1/products/:id needs "products:read".
+func requiredScope(c *gin.Context) string {
+    path := strings.TrimPrefix(c.FullPath(), "/api/v1")
+    resource, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+    if resource == "me" {
+        resource = "users" // The caller's own account
+    }
+    switch c.Request.Method {
+    case http.MethodGet, http.MethodHead, http.MethodOptions:
+        return resource + ":read"
+    default:
+        return resource + ":write"
+    }
+}
+
+// RequirePermission aborts with 403 unless the caller's role grants
+// permission. The role's permissions are stored under "permissions".
+func RequirePermission(rbac *services.RBACService, permission string) gin.HandlerFunc {
+    return permissionMiddleware(rbac, permission, false)
+}
+
+// RequireMFAPermission is RequirePermission that additionally requires the
+// token to come from a login completed with a second factor.
+func RequireMFAPermission(rbac *services.RBACService, permission string) gin.HandlerFunc {
+    return permissionMiddleware(rbac, permission, true)
+}
+
+func permissionMiddleware(rbac *services.RBACService, permission string, requireMFA bool) gin.HandlerFunc {
     return func(c *gin.Context) {
-        userRole, exists := c.Get("userRole")
-        if !exists {
-            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "User role not found"})
+        permissions, ok := loadPermissions(c, rbac)
+        if !ok {
             return
         }
-        role, ok := userRole.(models.Role)
-        if !ok {
-            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Invalid user role"})
+        if !models.GrantsPermission(permissions, permission) {
+            problem.Abort(c, http.StatusForbidden, "insufficient_permissions", "Insufficient permissions")
             return
         }
-        hasPermission := slices.Contains(allowedRoles, role)
-        if !hasPermission {
-            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+        if requireMFA && !c.GetBool("mfa") {
+            problem.Abort(c, http.StatusForbidden, "mfa_required", "Two-factor authentication required")
             return
         }
         c.Next()
     }
-}
\ No newline at end of file
+}
+
+// LoadPermissions stores the caller's permissions under "permissions"
+// without requiring any, for handlers that decide access per resource.
+func LoadPermissions(rbac *services.RBACService) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if _, ok := loadPermissions(c, rbac); ok {
+            c.Next()
+        }
+    }
+}
+
+// loadPermissions resolves the permissions of the caller's role once per
+// request. It aborts the request and returns false if that fails.
+func loadPermissions(c *gin.Context, rbac *services.RBACService) ([]string, bool) {
+    if value, exists := c.Get("permissions"); exists {
+        if permissions, ok := value.([]string); ok {
+            return permissions, true
+        }
+    }
+    userRole, exists := c.Get("userRole")
+    if !exists {
+        problem.Abort(c, http.StatusForbidden, "role_missing", "User role not found")
+        return nil, false
+    }
+    role, ok := userRole.(models.Role)
+    if !ok {
+        problem.Abort(c, http.StatusForbidden, "role_missing", "Invalid user role")
+        return nil, false
+    }
+    permissions, err := rbac.Permissions(c.Request.Context(), role)
+    if err != nil {
+        problem.Error(c, err)
+        return nil, false
+    }
+    c.Set("permissions", permissions)
+    return permissions, true
+}
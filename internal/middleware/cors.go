@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"sync/atomic"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/requestid"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// CORS applies the configured CORS policy and lets a config reload replace
+// it while serving.
+type CORS struct {
+	handler atomic.Pointer[gin.HandlerFunc]
+}
+
+func NewCORS(cfg config.CORSConfig) (*CORS, error) {
+	c := &CORS{}
+	if err := c.Update(cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Update replaces the policy. An invalid cfg leaves the current one in place.
+func (c *CORS) Update(cfg config.CORSConfig) error {
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowOrigins = cfg.AllowedOrigins
+	corsConfig.AllowMethods = cfg.AllowedMethods
+	corsConfig.AllowHeaders = cfg.AllowedHeaders
+	corsConfig.ExposeHeaders = []string{requestid.Header, "ETag", IdempotentReplayedHeader}
+	if err := corsConfig.Validate(); err != nil {
+		return err
+	}
+
+	handler := cors.New(corsConfig)
+	c.handler.Store(&handler)
+	return nil
+}
+
+func (c *CORS) Handler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		(*c.handler.Load())(ctx)
+	}
+}
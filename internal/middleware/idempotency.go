@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/logging"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/problem"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyKeyHeader names the client-chosen key that makes retries of
+	// a POST safe.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed for a retry.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// Idempotency answers a POST retried with the same Idempotency-Key header
+// with the stored first response instead of running it again. Keys belong
+// to the authenticated user, so it must run after AuthMiddleware; routes
+// reached without authentication, such as /register and /login, ignore the
+// header. Reusing a key for a different request is rejected with 422, and a
+// retry while the first request is still running with 409. Server errors and
+// 401 and 403 responses are not stored, so the retry runs the request again
+// and sees the caller's current permissions.
+func Idempotency(service *services.IdempotencyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if c.Request.Method != http.MethodPost || key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			problem.Abort(c, http.StatusBadRequest, "invalid_idempotency_key",
+				fmt.Sprintf("%s must be at most %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			problem.Abort(c, http.StatusBadRequest, "malformed_body", "failed to read request body")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		scope := fmt.Sprintf("user:%d", c.GetUint("userID"))
+		record, err := service.Begin(ctx, scope, key, fingerprint(c.Request, body))
+		if err != nil {
+			if errors.Is(err, services.ErrIdempotencyKeyInFlight) {
+				c.Header("Retry-After", "1")
+			}
+			problem.Error(c, err)
+			return
+		}
+		if record.Completed() {
+			c.Header(IdempotentReplayedHeader, "true")
+			if record.Location != "" {
+				c.Header("Location", record.Location)
+			}
+			if record.ETag != "" {
+				c.Header("ETag", record.ETag)
+			}
+			c.Data(record.StatusCode, record.ContentType, record.Body)
+			c.Abort()
+			return
+		}
+
+		// Store the outcome even if the client has gone away meanwhile
+		ctx = context.WithoutCancel(ctx)
+		// A handler that panics must not leave the key locked until the lock
+		// times out
+		finished := false
+		defer func() {
+			if finished {
+				return
+			}
+			if err := service.Release(ctx, record); err != nil {
+				logging.FromContext(ctx).Error("Failed to release idempotency key", "error", err)
+			}
+		}()
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		finished = true
+
+		if !replayable(writer.Status()) {
+			err = service.Release(ctx, record)
+		} else {
+			header := writer.Header()
+			record.StatusCode = writer.Status()
+			record.ContentType = header.Get("Content-Type")
+			record.Location = header.Get("Location")
+			record.ETag = header.Get("ETag")
+			record.Body = writer.body.Bytes()
+			err = service.Complete(ctx, record)
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("Failed to store idempotent response", "error", err)
+		}
+	}
+}
+
+// replayable reports whether a response with status is stored for retries.
+// Authorization failures are not, as they depend on the caller's current
+// credentials and permissions rather than on the request.
+func replayable(status int) bool {
+	return status < http.StatusInternalServerError && status != http.StatusUnauthorized && status != http.StatusForbidden
+}
+
+// fingerprint identifies a request by its method, URI and body, so a key
+// reused for a different request can be told apart from a retry.
+func fingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.RequestURI())
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordingWriter keeps a copy of the response body as it is written.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
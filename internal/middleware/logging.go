@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/logging"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/problem"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/requestid"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestLogger gives every request a logger carrying its request ID, set
+// by RequestID, and trace ID, stored in the request context for handlers,
+// services and GORM, and logs the request once it completes. Server errors
+// are logged at error level and client errors at warn level.
+func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		requestID := requestid.FromContext(c.Request.Context())
+		requestLogger := logger.With("request_id", requestID, "method", c.Request.Method, "route", route)
+		if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.IsValid() {
+			requestLogger = requestLogger.With("trace_id", spanContext.TraceID().String())
+		}
+		c.Request = c.Request.WithContext(logging.WithLogger(c.Request.Context(), requestLogger))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+		}
+		if userID, ok := c.Get("userID"); ok {
+			attrs = append(attrs, slog.Any("user_id", userID))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		requestLogger.LogAttrs(c.Request.Context(), level, "Request completed", attrs...)
+	}
+}
+
+// Recovery turns a panic in a handler into a 500 response and logs it with
+// the stack to the request's logger.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// The server aborts the response itself for this one.
+			if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(recovered)
+			}
+			logging.FromContext(c.Request.Context()).Error("Panic recovered",
+				"panic", recovered,
+				"stack", string(debug.Stack()),
+			)
+			problem.Abort(c, http.StatusInternalServerError, "internal_error", "internal server error")
+		}()
+		c.Next()
+	}
+}
+
+// withUserLogger adds the authenticated user's ID to the request's logger.
+func withUserLogger(c *gin.Context, userID uint) {
+	ctx := c.Request.Context()
+	c.Request = c.Request.WithContext(logging.WithLogger(ctx, logging.FromContext(ctx).With("user_id", userID)))
+}
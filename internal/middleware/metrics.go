@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics counts requests and observes their latency by route template, so
+// /products/1 and /products/2 share a series.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		labels := []string{c.Request.Method, route, strconv.Itoa(c.Writer.Status())}
+		metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/requestid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestID accepts the client's X-Request-ID if it is valid, or generates
+// one, and stores it in the request context for logs and SQL comments. The
+// ID is echoed in the X-Request-ID response header and added as
+// "request_id" to the body of JSON error responses.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		c.Header(requestid.Header, id)
+		c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), id))
+
+		writer := &errorBodyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		writer.flush(id)
+	}
+}
+
+// errorBodyWriter holds back the body of JSON error responses so the
+// request ID can be added to it.
+type errorBodyWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer // the held back body, nil unless this is an error response
+}
+
+func (w *errorBodyWriter) buffering() bool {
+	if w.body == nil && !w.ResponseWriter.Written() && w.Status() >= http.StatusBadRequest &&
+		strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		w.body = &bytes.Buffer{}
+	}
+	return w.body != nil
+}
+
+func (w *errorBodyWriter) Write(data []byte) (int, error) {
+	if w.buffering() {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *errorBodyWriter) WriteString(s string) (int, error) {
+	if w.buffering() {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *errorBodyWriter) Size() int {
+	if w.body != nil {
+		return w.body.Len()
+	}
+	return w.ResponseWriter.Size()
+}
+
+// flush writes the held back body with the request ID added, or unchanged
+// if it is not a JSON object.
+func (w *errorBodyWriter) flush(id string) {
+	if w.body == nil {
+		return
+	}
+	body := w.body.Bytes()
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err == nil && fields != nil {
+		if _, ok := fields["request_id"]; !ok {
+			fields["request_id"], _ = json.Marshal(id)
+			if withID, err := json.Marshal(fields); err == nil {
+				body = withID
+			}
+		}
+	}
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.Write(body)
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Tracing starts a span for every request except those to skipRoutes,
+// continuing the trace of an incoming W3C traceparent header, and returns
+// the traceparent of the request's span in the response so a client can look
+// up the trace.
+func Tracing(serviceName string, skipRoutes ...string) gin.HandlersChain {
+	traced := func(c *gin.Context) bool {
+		return !slices.Contains(skipRoutes, c.FullPath())
+	}
+	return gin.HandlersChain{
+		otelgin.Middleware(serviceName, otelgin.WithGinFilter(traced)),
+		func(c *gin.Context) {
+			otel.GetTextMapPropagator().Inject(c.Request.Context(), propagation.HeaderCarrier(c.Writer.Header()))
+			c.Next()
+		},
+	}
+}
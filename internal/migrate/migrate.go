@@ -0,0 +1,400 @@
+// Package migrate applies numbered SQL migrations in order and records the
+// applied versions in the schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Drivers lists the database drivers a migration can have a variant for.
+var Drivers = []string{"sqlite", "postgres", "mysql"}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+var filePattern = regexp.MustCompile(`^(\d+)_(\w+?)(?:\.(sqlite|postgres|mysql))?\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration together with when it was applied, if it was.
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	Missing   bool // Applied to the database but not known to this binary
+}
+
+// schemaMigration is a row of the table recording applied versions.
+type schemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Load reads the migrations in fsys for driver, preferring a driver specific
+// file over the plain one, and returns them ordered by version.
+func Load(fsys fs.FS, driver string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	fromVariant := map[string]bool{} // "<version>.<direction>" already read from a driver file
+	for _, entry := range entries {
+		match := filePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		name, variant, direction := match[2], match[3], match[4]
+		if variant != "" && variant != driver {
+			continue
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, name)
+		}
+
+		key := match[1] + "." + direction
+		if fromVariant[key] && variant == "" {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name(), err)
+		}
+		fromVariant[key] = variant != ""
+		if direction == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %03d_%s has no up file for %s", migration.Version, migration.Name, driver)
+		}
+		migrations = append(migrations, *migration)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return int(a.Version - b.Version)
+	})
+	return migrations, nil
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+func New(db *gorm.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// createTable creates schema_migrations if it does not exist yet. Only the
+// commands that record versions call it, so probes reading Pending stay a
+// plain SELECT.
+func (m *Migrator) createTable(ctx context.Context) error {
+	if err := m.db.WithContext(ctx).AutoMigrate(&schemaMigration{}); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// applied returns the recorded versions, treating a missing schema_migrations
+// table as nothing applied.
+func (m *Migrator) applied(ctx context.Context) (map[int64]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := m.db.WithContext(ctx).Find(&rows).Error; err != nil {
+		if !m.db.WithContext(ctx).Migrator().HasTable(&schemaMigration{}) {
+			return map[int64]schemaMigration{}, nil
+		}
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	applied := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// Status lists every known migration and any applied version this binary
+// does not know about, ordered by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &row.AppliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range applied {
+		statuses = append(statuses, Status{Version: row.Version, Name: row.Name, AppliedAt: &row.AppliedAt, Missing: true})
+	}
+	slices.SortFunc(statuses, func(a, b Status) int {
+		return int(a.Version - b.Version)
+	})
+	return statuses, nil
+}
+
+// Pending returns the migrations not yet applied, in the order Up runs them.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies up to limit pending migrations, or all of them if limit is not
+// positive. Each migration runs in its own transaction; MySQL commits DDL
+// statements implicitly, so a failed MySQL migration may need manual repair.
+func (m *Migrator) Up(ctx context.Context, limit int) ([]Migration, error) {
+	if err := m.createTable(ctx); err != nil {
+		return nil, err
+	}
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(pending) > limit {
+		pending = pending[:limit]
+	}
+
+	for i, migration := range pending {
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := execScript(tx, migration.Up); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now().UTC(),
+			}).Error
+		})
+		if err != nil {
+			return pending[:i], fmt.Errorf("migration %03d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+// Down rolls back the last steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps < 0 {
+		return nil, fmt.Errorf("cannot roll back %d migrations, steps must not be negative", steps)
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]int64, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	slices.Sort(versions)
+	slices.Reverse(versions)
+	if steps < len(versions) {
+		versions = versions[:steps]
+	}
+
+	var rolledBack []Migration
+	for _, version := range versions {
+		idx := slices.IndexFunc(m.migrations, func(migration Migration) bool {
+			return migration.Version == version
+		})
+		if idx < 0 {
+			return rolledBack, fmt.Errorf("migration %d is applied but unknown to this binary", version)
+		}
+		migration := m.migrations[idx]
+		if migration.Down == "" {
+			return rolledBack, fmt.Errorf("migration %03d_%s has no down file", migration.Version, migration.Name)
+		}
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := execScript(tx, migration.Down); err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return rolledBack, fmt.Errorf("rollback of %03d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		rolledBack = append(rolledBack, migration)
+	}
+	return rolledBack, nil
+}
+
+// Force records every known migration up to and including version as
+// applied, and every later one as not applied, without running any SQL. It
+// is meant for adopting a database whose schema was created another way.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if err := m.createTable(ctx); err != nil {
+		return err
+	}
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("version > ?", version).Delete(&schemaMigration{}).Error; err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			row := &schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now().UTC()}
+			if err := tx.Where(schemaMigration{Version: migration.Version}).FirstOrCreate(row).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func execScript(tx *gorm.DB, script string) error {
+	for _, statement := range splitStatements(script) {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements splits a script on semicolons outside of quotes and
+// comments, since not every driver accepts several statements in one Exec.
+func splitStatements(script string) []string {
+	var (
+		statements []string
+		current    strings.Builder
+		quote      rune
+		comment    bool
+	)
+	flush := func() {
+		if statement := strings.TrimSpace(current.String()); statement != "" && !isComment(statement) {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case comment:
+			if r == '\n' {
+				comment = false
+			}
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			comment = true
+		case r == ';':
+			flush()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	flush()
+	return statements
+}
+
+// isComment reports whether statement consists only of "--" comment lines.
+func isComment(statement string) bool {
+	for _, line := range strings.Split(statement, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
+
+// Create writes empty up and down files for a new migration in dir, numbered
+// after the highest existing version. With drivers given, one up file is
+// written per driver instead of a plain one.
+func Create(dir, name string, drivers []string) ([]string, error) {
+	if !namePattern.MatchString(name) {
+		return nil, errors.New("migration name must be lowercase letters, digits and underscores")
+	}
+	for _, driver := range drivers {
+		if !slices.Contains(Drivers, driver) {
+			return nil, fmt.Errorf("unknown driver %q", driver)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	version := int64(1)
+	for _, entry := range entries {
+		if match := filePattern.FindStringSubmatch(entry.Name()); match != nil {
+			if v, _ := strconv.ParseInt(match[1], 10, 64); v >= version {
+				version = v + 1
+			}
+		}
+	}
+
+	base := fmt.Sprintf("%03d_%s", version, name)
+	files := []string{base + ".down.sql"}
+	if len(drivers) == 0 {
+		files = append([]string{base + ".up.sql"}, files...)
+	} else {
+		for _, driver := range drivers {
+			files = append(files, base+"."+driver+".up.sql")
+		}
+	}
+
+	var paths []string
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return paths, fmt.Errorf("failed to create %s: %w", path, err)
+		}
+		f.Close()
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
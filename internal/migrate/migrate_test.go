@@ -0,0 +1,248 @@
+package migrate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/database"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/migrations"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	manager, err := database.NewManager(&config.DatabaseConfig{
+		Driver: "sqlite",
+		SQLite: config.SQLiteConfig{Path: ":memory:"},
+	})
+	require.NoError(t, err)
+	db, err := manager.Connect()
+	require.NoError(t, err)
+	t.Cleanup(func() { manager.Close() })
+	return db
+}
+
+var testFS = fstest.MapFS{
+	"001_create_things.up.sql":     {Data: []byte("CREATE TABLE things (id INTEGER PRIMARY KEY, name TEXT);")},
+	"001_create_things.down.sql":   {Data: []byte("DROP TABLE things;")},
+	"002_add_colour.sqlite.up.sql": {Data: []byte("-- sqlite variant\nALTER TABLE things ADD COLUMN colour TEXT;")},
+	"002_add_colour.mysql.up.sql":  {Data: []byte("ALTER TABLE things ADD COLUMN colour VARCHAR(20);")},
+	"002_add_colour.down.sql":      {Data: []byte("ALTER TABLE things DROP COLUMN colour;")},
+	"003_seed_things.up.sql":       {Data: []byte("INSERT INTO things (name) VALUES ('a;b'); INSERT INTO things (name) VALUES ('c');")},
+	"003_seed_things.down.sql":     {Data: []byte("DELETE FROM things;")},
+	"README.md":                    {Data: []byte("not a migration")},
+	"004_down_only.down.sql":       {Data: []byte("SELECT 1;")},
+}
+
+func TestLoadPrefersDriverVariant(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for name, file := range testFS {
+		if name != "004_down_only.down.sql" {
+			fsys[name] = file
+		}
+	}
+
+	loaded, err := Load(fsys, "mysql")
+	require.NoError(t, err)
+	require.Len(t, loaded, 3)
+	assert.Equal(t, []int64{1, 2, 3}, []int64{loaded[0].Version, loaded[1].Version, loaded[2].Version})
+	assert.Contains(t, loaded[1].Up, "VARCHAR(20)")
+	assert.Equal(t, "ALTER TABLE things DROP COLUMN colour;", loaded[1].Down)
+
+	_, err = Load(fsys, "postgres")
+	assert.Error(t, err, "002 has no up file usable by postgres")
+}
+
+func TestLoadRequiresUpFile(t *testing.T) {
+	_, err := Load(testFS, "sqlite")
+	assert.ErrorContains(t, err, "004_down_only has no up file")
+}
+
+func TestSplitStatements(t *testing.T) {
+	statements := splitStatements(`
+-- leading comment; with a semicolon
+CREATE TABLE a (name TEXT DEFAULT 'x;y');
+INSERT INTO a VALUES ("q;r"); -- trailing
+-- only a comment
+`)
+	assert.Equal(t, []string{
+		"-- leading comment; with a semicolon\nCREATE TABLE a (name TEXT DEFAULT 'x;y')",
+		`INSERT INTO a VALUES ("q;r")`,
+	}, statements)
+}
+
+func TestUpDownStatusForce(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	loaded, err := Load(fstest.MapFS{
+		"001_create_things.up.sql":     testFS["001_create_things.up.sql"],
+		"001_create_things.down.sql":   testFS["001_create_things.down.sql"],
+		"002_add_colour.sqlite.up.sql": testFS["002_add_colour.sqlite.up.sql"],
+		"002_add_colour.down.sql":      testFS["002_add_colour.down.sql"],
+		"003_seed_things.up.sql":       testFS["003_seed_things.up.sql"],
+		"003_seed_things.down.sql":     testFS["003_seed_things.down.sql"],
+	}, "sqlite")
+	require.NoError(t, err)
+	migrator := New(db, loaded)
+
+	applied, err := migrator.Up(ctx, 2)
+	require.NoError(t, err)
+	assert.Len(t, applied, 2)
+	assert.True(t, db.Migrator().HasColumn("things", "colour"))
+
+	pending, err := migrator.Pending(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, int64(3), pending[0].Version)
+
+	applied, err = migrator.Up(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, applied, 1)
+	var count int64
+	require.NoError(t, db.Table("things").Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+
+	rolledBack, err := migrator.Down(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), rolledBack[0].Version)
+	assert.Equal(t, int64(2), rolledBack[1].Version)
+	assert.False(t, db.Migrator().HasColumn("things", "colour"))
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	assert.NotNil(t, statuses[0].AppliedAt)
+	assert.Nil(t, statuses[1].AppliedAt)
+	assert.Nil(t, statuses[2].AppliedAt)
+
+	// Force adopts a schema without running SQL: the column stays missing.
+	require.NoError(t, migrator.Force(ctx, 2))
+	pending, err = migrator.Pending(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.False(t, db.Migrator().HasColumn("things", "colour"))
+
+	// A binary that no longer knows an applied migration reports it.
+	statuses, err = New(db, loaded[:1]).Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.True(t, statuses[1].Missing)
+}
+
+func TestPendingDoesNotCreateTable(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	loaded, err := Load(fstest.MapFS{
+		"001_create_things.up.sql":   testFS["001_create_things.up.sql"],
+		"001_create_things.down.sql": testFS["001_create_things.down.sql"],
+	}, "sqlite")
+	require.NoError(t, err)
+	migrator := New(db, loaded)
+
+	pending, err := migrator.Pending(ctx)
+	require.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.False(t, db.Migrator().HasTable("schema_migrations"), "reading status must not run DDL")
+
+	rolledBack, err := migrator.Down(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, rolledBack)
+
+	_, err = migrator.Down(ctx, -1)
+	assert.Error(t, err)
+}
+
+func TestUpStopsAtFailure(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	migrator := New(db, []Migration{
+		{Version: 1, Name: "ok", Up: "CREATE TABLE ok (id INTEGER);"},
+		{Version: 2, Name: "broken", Up: "CREATE TABLE broken (id INTEGER); NOT SQL;"},
+		{Version: 3, Name: "later", Up: "CREATE TABLE later (id INTEGER);"},
+	})
+
+	applied, err := migrator.Up(ctx, 0)
+	assert.ErrorContains(t, err, "2_broken")
+	assert.Len(t, applied, 1)
+	assert.False(t, db.Migrator().HasTable("broken"), "failed migration is rolled back")
+	assert.False(t, db.Migrator().HasTable("later"))
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "007_existing.up.sql"), nil, 0o644))
+
+	paths, err := Create(dir, "add_things", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "008_add_things.up.sql"),
+		filepath.Join(dir, "008_add_things.down.sql"),
+	}, paths)
+
+	paths, err = Create(dir, "per_driver", []string{"sqlite", "postgres"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "009_per_driver.down.sql"),
+		filepath.Join(dir, "009_per_driver.sqlite.up.sql"),
+		filepath.Join(dir, "009_per_driver.postgres.up.sql"),
+	}, paths)
+
+	_, err = Create(dir, "Bad-Name", nil)
+	assert.Error(t, err)
+	_, err = Create(dir, "x", []string{"oracle"})
+	assert.Error(t, err)
+}
+
+// TestMigrationsMatchModels applies the real migrations and checks that every
+// column the models map to exists, so a model change without a migration
+// fails here rather than at runtime.
+func TestMigrationsMatchModels(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	loaded, err := Load(migrations.FS, "sqlite")
+	require.NoError(t, err)
+	_, err = New(db, loaded).Up(ctx, 0)
+	require.NoError(t, err)
+
+	for _, model := range []interface{}{
+		&models.User{},
+		&models.Product{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.UserToken{},
+		&models.RecoveryCode{},
+		&models.APIKey{},
+		&models.LoginThrottle{},
+		&models.AuditLog{},
+		&models.RoleDefinition{},
+	} {
+		stmt := &gorm.Statement{DB: db}
+		require.NoError(t, stmt.Parse(model))
+		require.True(t, db.Migrator().HasTable(model), "table %s", stmt.Schema.Table)
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			assert.True(t, db.Migrator().HasColumn(model, field.DBName), "column %s.%s", stmt.Schema.Table, field.DBName)
+		}
+	}
+}
+
+func TestMigrationsLoadForEveryDriver(t *testing.T) {
+	for _, driver := range Drivers {
+		loaded, err := Load(migrations.FS, driver)
+		require.NoError(t, err, driver)
+		assert.NotEmpty(t, loaded, driver)
+		for _, migration := range loaded {
+			assert.NotEmpty(t, migration.Down, "%s: %03d_%s", driver, migration.Version, migration.Name)
+		}
+	}
+}
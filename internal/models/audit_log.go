@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+type AuditOutcome string
+
+const (
+	AuditOutcomeAllowed AuditOutcome = "allowed"
+	AuditOutcomeDenied  AuditOutcome = "denied"
+)
+
+// AuditLog records a security relevant decision about a resource.
+type AuditLog struct {
+	ID         uint         `json:"id" gorm:"primaryKey"`
+	ActorID    uint         `json:"actor_id" gorm:"index"`
+	ActorRole  Role         `json:"actor_role" gorm:"size:50"`
+	Action     string       `json:"action" gorm:"size:50;not null"`
+	Resource   string       `json:"resource" gorm:"size:50;not null"`
+	ResourceID uint         `json:"resource_id"`
+	Outcome    AuditOutcome `json:"outcome" gorm:"size:20;not null"`
+	CreatedAt  time.Time    `json:"created_at" gorm:"index"`
+}
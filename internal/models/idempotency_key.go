@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// IdempotencyKey records a POST sent with an Idempotency-Key header, so a
+// retry with the same key gets the first response instead of repeating the
+// request. Until that response is stored the key is locked.
+type IdempotencyKey struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Scope       string    `json:"scope" gorm:"size:64;not null;uniqueIndex:idx_idempotency_keys_scope_key"` // whose key it is, e.g. "user:42"
+	Key         string    `json:"key" gorm:"column:idempotency_key;size:255;not null;uniqueIndex:idx_idempotency_keys_scope_key"`
+	Fingerprint string    `json:"fingerprint" gorm:"size:64;not null"`   // SHA-256 of the method, path and body
+	StatusCode  int       `json:"status_code" gorm:"not null;default:0"` // 0 until the response is stored
+	ContentType string    `json:"content_type" gorm:"size:255"`
+	Location    string    `json:"location" gorm:"size:2048"`
+	ETag        string    `json:"etag" gorm:"column:etag;size:255"`
+	Body        []byte    `json:"-"`
+	LockedUntil time.Time `json:"locked_until"`                         // when an unfinished request stops holding the key
+	LockToken   string    `json:"-" gorm:"size:32;not null;default:''"` // identifies the request holding the key
+	ExpiresAt   time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Completed reports whether the response to the first request is stored.
+func (k *IdempotencyKey) Completed() bool {
+	return k.StatusCode != 0
+}
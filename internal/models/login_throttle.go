@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginThrottle counts recent failed logins for one key, either an account
+// ("email:<address>") or a client ("ip:<address>"). Keys are tracked
+// whether or not the account exists so responses do not reveal it.
+type LoginThrottle struct {
+	Key          string     `json:"key" gorm:"column:throttle_key;primaryKey;size:255"`
+	Failures     int        `json:"failures" gorm:"not null;default:0"`
+	LastFailedAt time.Time  `json:"last_failed_at"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
@@ -6,6 +6,14 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	ProductStatusActive   = "active"
+	ProductStatusInactive = "inactive"
+)
+
+// ProductStatuses lists every status a product can have.
+var ProductStatuses = []string{ProductStatusActive, ProductStatusInactive}
+
 type Product struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
 	Code        string         `json:"code" gorm:"uniqueIndex;size:50;not null"`
@@ -15,6 +23,7 @@ type Product struct {
 	Status      string         `json:"status" gorm:"size:20;default:'active'"`
 	UserID      uint           `json:"user_id" gorm:"not null"`
 	User        User           `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Version     uint           `json:"version" gorm:"not null;default:1"` // Bumped on every write
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// PermissionAll grants every permission.
+const PermissionAll = "*"
+
+const (
+	PermissionProductsRead      = "products:read"
+	PermissionProductsWrite     = "products:write"
+	PermissionProductsManageAny = "products:manage_any" // manage products owned by other users
+	PermissionUsersRead         = "users:read"
+	PermissionUsersWrite        = "users:write"
+	PermissionRolesRead         = "roles:read"
+	PermissionRolesWrite        = "roles:write"
+	PermissionOrdersRefund      = "orders:refund"
+)
+
+// Permissions lists every permission a role can be granted.
+var Permissions = []string{
+	PermissionProductsRead,
+	PermissionProductsWrite,
+	PermissionProductsManageAny,
+	PermissionUsersRead,
+	PermissionUsersWrite,
+	PermissionRolesRead,
+	PermissionRolesWrite,
+	PermissionOrdersRefund,
+}
+
+// RoleDefinition is a role created at runtime as a named set of permissions.
+// Built-in roles come from configuration and are never stored.
+type RoleDefinition struct {
+	ID          uint      `json:"id,omitempty" gorm:"primaryKey"`
+	Name        Role      `json:"name" gorm:"uniqueIndex;size:50;not null"`
+	Description string    `json:"description" gorm:"size:255"`
+	Permissions string    `json:"-" gorm:"size:1000"` // Space separated
+	BuiltIn     bool      `json:"built_in" gorm:"-"`
+	CreatedAt   time.Time `json:"created_at,omitzero"`
+	UpdatedAt   time.Time `json:"updated_at,omitzero"`
+}
+
+func (RoleDefinition) TableName() string {
+	return "roles"
+}
+
+func (r *RoleDefinition) PermissionList() []string {
+	return strings.Fields(r.Permissions)
+}
+
+// Grants reports whether the role includes permission.
+func (r *RoleDefinition) Grants(permission string) bool {
+	return GrantsPermission(r.PermissionList(), permission)
+}
+
+// GrantsPermission reports whether permissions include permission, either
+// directly or through PermissionAll.
+func GrantsPermission(permissions []string, permission string) bool {
+	return slices.Contains(permissions, PermissionAll) || slices.Contains(permissions, permission)
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken is a single-use refresh token. Tokens issued from the same
+// login share a FamilyID so that the whole chain can be revoked at once.
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	FamilyID  string     `json:"family_id" gorm:"index;size:64;not null"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;size:64;not null"` // SHA-256 of the token
+	AMR       string     `json:"amr" gorm:"size:64"`                    // Comma separated authentication methods of the login
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RevokedToken is a denylist entry for an access token, keyed by its jti.
+// Entries can be purged once ExpiresAt has passed.
+type RevokedToken struct {
+	JTI       string    `json:"jti" gorm:"primaryKey;size:64"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index;not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
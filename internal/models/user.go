@@ -14,13 +14,38 @@ const (
 )
 
 type User struct {
-	ID       uint   `json:"id" gorm:"primaryKey"`
-	Email    string `json:"email" gorm:"uniqueIndex;size:100;not null"`
-	Name     string `json:"name" gorm:"size:100;not null"`
-	Password string `json:"-" gorm:"size:255;not null"`                           // Hashed password
-	Role     Role   `json:"role" gorm:"type:enum('user','admin');default:'user'"` // Support for MySQL & Postgres
-	// Role      Role           `json:"role" gorm:"type:text;default:'user'"` // Support for SQLite
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Email      string     `json:"email" gorm:"uniqueIndex;size:100;not null"`
+	Name       string     `json:"name" gorm:"size:100;not null"`
+	Password   string     `json:"-" gorm:"size:255;not null"` // Hashed password
+	Role       Role       `json:"role" gorm:"size:50;default:'user'"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"` // Set once the email address is confirmed
+	// TOTP two-factor authentication. The secret is set on enrolment and
+	// only takes effect once MFAEnabledAt is set by confirming a code.
+	TOTPSecret       string         `json:"-" gorm:"size:64"`
+	TOTPLastUsedStep int64          `json:"-"` // Rejects replay of an already used code
+	MFAEnabledAt     *time.Time     `json:"mfa_enabled_at,omitempty"`
+	TokensValidAfter *time.Time     `json:"-"`                                 // Access tokens issued earlier are rejected
+	Version          uint           `json:"version" gorm:"not null;default:1"` // Bumped on every write
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+}
+
+func (u *User) IsVerified() bool {
+	return u.VerifiedAt != nil
+}
+
+func (u *User) MFAEnabled() bool {
+	return u.MFAEnabledAt != nil
+}
+
+// RecoveryCode is a one-time fallback for a lost authenticator. Only the
+// SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
 }
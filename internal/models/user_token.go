@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+type TokenPurpose string
+
+const (
+	TokenPurposePasswordReset     TokenPurpose = "password_reset"
+	TokenPurposeEmailVerification TokenPurpose = "email_verification"
+)
+
+// UserToken is a single-use token mailed to a user, e.g. for a password
+// reset or to verify an email address. Only the SHA-256 hash of the token is stored.
+type UserToken struct {
+	ID        uint         `json:"id" gorm:"primaryKey"`
+	UserID    uint         `json:"user_id" gorm:"index;not null"`
+	Purpose   TokenPurpose `json:"purpose" gorm:"size:32;not null"`
+	TokenHash string       `json:"-" gorm:"uniqueIndex;size:64;not null"`
+	ExpiresAt time.Time    `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time   `json:"used_at,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+}
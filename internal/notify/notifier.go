@@ -0,0 +1,108 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/logging"
+)
+
+// Message is a notification addressed to a single user.
+type Message struct {
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+// Notifier delivers messages to users. Implementations must be safe for
+// concurrent use.
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+func New(cfg *config.NotificationConfig) (Notifier, error) {
+	switch cfg.Driver {
+	case "", "log":
+		return &LogNotifier{}, nil
+	case "file":
+		if cfg.FilePath == "" {
+			return nil, fmt.Errorf("notifications.file_path is required for the file driver")
+		}
+		return NewFileNotifier(cfg.FilePath), nil
+	default:
+		return nil, fmt.Errorf("unsupported notification driver: %s", cfg.Driver)
+	}
+}
+
+// LogNotifier writes messages to the standard logger. Useful in development
+// where no mail server is available.
+type LogNotifier struct{}
+
+func (n *LogNotifier) Send(ctx context.Context, msg Message) error {
+	logging.FromContext(ctx).Info("Notification", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// FileNotifier appends each message as a JSON line to a file.
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) Send(ctx context.Context, msg Message) error {
+	if msg.SentAt.IsZero() {
+		msg.SentAt = time.Now()
+	}
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open notification file: %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Messages reads back every message written so far.
+func (n *FileNotifier) Messages() ([]Message, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.Open(n.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var messages []Message
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var msg Message
+		if err := dec.Decode(&msg); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
@@ -0,0 +1,39 @@
+// Package policy decides what an authenticated caller may do to a resource.
+package policy
+
+import "github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+
+// Actor is the authenticated caller a decision is made for, together with
+// the permissions their role grants.
+type Actor struct {
+	UserID      uint
+	Role        models.Role
+	Permissions []string
+}
+
+func (a Actor) Can(permission string) bool {
+	return models.GrantsPermission(a.Permissions, permission)
+}
+
+// CanManageProduct reports whether actor may update or delete product:
+// sellers manage their own products, roles with products:manage_any manage
+// all of them.
+func CanManageProduct(actor Actor, product *models.Product) bool {
+	return product.UserID == actor.UserID || actor.Can(models.PermissionProductsManageAny)
+}
+
+// CanChangeProductOwner reports whether actor may move a product to another
+// user.
+func CanChangeProductOwner(actor Actor) bool {
+	return actor.Can(models.PermissionProductsManageAny)
+}
+
+// CanViewUser reports whether actor may read the account userID.
+func CanViewUser(actor Actor, userID uint) bool {
+	return actor.UserID == userID || actor.Can(models.PermissionUsersRead)
+}
+
+// CanManageUser reports whether actor may change the account userID.
+func CanManageUser(actor Actor, userID uint) bool {
+	return actor.UserID == userID || actor.Can(models.PermissionUsersWrite)
+}
@@ -0,0 +1,156 @@
+// Package problem writes error responses as RFC 7807 problem details and
+// maps service errors to them, so every endpoint reports errors the same way.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/requestid"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/services"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// ContentType is the media type of problem details bodies.
+const ContentType = "application/problem+json"
+
+// Details is a problem details body. Code is stable and meant for programs,
+// Detail is meant for people and may change.
+type Details struct {
+	Type      string                `json:"type"`
+	Title     string                `json:"title"`
+	Status    int                   `json:"status"`
+	Detail    string                `json:"detail,omitempty"`
+	Instance  string                `json:"instance,omitempty"`
+	Code      string                `json:"code"`
+	RequestID string                `json:"request_id,omitempty"`
+	Errors    []services.FieldError `json:"errors,omitempty"`
+}
+
+// kinds maps each kind of service error to its status and the code used when
+// the error carries no more specific one.
+var kinds = []struct {
+	kind   error
+	status int
+	code   string
+}{
+	{services.ErrValidation, http.StatusBadRequest, "validation_failed"},
+	{services.ErrUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	{services.ErrForbidden, http.StatusForbidden, "forbidden"},
+	{services.ErrNotFound, http.StatusNotFound, "not_found"},
+	{services.ErrConflict, http.StatusConflict, "conflict"},
+	{services.ErrLimitReached, http.StatusUnprocessableEntity, "limit_reached"},
+	{services.ErrUnprocessable, http.StatusUnprocessableEntity, "unprocessable"},
+	{services.ErrPreconditionFailed, http.StatusPreconditionFailed, "precondition_failed"},
+	{services.ErrPreconditionRequired, http.StatusPreconditionRequired, "precondition_required"},
+}
+
+// Abort responds with a problem of status and aborts the request.
+func Abort(c *gin.Context, status int, code, detail string) {
+	write(c, &Details{Status: status, Code: code, Detail: detail})
+}
+
+// Error responds with the problem matching err and aborts the request.
+// Service errors are mapped by kind; anything else is recorded on the
+// context for the request log and reported as a 500 without its message.
+func Error(c *gin.Context, err error) {
+	for _, k := range kinds {
+		if !errors.Is(err, k.kind) {
+			continue
+		}
+		details := &Details{Status: k.status, Code: k.code, Detail: err.Error()}
+		var serviceErr *services.Error
+		if errors.As(err, &serviceErr) {
+			details.Code = serviceErr.Code
+			details.Errors = serviceErr.Fields
+		}
+		write(c, details)
+		return
+	}
+
+	c.Error(err)
+	Abort(c, http.StatusInternalServerError, "internal_error", "internal server error")
+}
+
+// BindError responds to a request body or query that could not be bound,
+// listing every rejected field.
+func BindError(c *gin.Context, err error) {
+	Error(c, bindingError(err))
+}
+
+// NoRoute responds to requests matching no route.
+func NoRoute(c *gin.Context) {
+	Abort(c, http.StatusNotFound, "route_not_found", fmt.Sprintf("no route for %s %s", c.Request.Method, c.Request.URL.Path))
+}
+
+func write(c *gin.Context, details *Details) {
+	details.Type = "about:blank"
+	details.Title = http.StatusText(details.Status)
+	details.Instance = c.Request.URL.Path
+	details.RequestID = requestid.FromContext(c.Request.Context())
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(details.Status, details)
+}
+
+// bindingError converts an error from binding a request into an
+// ErrValidation error.
+func bindingError(err error) error {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]services.FieldError, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			fields = append(fields, services.FieldError{
+				Field:   fieldErr.Field(),
+				Code:    fieldErr.Tag(),
+				Message: validation.Message(fieldErr),
+			})
+		}
+		return services.NewValidationError("request has invalid fields", fields...)
+	case errors.As(err, &typeErr):
+		return services.NewValidationError("request has invalid fields", services.FieldError{
+			Field:   typeErr.Field,
+			Code:    "type",
+			Message: "must be " + typeName(typeErr.Type),
+		})
+	case errors.Is(err, io.EOF):
+		return &services.Error{Kind: services.ErrValidation, Code: "malformed_body", Message: "request body is empty"}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return &services.Error{Kind: services.ErrValidation, Code: "malformed_body", Message: "request body is not valid JSON: " + err.Error()}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return services.NewValidationError("request has invalid fields", services.FieldError{
+			Field:   field,
+			Code:    "unknown_field",
+			Message: "is not a field that can be set",
+		})
+	}
+	return &services.Error{Kind: services.ErrValidation, Code: "malformed_request", Message: err.Error()}
+}
+
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
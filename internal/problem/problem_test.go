@@ -0,0 +1,102 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/requestid"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// respond runs handler for a POST with body and decodes the problem it wrote.
+func respond(t *testing.T, body string, handler func(c *gin.Context)) (*gin.Context, Details) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/things", strings.NewReader(body))
+	c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), "req-1"))
+	handler(c)
+
+	assert.True(t, c.IsAborted())
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	var details Details
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &details))
+	assert.Equal(t, w.Code, details.Status)
+	assert.Equal(t, "req-1", details.RequestID)
+	assert.Equal(t, "/things", details.Instance)
+	return c, details
+}
+
+func TestErrorMapsKinds(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{services.ErrProductNotFound, http.StatusNotFound, "product_not_found", "product not found"},
+		{fmt.Errorf("%w: ABC", services.ErrProductCodeTaken), http.StatusConflict, "product_code_taken", "product code is already in use: ABC"},
+		{services.ErrProductLimitReached, http.StatusUnprocessableEntity, "product_limit_reached", services.ErrProductLimitReached.Error()},
+		{services.ErrEmailNotVerified, http.StatusForbidden, "email_not_verified", "email address is not verified"},
+		{services.ErrForbidden, http.StatusForbidden, "forbidden", services.ErrForbidden.Error()},
+		{services.ErrInvalidAPIKey, http.StatusUnauthorized, "invalid_api_key", "invalid API key"},
+	}
+	for _, tt := range tests {
+		_, details := respond(t, "", func(c *gin.Context) { Error(c, tt.err) })
+		assert.Equal(t, tt.status, details.Status, tt.code)
+		assert.Equal(t, tt.code, details.Code)
+		assert.Equal(t, tt.detail, details.Detail)
+		assert.Equal(t, http.StatusText(tt.status), details.Title)
+		assert.Equal(t, "about:blank", details.Type)
+	}
+}
+
+func TestErrorHidesUnexpectedErrors(t *testing.T) {
+	err := errors.New("dial tcp 10.0.0.5:5432: connection refused")
+	c, details := respond(t, "", func(c *gin.Context) { Error(c, err) })
+	assert.Equal(t, http.StatusInternalServerError, details.Status)
+	assert.Equal(t, "internal_error", details.Code)
+	assert.NotContains(t, details.Detail, "10.0.0.5")
+	assert.Equal(t, err, c.Errors.Last().Err, "recorded for the request log")
+}
+
+func TestBindError(t *testing.T) {
+	type request struct {
+		Name  string `json:"name" binding:"required,max=5"`
+		Price uint   `json:"price" binding:"gt=0"`
+	}
+	bind := func(c *gin.Context) {
+		var req request
+		if err := c.ShouldBindJSON(&req); err != nil {
+			BindError(c, err)
+		}
+	}
+
+	_, details := respond(t, `{"name": "too long", "price": 0}`, bind)
+	assert.Equal(t, http.StatusBadRequest, details.Status)
+	assert.Equal(t, "validation_failed", details.Code)
+	assert.Equal(t, []services.FieldError{
+		{Field: "name", Code: "max", Message: "must be at most 5 characters"},
+		{Field: "price", Code: "gt", Message: "must be greater than 0"},
+	}, details.Errors)
+
+	_, details = respond(t, `{"name": "ok", "price": "free"}`, bind)
+	assert.Equal(t, []services.FieldError{{Field: "price", Code: "type", Message: "must be an integer"}}, details.Errors)
+
+	_, details = respond(t, `{"name": `, bind)
+	assert.Equal(t, "malformed_body", details.Code)
+
+	_, details = respond(t, ``, bind)
+	assert.Equal(t, "malformed_body", details.Code)
+	assert.Equal(t, "request body is empty", details.Detail)
+}
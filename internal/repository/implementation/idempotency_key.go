@@ -0,0 +1,72 @@
+package implementation
+
+import (
+	"context"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/repository/interfaces"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type idempotencyKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyKeyRepository(db *gorm.DB) interfaces.IdempotencyKeyRepository {
+	return &idempotencyKeyRepository{db: db}
+}
+
+func (r *idempotencyKeyRepository) Create(ctx context.Context, key *models.IdempotencyKey) (bool, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "scope"}, {Name: "idempotency_key"}},
+		DoNothing: true,
+	}).Create(key)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *idempotencyKeyRepository) Get(ctx context.Context, scope, key string) (*models.IdempotencyKey, error) {
+	var record models.IdempotencyKey
+	err := r.db.WithContext(ctx).Where("scope = ? AND idempotency_key = ?", scope, key).First(&record).Error
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *idempotencyKeyRepository) Relock(ctx context.Context, id uint, now, until time.Time, token string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.IdempotencyKey{}).
+		Where("id = ? AND status_code = 0 AND locked_until < ?", id, now).
+		Updates(map[string]interface{}{"locked_until": until, "lock_token": token})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *idempotencyKeyRepository) Complete(ctx context.Context, key *models.IdempotencyKey) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.IdempotencyKey{}).
+		Where("id = ? AND status_code = 0 AND lock_token = ?", key.ID, key.LockToken).
+		Updates(map[string]interface{}{
+			"status_code":  key.StatusCode,
+			"content_type": key.ContentType,
+			"location":     key.Location,
+			"etag":         key.ETag,
+			"body":         key.Body,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *idempotencyKeyRepository) Unlock(ctx context.Context, key *models.IdempotencyKey) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Where("id = ? AND status_code = 0 AND lock_token = ?", key.ID, key.LockToken).
+		Delete(&models.IdempotencyKey{})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *idempotencyKeyRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.IdempotencyKey{}, id).Error
+}
+
+func (r *idempotencyKeyRepository) DeleteExpired(ctx context.Context, before time.Time) error {
+	return r.db.WithContext(ctx).Where("expires_at < ?", before).Delete(&models.IdempotencyKey{}).Error
+}
@@ -0,0 +1,53 @@
+package implementation
+
+import (
+	"context"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/repository/interfaces"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type loginThrottleRepository struct {
+	db *gorm.DB
+}
+
+func NewLoginThrottleRepository(db *gorm.DB) interfaces.LoginThrottleRepository {
+	return &loginThrottleRepository{db: db}
+}
+
+func (r *loginThrottleRepository) Get(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	err := r.db.WithContext(ctx).Where("throttle_key = ?", key).First(&throttle).Error
+	if err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+func (r *loginThrottleRepository) IncrementFailures(ctx context.Context, key string, failedAt time.Time) (*models.LoginThrottle, error) {
+	db := r.db.WithContext(ctx)
+	err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "throttle_key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures":       gorm.Expr("failures + 1"),
+			"last_failed_at": failedAt,
+			"updated_at":     failedAt,
+		}),
+	}).Create(&models.LoginThrottle{Key: key, Failures: 1, LastFailedAt: failedAt}).Error
+	if err != nil {
+		return nil, err
+	}
+	return r.Get(ctx, key)
+}
+
+func (r *loginThrottleRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.LoginThrottle{}).Where("throttle_key = ?", key).Update("locked_until", until).Error
+}
+
+func (r *loginThrottleRepository) Reset(ctx context.Context, key string) error {
+	return r.db.WithContext(ctx).Where("throttle_key = ?", key).Delete(&models.LoginThrottle{}).Error
+}
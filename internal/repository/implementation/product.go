@@ -76,13 +76,23 @@ func (r *productRepository) List(ctx context.Context, filter *models.ProductFilt
 }
 
 func (r *productRepository) Update(ctx context.Context, id uint, updates map[string]interface{}) error {
-	return r.db.WithContext(ctx).Model(&models.Product{}).Where("id = ?", id).Updates(updates).Error
+	return r.db.WithContext(ctx).Model(&models.Product{}).Where("id = ?", id).Updates(withNextVersion(updates)).Error
+}
+
+func (r *productRepository) UpdateIfVersion(ctx context.Context, id, version uint, updates map[string]interface{}) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.Product{}).Where("id = ? AND version = ?", id, version).Updates(withNextVersion(updates))
+	return result.RowsAffected == 1, result.Error
 }
 
 func (r *productRepository) Delete(ctx context.Context, id uint) error {
 	return r.db.WithContext(ctx).Delete(&models.Product{}, id).Error
 }
 
+func (r *productRepository) DeleteIfVersion(ctx context.Context, id, version uint) (bool, error) {
+	result := r.db.WithContext(ctx).Where("version = ?", version).Delete(&models.Product{}, id)
+	return result.RowsAffected == 1, result.Error
+}
+
 func (r *productRepository) GetByUserID(ctx context.Context, userID uint, pagination *models.PaginationParams) ([]*models.Product, int64, error) {
 	query := r.db.WithContext(ctx).Model(&models.Product{}).Where("user_id = ?", userID)
 
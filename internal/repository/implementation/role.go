@@ -0,0 +1,51 @@
+package implementation
+
+import (
+	"context"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/repository/interfaces"
+
+	"gorm.io/gorm"
+)
+
+type roleRepository struct {
+	db *gorm.DB
+}
+
+func NewRoleRepository(db *gorm.DB) interfaces.RoleRepository {
+	return &roleRepository{db: db}
+}
+
+func (r *roleRepository) Create(ctx context.Context, role *models.RoleDefinition) error {
+	return r.db.WithContext(ctx).Create(role).Error
+}
+
+func (r *roleRepository) GetByName(ctx context.Context, name models.Role) (*models.RoleDefinition, error) {
+	var role models.RoleDefinition
+	err := r.db.WithContext(ctx).Where("name = ?", name).First(&role).Error
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *roleRepository) List(ctx context.Context) ([]*models.RoleDefinition, error) {
+	var roles []*models.RoleDefinition
+	err := r.db.WithContext(ctx).Order("name").Find(&roles).Error
+	return roles, err
+}
+
+func (r *roleRepository) Update(ctx context.Context, name models.Role, updates map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(&models.RoleDefinition{}).Where("name = ?", name).Updates(updates).Error
+}
+
+func (r *roleRepository) Delete(ctx context.Context, name models.Role) error {
+	return r.db.WithContext(ctx).Where("name = ?", name).Delete(&models.RoleDefinition{}).Error
+}
+
+func (r *roleRepository) CountUsers(ctx context.Context, name models.Role) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.User{}).Where("role = ?", name).Count(&count).Error
+	return count, err
+}
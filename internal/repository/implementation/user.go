@@ -67,9 +67,26 @@ func (r *userRepository) List(ctx context.Context, filter *models.User, paginati
 }
 
 func (r *userRepository) Update(ctx context.Context, id uint, updates map[string]interface{}) error {
-	return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Updates(updates).Error
+	return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Updates(withNextVersion(updates)).Error
+}
+
+func (r *userRepository) UpdateIfVersion(ctx context.Context, id, version uint, updates map[string]interface{}) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.User{}).Where("id = ? AND version = ?", id, version).Updates(withNextVersion(updates))
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *userRepository) RecordTOTPStep(ctx context.Context, id uint, step int64) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND totp_last_used_step < ?", id, step).
+		Updates(withNextVersion(map[string]interface{}{"totp_last_used_step": step}))
+	return result.RowsAffected == 1, result.Error
 }
 
 func (r *userRepository) Delete(ctx context.Context, id uint) error {
 	return r.db.WithContext(ctx).Delete(&models.User{}, id).Error
 }
+
+func (r *userRepository) DeleteIfVersion(ctx context.Context, id, version uint) (bool, error) {
+	result := r.db.WithContext(ctx).Where("version = ?", version).Delete(&models.User{}, id)
+	return result.RowsAffected == 1, result.Error
+}
@@ -0,0 +1,14 @@
+package implementation
+
+import "gorm.io/gorm"
+
+// withNextVersion returns updates plus a bump of the version column, which
+// every write to a versioned model makes so ETags and UpdateIfVersion see it.
+func withNextVersion(updates map[string]interface{}) map[string]interface{} {
+	next := make(map[string]interface{}, len(updates)+1)
+	for column, value := range updates {
+		next[column] = value
+	}
+	next["version"] = gorm.Expr("version + 1")
+	return next
+}
@@ -0,0 +1,17 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+)
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *models.APIKey) error
+	GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	ListByUser(ctx context.Context, userID uint) ([]*models.APIKey, error)
+	// Revoke reports whether an active key with id owned by userID was revoked.
+	Revoke(ctx context.Context, id, userID uint) (bool, error)
+	UpdateLastUsed(ctx context.Context, id uint, usedAt time.Time) error
+}
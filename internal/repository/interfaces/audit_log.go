@@ -0,0 +1,11 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+)
+
+type AuditLogRepository interface {
+	Create(ctx context.Context, entry *models.AuditLog) error
+}
@@ -0,0 +1,26 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+)
+
+type IdempotencyKeyRepository interface {
+	// Create stores key unless its scope already has one with the same key,
+	// and reports whether it did. This is what locks a key.
+	Create(ctx context.Context, key *models.IdempotencyKey) (bool, error)
+	Get(ctx context.Context, scope, key string) (*models.IdempotencyKey, error)
+	// Relock hands the lock of an unfinished key to token until until if it
+	// expired before now, and reports whether this call took the key over.
+	Relock(ctx context.Context, id uint, now, until time.Time, token string) (bool, error)
+	// Complete stores the response held in key if key.LockToken still holds
+	// the key, and reports whether it did.
+	Complete(ctx context.Context, key *models.IdempotencyKey) (bool, error)
+	// Unlock deletes key if key.LockToken still holds it, and reports
+	// whether it did.
+	Unlock(ctx context.Context, key *models.IdempotencyKey) (bool, error)
+	Delete(ctx context.Context, id uint) error
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
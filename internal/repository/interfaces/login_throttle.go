@@ -0,0 +1,17 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+)
+
+type LoginThrottleRepository interface {
+	Get(ctx context.Context, key string) (*models.LoginThrottle, error)
+	// IncrementFailures atomically adds a failure for key and returns the
+	// updated record, creating it if needed.
+	IncrementFailures(ctx context.Context, key string, failedAt time.Time) (*models.LoginThrottle, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
@@ -10,7 +10,14 @@ type ProductRepository interface {
 	GetByID(ctx context.Context, id uint) (*models.Product, error)
 	GetByCode(ctx context.Context, code string) (*models.Product, error)
 	List(ctx context.Context, filter *models.ProductFilter, pagination *models.PaginationParams) ([]*models.Product, int64, error)
+	// Update applies updates to the product and bumps its version.
 	Update(ctx context.Context, id uint, updates map[string]interface{}) error
+	// UpdateIfVersion is Update for a product still at version, and reports
+	// whether it was.
+	UpdateIfVersion(ctx context.Context, id, version uint, updates map[string]interface{}) (bool, error)
 	Delete(ctx context.Context, id uint) error
+	// DeleteIfVersion is Delete for a product still at version, and reports
+	// whether it was.
+	DeleteIfVersion(ctx context.Context, id, version uint) (bool, error)
 	GetByUserID(ctx context.Context, userID uint, pagination *models.PaginationParams) ([]*models.Product, int64, error)
 }
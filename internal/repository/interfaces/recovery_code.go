@@ -0,0 +1,16 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+)
+
+type RecoveryCodeRepository interface {
+	// ReplaceForUser deletes the user's existing codes and stores codes.
+	ReplaceForUser(ctx context.Context, userID uint, codes []*models.RecoveryCode) error
+	GetUnusedByHash(ctx context.Context, userID uint, hash string) (*models.RecoveryCode, error)
+	// MarkUsed reports whether this call consumed the code.
+	MarkUsed(ctx context.Context, id uint) (bool, error)
+	DeleteForUser(ctx context.Context, userID uint) error
+}
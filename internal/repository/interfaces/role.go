@@ -0,0 +1,17 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+)
+
+type RoleRepository interface {
+	Create(ctx context.Context, role *models.RoleDefinition) error
+	GetByName(ctx context.Context, name models.Role) (*models.RoleDefinition, error)
+	List(ctx context.Context) ([]*models.RoleDefinition, error)
+	Update(ctx context.Context, name models.Role, updates map[string]interface{}) error
+	Delete(ctx context.Context, name models.Role) error
+	// CountUsers returns how many users currently hold the role.
+	CountUsers(ctx context.Context, name models.Role) (int64, error)
+}
@@ -0,0 +1,23 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+)
+
+type TokenRepository interface {
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error)
+	// RevokeRefreshToken reports whether this call revoked the token, so a
+	// concurrent second use of the same token can be detected.
+	RevokeRefreshToken(ctx context.Context, id uint) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID uint) error
+	// RevokeAccessToken reports whether this call revoked the token, so a
+	// single-use token can be consumed atomically.
+	RevokeAccessToken(ctx context.Context, token *models.RevokedToken) (bool, error)
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
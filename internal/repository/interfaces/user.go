@@ -10,6 +10,17 @@ type UserRepository interface {
 	GetByID(ctx context.Context, id uint) (*models.User, error)
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
 	List(ctx context.Context, filter *models.User, pagination *models.PaginationParams) ([]*models.User, int64, error)
+	// Update applies updates to the user and bumps its version.
 	Update(ctx context.Context, id uint, updates map[string]interface{}) error
+	// UpdateIfVersion is Update for a user still at version, and reports
+	// whether it was.
+	UpdateIfVersion(ctx context.Context, id, version uint, updates map[string]interface{}) (bool, error)
+	// RecordTOTPStep stores step as the last used TOTP step unless the stored
+	// one is already as late, and reports whether it did, so a code cannot be
+	// used twice by concurrent requests.
+	RecordTOTPStep(ctx context.Context, id uint, step int64) (bool, error)
 	Delete(ctx context.Context, id uint) error
+	// DeleteIfVersion is Delete for a user still at version, and reports
+	// whether it was.
+	DeleteIfVersion(ctx context.Context, id, version uint) (bool, error)
 }
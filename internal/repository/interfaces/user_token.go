@@ -0,0 +1,15 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+)
+
+type UserTokenRepository interface {
+	Create(ctx context.Context, token *models.UserToken) error
+	GetByHash(ctx context.Context, purpose models.TokenPurpose, hash string) (*models.UserToken, error)
+	// MarkUsed reports whether this call consumed the token.
+	MarkUsed(ctx context.Context, id uint) (bool, error)
+	InvalidateForUser(ctx context.Context, userID uint, purpose models.TokenPurpose) error
+}
@@ -0,0 +1,53 @@
+// Package requestid carries the ID correlating a request's logs, queries and
+// response through context.Context.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Header is the HTTP header a request ID is accepted from and echoed in.
+const Header = "X-Request-ID"
+
+// MaxLength is the longest request ID accepted from a client.
+const MaxLength = 128
+
+type contextKey struct{}
+
+// New returns a random 32 character hex ID.
+func New() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Valid reports whether an ID sent by a client can be used as is. Only
+// letters, digits and "-", "_", ".", ":" are allowed, so the ID is safe to
+// put into log lines, headers and SQL comments.
+func Valid(id string) bool {
+	if id == "" || len(id) > MaxLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID in ctx, or "" if there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,24 @@
+package requestid
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValid(t *testing.T) {
+	for _, id := range []string{"abc", "3f2b9c1e-8d4a-4f6b-9e2a-1c5d7e9f0a2b", "trace:span.1_2", strings.Repeat("a", MaxLength)} {
+		assert.True(t, Valid(id), id)
+	}
+	for _, id := range []string{"", "has space", "*/ DROP TABLE users; /*", "quote'", "new\nline", strings.Repeat("a", MaxLength+1)} {
+		assert.False(t, Valid(id), id)
+	}
+	assert.True(t, Valid(New()))
+}
+
+func TestContext(t *testing.T) {
+	assert.Empty(t, FromContext(context.Background()))
+	assert.Equal(t, "abc", FromContext(NewContext(context.Background(), "abc")))
+}
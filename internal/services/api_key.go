@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/repository/interfaces"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/tracing"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAPIKey  = newError(ErrUnauthorized, "invalid_api_key", "invalid API key")
+	ErrAPIKeyNotFound = newError(ErrNotFound, "api_key_not_found", "API key not found")
+	ErrInvalidScope   = newError(ErrValidation, "invalid_scope", "invalid API key scope")
+)
+
+// APIKeyScopes are the scopes a key can be restricted to. A request needs
+// "<resource>:read" for safe methods and "<resource>:write" otherwise; a key
+// created without scopes is read-only.
+var APIKeyScopes = []string{
+	models.PermissionProductsRead,
+	models.PermissionProductsWrite,
+	models.PermissionUsersRead,
+	models.PermissionUsersWrite,
+	models.PermissionRolesRead,
+	models.PermissionRolesWrite,
+}
+
+// lastUsedResolution limits how often LastUsedAt is written for busy keys.
+const lastUsedResolution = time.Minute
+
+type APIKeyService struct {
+	repo     interfaces.APIKeyRepository
+	userRepo interfaces.UserRepository
+}
+
+func NewAPIKeyService(repo interfaces.APIKeyRepository, userRepo interfaces.UserRepository) *APIKeyService {
+	return &APIKeyService{repo: repo, userRepo: userRepo}
+}
+
+// CreateKey stores a new key for userID and returns it together with the
+// plain text key, which cannot be recovered later.
+func (s *APIKeyService) CreateKey(ctx context.Context, userID uint, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.CreateKey")
+	defer span.End()
+
+	for _, scope := range scopes {
+		if !slices.Contains(APIKeyScopes, scope) {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+
+	// Keys are looked up by a unique prefix, so it must be long enough that
+	// two keys never draw the same one
+	prefix, err := randomHex(8)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate key prefix: %w", err)
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	key := &models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   hashToken(secret),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.repo.Create(ctx, key); err != nil {
+		return nil, "", fmt.Errorf("failed to store API key: %w", err)
+	}
+
+	return key, models.APIKeyPrefix + prefix + "_" + secret, nil
+}
+
+func (s *APIKeyService) ListKeys(ctx context.Context, userID uint) ([]*models.APIKey, error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.ListKeys")
+	defer span.End()
+
+	return s.repo.ListByUser(ctx, userID)
+}
+
+func (s *APIKeyService) RevokeKey(ctx context.Context, userID, id uint) error {
+	ctx, span := tracing.Start(ctx, "APIKeyService.RevokeKey")
+	defer span.End()
+
+	revoked, err := s.repo.Revoke(ctx, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if !revoked {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate resolves a plain text key to its key record and owner.
+func (s *APIKeyService) Authenticate(ctx context.Context, rawKey string) (*models.APIKey, *models.User, error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.Authenticate")
+	defer span.End()
+
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(rawKey, models.APIKeyPrefix), "_")
+	if !ok || !strings.HasPrefix(rawKey, models.APIKeyPrefix) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.repo.GetByPrefix(ctx, prefix)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(key.KeyHash)) != 1 || !key.IsActive(now) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.userRepo.GetByID(ctx, key.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		if err := s.repo.UpdateLastUsed(ctx, key.ID, now); err != nil {
+			return nil, nil, fmt.Errorf("failed to record API key use: %w", err)
+		}
+		key.LastUsedAt = &now
+	}
+
+	return key, user, nil
+}
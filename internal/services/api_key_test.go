@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type MockAPIKeyRepository struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepository) GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	args := m.Called(ctx, prefix)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) ListByUser(ctx context.Context, userID uint) ([]*models.APIKey, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]*models.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) Revoke(ctx context.Context, id, userID uint) (bool, error) {
+	args := m.Called(ctx, id, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) UpdateLastUsed(ctx context.Context, id uint, usedAt time.Time) error {
+	args := m.Called(ctx, id, usedAt)
+	return args.Error(0)
+}
+
+func TestAPIKeyService_CreateAndAuthenticate(t *testing.T) {
+	mockRepo := new(MockAPIKeyRepository)
+	mockUserRepo := new(MockUserRepository)
+	service := NewAPIKeyService(mockRepo, mockUserRepo)
+
+	var stored *models.APIKey
+	mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.APIKey")).
+		Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*models.APIKey)
+			stored.ID = 4
+		}).Return(nil)
+
+	key, rawKey, err := service.CreateKey(context.Background(), 1, "ci", []string{"products:read"}, nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(rawKey, models.APIKeyPrefix+key.Prefix+"_"))
+	assert.Len(t, key.Prefix, 16)
+	assert.NotContains(t, stored.KeyHash, strings.TrimPrefix(rawKey, models.APIKeyPrefix+key.Prefix+"_"))
+
+	mockRepo.On("GetByPrefix", mock.Anything, key.Prefix).Return(stored, nil)
+	mockUserRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.User{ID: 1, Role: models.RoleUser}, nil)
+	mockRepo.On("UpdateLastUsed", mock.Anything, uint(4), mock.Anything).Return(nil).Once()
+
+	authKey, user, err := service.Authenticate(context.Background(), rawKey)
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), user.ID)
+	assert.True(t, authKey.Allows("products:read"))
+	assert.False(t, authKey.Allows("products:write"))
+	assert.True(t, (&models.APIKey{}).Allows("products:read"), "keys without scopes can read")
+	assert.False(t, (&models.APIKey{}).Allows("products:write"), "but not write")
+
+	// A second use within the minute does not write LastUsedAt again
+	_, _, err = service.Authenticate(context.Background(), rawKey)
+	require.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+
+	_, _, err = service.Authenticate(context.Background(), rawKey+"x")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+}
+
+func TestAPIKeyService_RejectsInactiveKeys(t *testing.T) {
+	mockRepo := new(MockAPIKeyRepository)
+	service := NewAPIKeyService(mockRepo, new(MockUserRepository))
+
+	past := time.Now().Add(-time.Hour)
+	mockRepo.On("GetByPrefix", mock.Anything, "expired0").Return(&models.APIKey{KeyHash: hashToken("secret"), ExpiresAt: &past}, nil)
+	mockRepo.On("GetByPrefix", mock.Anything, "revoked0").Return(&models.APIKey{KeyHash: hashToken("secret"), RevokedAt: &past}, nil)
+	mockRepo.On("GetByPrefix", mock.Anything, "unknown0").Return(nil, gorm.ErrRecordNotFound)
+
+	for _, rawKey := range []string{"mk_expired0_secret", "mk_revoked0_secret", "mk_unknown0_secret", "not-a-key"} {
+		_, _, err := service.Authenticate(context.Background(), rawKey)
+		assert.ErrorIs(t, err, ErrInvalidAPIKey, rawKey)
+	}
+}
+
+func TestAPIKeyService_RejectsUnknownScope(t *testing.T) {
+	service := NewAPIKeyService(new(MockAPIKeyRepository), new(MockUserRepository))
+
+	_, _, err := service.CreateKey(context.Background(), 1, "ci", []string{"everything"}, nil)
+
+	assert.ErrorIs(t, err, ErrInvalidScope)
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/logging"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/policy"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/repository/interfaces"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/tracing"
+)
+
+type AuditService struct {
+	repo interfaces.AuditLogRepository
+}
+
+func NewAuditService(repo interfaces.AuditLogRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record stores an audit entry. Failing to write one is logged rather than
+// returned so it never changes the outcome of the request being audited.
+func (s *AuditService) Record(ctx context.Context, actor policy.Actor, action, resource string, resourceID uint, outcome models.AuditOutcome) {
+	ctx, span := tracing.Start(ctx, "AuditService.Record")
+	defer span.End()
+
+	entry := &models.AuditLog{
+		ActorID:    actor.UserID,
+		ActorRole:  actor.Role,
+		Action:     action,
+		Resource:   resource,
+		ResourceID: resourceID,
+		Outcome:    outcome,
+	}
+	if err := s.repo.Create(ctx, entry); err != nil {
+		logging.FromContext(ctx).Error("Failed to write audit log", "action", action, "resource", resource, "resource_id", resourceID, "actor_id", actor.UserID, "error", err)
+	}
+}
@@ -1,68 +1,406 @@
 package services
 
 import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
     "errors"
+    "fmt"
+    "slices"
+    "strings"
+    "sync"
     "time"
 
     "github.com/golang-jwt/jwt/v5"
+    "github.com/prometheus/client_golang/prometheus"
     "golang.org/x/crypto/bcrypt"
     "github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+    "github.com/MikeTeddyOmondi/marketplace-api/internal/metrics"
     "github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+    "github.com/MikeTeddyOmondi/marketplace-api/internal/repository/interfaces"
+    "github.com/MikeTeddyOmondi/marketplace-api/internal/signing"
+    "github.com/MikeTeddyOmondi/marketplace-api/internal/tracing"
+
+    "gorm.io/gorm"
+)
+
+var (
+    ErrInvalidRefreshToken = newError(ErrUnauthorized, "invalid_refresh_token", "invalid refresh token")
+    ErrRefreshTokenReused  = newError(ErrUnauthorized, "refresh_token_reused", "refresh token reuse detected")
+    ErrInvalidMFAChallenge = newError(ErrUnauthorized, "invalid_mfa_challenge", "invalid or expired MFA challenge")
+    ErrInvalidToken        = newError(ErrUnauthorized, "invalid_token", "invalid token")
+    ErrSessionRevoked      = newError(ErrUnauthorized, "session_revoked", "signed out by a password change, sign in again")
 )
 
+// Authentication method references (RFC 8176) recorded in the amr claim.
+const (
+    AMRPassword = "pwd"
+    AMROTP      = "otp"
+    AMRMFA      = "mfa"
+)
+
+// purposeMFAChallenge marks the short-lived token handed out between the
+// password and the TOTP step of a login. It is not an access token.
+const purposeMFAChallenge = "mfa_challenge"
+
 type AuthService struct {
-    jwtSecret    string
-    tokenExpiry  time.Duration
-    passwordCost int
+    userRepo           interfaces.UserRepository
+    tokenRepo          interfaces.TokenRepository
+    keys               *signing.KeySet
+    accessTokenExpiry  time.Duration
+    refreshTokenExpiry time.Duration
+    mfaChallengeExpiry time.Duration
+    passwordCost       int
+
+    dummyHashOnce sync.Once
+    dummyHash     string
 }
 
-func NewAuthService(constants *config.Constants) *AuthService {
+func NewAuthService(userRepo interfaces.UserRepository, tokenRepo interfaces.TokenRepository, keys *signing.KeySet, constants *config.Constants) *AuthService {
     return &AuthService{
-        jwtSecret:    constants.Auth.JWTSecret,
-        tokenExpiry:  time.Duration(constants.Auth.TokenExpiration) * time.Hour,
-        passwordCost: constants.Auth.PasswordCost,
+        userRepo:           userRepo,
+        tokenRepo:          tokenRepo,
+        keys:               keys,
+        accessTokenExpiry:  time.Duration(constants.Auth.AccessTokenExpiration) * time.Minute,
+        refreshTokenExpiry: time.Duration(constants.Auth.RefreshTokenExpiration) * time.Hour,
+        mfaChallengeExpiry: time.Duration(constants.Auth.MFA.ChallengeExpiration) * time.Minute,
+        passwordCost:       constants.Auth.PasswordCost,
     }
 }
 
 type Claims struct {
-    UserID uint        `json:"user_id"`
-    Role   models.Role `json:"role"`
+    UserID  uint        `json:"user_id"`
+    Role    models.Role `json:"role"`
+    AMR     []string    `json:"amr,omitempty"`
+    Purpose string      `json:"purpose,omitempty"`
     jwt.RegisteredClaims
 }
 
+// HasMFA reports whether the token was issued after a second factor.
+func (c *Claims) HasMFA() bool {
+    return slices.Contains(c.AMR, AMRMFA)
+}
+
+// TokenPair is what a successful login or refresh hands back to the client.
+type TokenPair struct {
+    AccessToken  string
+    RefreshToken string
+    ExpiresAt    time.Time
+}
+
 func (s *AuthService) GenerateToken(user *models.User) (string, error) {
-    expirationTime := time.Now().Add(s.tokenExpiry)
+    token, _, err := s.generateAccessToken(user, []string{AMRPassword})
+    return token, err
+}
+
+func (s *AuthService) generateAccessToken(user *models.User, amr []string) (string, time.Time, error) {
+    return s.signToken(user, amr, "", s.accessTokenExpiry)
+}
+
+func (s *AuthService) signToken(user *models.User, amr []string, purpose string, expiry time.Duration) (string, time.Time, error) {
+    jti, err := randomHex(16)
+    if err != nil {
+        return "", time.Time{}, err
+    }
+    now := time.Now()
+    expirationTime := now.Add(expiry)
     claims := &Claims{
-        UserID: user.ID,
-        Role:   user.Role,
+        UserID:  user.ID,
+        Role:    user.Role,
+        AMR:     amr,
+        Purpose: purpose,
         RegisteredClaims: jwt.RegisteredClaims{
+            ID:        jti,
+            IssuedAt:  jwt.NewNumericDate(now),
             ExpiresAt: jwt.NewNumericDate(expirationTime),
             Subject:   user.Email,
         },
     }
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    return token.SignedString([]byte(s.jwtSecret))
+    signed, err := s.keys.Sign(claims)
+    return signed, expirationTime, err
 }
 
-func (s *AuthService) ValidateToken(tokenString string) (*Claims, error) {
-    token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-        return []byte(s.jwtSecret), nil
-    })
+// ValidateToken verifies an access token and checks that it was issued
+// after the owner's sessions were last revoked.
+func (s *AuthService) ValidateToken(ctx context.Context, tokenString string) (*Claims, error) {
+    ctx, span := tracing.Start(ctx, "AuthService.ValidateToken")
+    defer span.End()
+
+    claims, err := s.parseToken(tokenString)
+    if err != nil || claims.Purpose != "" {
+        return nil, ErrInvalidToken
+    }
+    user, err := s.userRepo.GetByID(ctx, claims.UserID)
+    if err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrInvalidToken
+        }
+        return nil, fmt.Errorf("failed to get token owner: %w", err)
+    }
+    if user.TokensValidAfter != nil && (claims.IssuedAt == nil || claims.IssuedAt.Before(*user.TokensValidAfter)) {
+        return nil, ErrSessionRevoked
+    }
+    return claims, nil
+}
+
+func (s *AuthService) parseToken(tokenString string) (*Claims, error) {
+    token, err := s.keys.Parse(tokenString, &Claims{})
     if err != nil {
         return nil, err
     }
-    if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+    // Tokens without a jti cannot be revoked, so they are not accepted.
+    if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.ID != "" {
         return claims, nil
     }
     return nil, errors.New("invalid token")
 }
 
+// GenerateMFAChallenge issues the token a client exchanges, together with a
+// TOTP or recovery code, for a full session once the password was accepted.
+func (s *AuthService) GenerateMFAChallenge(user *models.User) (string, error) {
+    token, _, err := s.signToken(user, []string{AMRPassword}, purposeMFAChallenge, s.mfaChallengeExpiry)
+    return token, err
+}
+
+// ConsumeMFAChallenge verifies an MFA challenge and revokes it in the same
+// step, before any code is checked, so each challenge allows one guess even
+// when requests race.
+func (s *AuthService) ConsumeMFAChallenge(ctx context.Context, tokenString string) (*Claims, error) {
+    ctx, span := tracing.Start(ctx, "AuthService.ConsumeMFAChallenge")
+    defer span.End()
+
+    claims, err := s.parseToken(tokenString)
+    if err != nil || claims.Purpose != purposeMFAChallenge {
+        return nil, ErrInvalidMFAChallenge
+    }
+    consumed, err := s.revokeAccessToken(ctx, claims)
+    if err != nil {
+        return nil, fmt.Errorf("failed to consume MFA challenge: %w", err)
+    }
+    if !consumed {
+        return nil, ErrInvalidMFAChallenge
+    }
+    return claims, nil
+}
+
+// IssueTokens starts a new session for user: a short-lived access token and
+// the first refresh token of a new family. amr lists how the user
+// authenticated and is carried over to refreshed tokens.
+func (s *AuthService) IssueTokens(ctx context.Context, user *models.User, amr []string) (*TokenPair, error) {
+    ctx, span := tracing.Start(ctx, "AuthService.IssueTokens")
+    defer span.End()
+
+    familyID, err := randomHex(16)
+    if err != nil {
+        return nil, err
+    }
+    return s.issueTokens(ctx, user, familyID, amr)
+}
+
+func (s *AuthService) issueTokens(ctx context.Context, user *models.User, familyID string, amr []string) (*TokenPair, error) {
+    accessToken, expiresAt, err := s.generateAccessToken(user, amr)
+    if err != nil {
+        return nil, fmt.Errorf("failed to generate access token: %w", err)
+    }
+
+    refreshToken, err := randomToken(32)
+    if err != nil {
+        return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+    }
+    err = s.tokenRepo.CreateRefreshToken(ctx, &models.RefreshToken{
+        UserID:    user.ID,
+        FamilyID:  familyID,
+        TokenHash: hashToken(refreshToken),
+        AMR:       strings.Join(amr, ","),
+        ExpiresAt: time.Now().Add(s.refreshTokenExpiry),
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to store refresh token: %w", err)
+    }
+
+    return &TokenPair{
+        AccessToken:  accessToken,
+        RefreshToken: refreshToken,
+        ExpiresAt:    expiresAt,
+    }, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new token pair. Each refresh
+// token can be used once; presenting one that was already used revokes its
+// whole family, since that means it has been copied.
+func (s *AuthService) RefreshTokens(ctx context.Context, refreshToken string) (*TokenPair, error) {
+    ctx, span := tracing.Start(ctx, "AuthService.RefreshTokens")
+    defer span.End()
+
+    stored, err := s.tokenRepo.GetRefreshTokenByHash(ctx, hashToken(refreshToken))
+    if err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrInvalidRefreshToken
+        }
+        return nil, fmt.Errorf("failed to get refresh token: %w", err)
+    }
+
+    if stored.RevokedAt != nil {
+        if err := s.tokenRepo.RevokeFamily(ctx, stored.FamilyID); err != nil {
+            return nil, fmt.Errorf("failed to revoke token family: %w", err)
+        }
+        return nil, ErrRefreshTokenReused
+    }
+    if time.Now().After(stored.ExpiresAt) {
+        return nil, ErrInvalidRefreshToken
+    }
+
+    revoked, err := s.tokenRepo.RevokeRefreshToken(ctx, stored.ID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to revoke refresh token: %w", err)
+    }
+    if !revoked {
+        // Lost a race with another request presenting the same token.
+        if err := s.tokenRepo.RevokeFamily(ctx, stored.FamilyID); err != nil {
+            return nil, fmt.Errorf("failed to revoke token family: %w", err)
+        }
+        return nil, ErrRefreshTokenReused
+    }
+
+    user, err := s.userRepo.GetByID(ctx, stored.UserID)
+    if err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrInvalidRefreshToken
+        }
+        return nil, fmt.Errorf("failed to get user: %w", err)
+    }
+
+    var amr []string
+    if stored.AMR != "" {
+        amr = strings.Split(stored.AMR, ",")
+    }
+    return s.issueTokens(ctx, user, stored.FamilyID, amr)
+}
+
+// Logout denylists the presented access token and, if a refresh token is
+// given, revokes its whole family.
+func (s *AuthService) Logout(ctx context.Context, claims *Claims, refreshToken string) error {
+    ctx, span := tracing.Start(ctx, "AuthService.Logout")
+    defer span.End()
+
+    if refreshToken != "" {
+        stored, err := s.tokenRepo.GetRefreshTokenByHash(ctx, hashToken(refreshToken))
+        if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+            return fmt.Errorf("failed to get refresh token: %w", err)
+        }
+        if stored != nil && stored.UserID == claims.UserID {
+            if err := s.tokenRepo.RevokeFamily(ctx, stored.FamilyID); err != nil {
+                return fmt.Errorf("failed to revoke token family: %w", err)
+            }
+        }
+    }
+
+    return s.RevokeAccessToken(ctx, claims)
+}
+
+func (s *AuthService) RevokeAccessToken(ctx context.Context, claims *Claims) error {
+    ctx, span := tracing.Start(ctx, "AuthService.RevokeAccessToken")
+    defer span.End()
+
+    _, err := s.revokeAccessToken(ctx, claims)
+    return err
+}
+
+// revokeAccessToken denylists the token's jti until it expires and reports
+// whether this call did so.
+func (s *AuthService) revokeAccessToken(ctx context.Context, claims *Claims) (bool, error) {
+    expiresAt := time.Now().Add(s.accessTokenExpiry)
+    if claims.ExpiresAt != nil {
+        expiresAt = claims.ExpiresAt.Time
+    }
+    return s.tokenRepo.RevokeAccessToken(ctx, &models.RevokedToken{
+        JTI:       claims.ID,
+        ExpiresAt: expiresAt,
+    })
+}
+
+// RevokeUserSessions signs userID out everywhere: every refresh token is
+// revoked and access tokens issued before now are no longer accepted.
+func (s *AuthService) RevokeUserSessions(ctx context.Context, userID uint) error {
+    ctx, span := tracing.Start(ctx, "AuthService.RevokeUserSessions")
+    defer span.End()
+
+    // iat has second precision, so truncate to keep tokens issued right after
+    // this, e.g. by signing in again, valid.
+    validAfter := time.Now().UTC().Truncate(time.Second)
+    if err := s.userRepo.Update(ctx, userID, map[string]interface{}{"tokens_valid_after": validAfter}); err != nil {
+        return fmt.Errorf("failed to revoke access tokens: %w", err)
+    }
+    return s.tokenRepo.RevokeUserRefreshTokens(ctx, userID)
+}
+
+func (s *AuthService) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+    ctx, span := tracing.Start(ctx, "AuthService.IsTokenRevoked")
+    defer span.End()
+
+    return s.tokenRepo.IsAccessTokenRevoked(ctx, jti)
+}
+
+// PurgeExpiredTokens removes denylist entries and refresh tokens that can no
+// longer be used.
+func (s *AuthService) PurgeExpiredTokens(ctx context.Context) error {
+    ctx, span := tracing.Start(ctx, "AuthService.PurgeExpiredTokens")
+    defer span.End()
+
+    return s.tokenRepo.DeleteExpired(ctx, time.Now())
+}
+
+// JWKS returns the public signing keys for other services to verify tokens.
+func (s *AuthService) JWKS() signing.JWKS {
+    return s.keys.JWKS()
+}
+
 func (s *AuthService) HashPassword(password string) (string, error) {
+    timer := prometheus.NewTimer(metrics.PasswordHashDuration.WithLabelValues("hash"))
+    defer timer.ObserveDuration()
     bytes, err := bcrypt.GenerateFromPassword([]byte(password), s.passwordCost)
     return string(bytes), err
 }
 
 func (s *AuthService) CheckPasswordHash(password, hash string) bool {
+    timer := prometheus.NewTimer(metrics.PasswordHashDuration.WithLabelValues("compare"))
+    defer timer.ObserveDuration()
     err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
     return err == nil
 }
+
+// VerifyPassword checks password against user's hash. A nil user is compared
+// against a throwaway hash so unknown emails take as long as wrong passwords.
+func (s *AuthService) VerifyPassword(user *models.User, password string) bool {
+    if user == nil {
+        s.dummyHashOnce.Do(func() {
+            s.dummyHash, _ = s.HashPassword("dummy password for timing")
+        })
+        s.CheckPasswordHash(password, s.dummyHash)
+        return false
+    }
+    return s.CheckPasswordHash(password, user.Password)
+}
+
+func randomToken(n int) (string, error) {
+    b := make([]byte, n)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func randomHex(n int) (string, error) {
+    b := make([]byte, n)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/signing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type MockTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockTokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockTokenRepository) GetRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	args := m.Called(ctx, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.RefreshToken), args.Error(1)
+}
+
+func (m *MockTokenRepository) RevokeRefreshToken(ctx context.Context, id uint) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	args := m.Called(ctx, familyID)
+	return args.Error(0)
+}
+
+func (m *MockTokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID uint) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockTokenRepository) RevokeAccessToken(ctx context.Context, token *models.RevokedToken) (bool, error) {
+	args := m.Called(ctx, token)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockTokenRepository) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	args := m.Called(ctx, jti)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockTokenRepository) DeleteExpired(ctx context.Context, before time.Time) error {
+	args := m.Called(ctx, before)
+	return args.Error(0)
+}
+
+func newTestAuthService(userRepo *MockUserRepository, tokenRepo *MockTokenRepository) *AuthService {
+	constants := &config.Constants{
+		Auth: config.AuthConfig{
+			JWTSecret:              "test-secret-key-12345678901234567890123456789012",
+			AccessTokenExpiration:  15,
+			RefreshTokenExpiration: 168,
+			PasswordCost:           4,
+		},
+	}
+	keys, err := signing.LoadKeySet(&constants.Auth)
+	if err != nil {
+		panic(err)
+	}
+	return NewAuthService(userRepo, tokenRepo, keys, constants)
+}
+
+func TestAuthService_RefreshTokensRotates(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	mockTokenRepo := new(MockTokenRepository)
+	service := newTestAuthService(mockUserRepo, mockTokenRepo)
+
+	stored := &models.RefreshToken{ID: 7, UserID: 1, FamilyID: "family", ExpiresAt: time.Now().Add(time.Hour)}
+	mockTokenRepo.On("GetRefreshTokenByHash", mock.Anything, hashToken("old-token")).Return(stored, nil)
+	mockTokenRepo.On("RevokeRefreshToken", mock.Anything, uint(7)).Return(true, nil)
+	mockUserRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.User{ID: 1, Role: models.RoleUser}, nil)
+	mockTokenRepo.On("CreateRefreshToken", mock.Anything, mock.MatchedBy(func(token *models.RefreshToken) bool {
+		return token.FamilyID == "family" && token.UserID == 1
+	})).Return(nil)
+
+	tokens, err := service.RefreshTokens(context.Background(), "old-token")
+
+	assert.NoError(t, err)
+	assert.NotEqual(t, "old-token", tokens.RefreshToken)
+	claims, err := service.ValidateToken(context.Background(), tokens.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), claims.UserID)
+	assert.NotEmpty(t, claims.ID)
+	mockTokenRepo.AssertExpectations(t)
+}
+
+func TestAuthService_RefreshTokensReuseRevokesFamily(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	mockTokenRepo := new(MockTokenRepository)
+	service := newTestAuthService(mockUserRepo, mockTokenRepo)
+
+	revokedAt := time.Now().Add(-time.Minute)
+	stored := &models.RefreshToken{ID: 7, UserID: 1, FamilyID: "family", ExpiresAt: time.Now().Add(time.Hour), RevokedAt: &revokedAt}
+	mockTokenRepo.On("GetRefreshTokenByHash", mock.Anything, hashToken("used-token")).Return(stored, nil)
+	mockTokenRepo.On("RevokeFamily", mock.Anything, "family").Return(nil)
+
+	_, err := service.RefreshTokens(context.Background(), "used-token")
+
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	mockTokenRepo.AssertExpectations(t)
+	mockTokenRepo.AssertNotCalled(t, "CreateRefreshToken", mock.Anything, mock.Anything)
+}
+
+func TestAuthService_RefreshTokensUnknown(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	mockTokenRepo := new(MockTokenRepository)
+	service := newTestAuthService(mockUserRepo, mockTokenRepo)
+
+	mockTokenRepo.On("GetRefreshTokenByHash", mock.Anything, mock.Anything).Return(nil, gorm.ErrRecordNotFound)
+
+	_, err := service.RefreshTokens(context.Background(), "unknown")
+
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestAuthService_ValidateTokenAfterSessionsRevoked(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	service := newTestAuthService(mockUserRepo, new(MockTokenRepository))
+	ctx := context.Background()
+
+	user := &models.User{ID: 1, Role: models.RoleUser}
+	token, err := service.GenerateToken(user)
+	require.NoError(t, err)
+
+	mockUserRepo.On("GetByID", mock.Anything, uint(1)).Return(user, nil).Once()
+	_, err = service.ValidateToken(ctx, token)
+	assert.NoError(t, err)
+
+	// A password reset a second later revokes the token
+	validAfter := time.Now().Add(time.Second)
+	mockUserRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.User{ID: 1, TokensValidAfter: &validAfter}, nil).Once()
+	_, err = service.ValidateToken(ctx, token)
+	assert.ErrorIs(t, err, ErrSessionRevoked)
+
+	mockUserRepo.On("GetByID", mock.Anything, uint(1)).Return(nil, gorm.ErrRecordNotFound).Once()
+	_, err = service.ValidateToken(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken, "tokens of deleted users are rejected")
+}
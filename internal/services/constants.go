@@ -0,0 +1,23 @@
+package services
+
+import (
+	"sync/atomic"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+)
+
+// reloadableConstants is embedded by services whose constants can be
+// replaced while serving, after a config reload.
+type reloadableConstants struct {
+	current atomic.Pointer[config.Constants]
+}
+
+// SetConstants swaps in reloaded constants. Calls already in flight keep the
+// values they read.
+func (r *reloadableConstants) SetConstants(constants *config.Constants) {
+	r.current.Store(constants)
+}
+
+func (r *reloadableConstants) constants() *config.Constants {
+	return r.current.Load()
+}
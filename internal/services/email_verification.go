@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/notify"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/repository/interfaces"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/tracing"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidVerificationToken = newError(ErrValidation, "invalid_verification_token", "invalid or expired verification token")
+	ErrEmailNotVerified         = newError(ErrForbidden, "email_not_verified", "email address is not verified")
+	ErrAlreadyVerified          = newError(ErrConflict, "already_verified", "email address is already verified")
+)
+
+type EmailVerificationService struct {
+	userRepo  interfaces.UserRepository
+	tokenRepo interfaces.UserTokenRepository
+	notifier  notify.Notifier
+	constants *config.Constants
+}
+
+func NewEmailVerificationService(userRepo interfaces.UserRepository, tokenRepo interfaces.UserTokenRepository, notifier notify.Notifier, constants *config.Constants) *EmailVerificationService {
+	return &EmailVerificationService{
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		notifier:  notifier,
+		constants: constants,
+	}
+}
+
+// SendVerification mails a fresh verification token to user, invalidating
+// any earlier one.
+func (s *EmailVerificationService) SendVerification(ctx context.Context, user *models.User) error {
+	ctx, span := tracing.Start(ctx, "EmailVerificationService.SendVerification")
+	defer span.End()
+
+	if user.IsVerified() {
+		return ErrAlreadyVerified
+	}
+
+	if err := s.tokenRepo.InvalidateForUser(ctx, user.ID, models.TokenPurposeEmailVerification); err != nil {
+		return fmt.Errorf("failed to invalidate verification tokens: %w", err)
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate verification token: %w", err)
+	}
+	expiry := time.Duration(s.constants.Auth.EmailVerification.TokenExpiration) * time.Hour
+	err = s.tokenRepo.Create(ctx, &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposeEmailVerification,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(expiry),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store verification token: %w", err)
+	}
+
+	return s.notifier.Send(ctx, notify.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Use this token to verify your email address: %s\n\nIt expires in %d hours.",
+			token, s.constants.Auth.EmailVerification.TokenExpiration),
+	})
+}
+
+// ResendVerification sends a new token to the user with userID.
+func (s *EmailVerificationService) ResendVerification(ctx context.Context, userID uint) error {
+	ctx, span := tracing.Start(ctx, "EmailVerificationService.ResendVerification")
+	defer span.End()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	return s.SendVerification(ctx, user)
+}
+
+// Verify consumes a verification token and marks the account verified.
+func (s *EmailVerificationService) Verify(ctx context.Context, token string) error {
+	ctx, span := tracing.Start(ctx, "EmailVerificationService.Verify")
+	defer span.End()
+
+	stored, err := s.tokenRepo.GetByHash(ctx, models.TokenPurposeEmailVerification, hashToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidVerificationToken
+		}
+		return fmt.Errorf("failed to get verification token: %w", err)
+	}
+	if stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return ErrInvalidVerificationToken
+	}
+
+	used, err := s.tokenRepo.MarkUsed(ctx, stored.ID)
+	if err != nil {
+		return fmt.Errorf("failed to consume verification token: %w", err)
+	}
+	if !used {
+		return ErrInvalidVerificationToken
+	}
+
+	return s.userRepo.Update(ctx, stored.UserID, map[string]interface{}{"verified_at": time.Now()})
+}
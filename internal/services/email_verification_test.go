@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/notify"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmailVerificationService_SendAndVerify(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	mockUserTokenRepo := new(MockUserTokenRepository)
+	notifier := notify.NewFileNotifier(filepath.Join(t.TempDir(), "notifications.log"))
+	constants := &config.Constants{
+		Auth: config.AuthConfig{
+			EmailVerification: config.EmailVerificationConfig{TokenExpiration: 24},
+		},
+	}
+	service := NewEmailVerificationService(mockUserRepo, mockUserTokenRepo, notifier, constants)
+
+	var stored *models.UserToken
+	mockUserTokenRepo.On("InvalidateForUser", mock.Anything, uint(1), models.TokenPurposeEmailVerification).Return(nil)
+	mockUserTokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.UserToken")).
+		Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*models.UserToken)
+			stored.ID = 5
+		}).Return(nil)
+
+	require.NoError(t, service.SendVerification(context.Background(), &models.User{ID: 1, Email: "test@example.com"}))
+	assert.Equal(t, models.TokenPurposeEmailVerification, stored.Purpose)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), stored.ExpiresAt, time.Minute)
+
+	messages, err := notifier.Messages()
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	body := messages[0].Body
+	token := strings.Fields(body[strings.Index(body, ":")+1:])[0]
+
+	mockUserTokenRepo.On("GetByHash", mock.Anything, models.TokenPurposeEmailVerification, hashToken(token)).Return(stored, nil)
+	mockUserTokenRepo.On("MarkUsed", mock.Anything, uint(5)).Return(true, nil)
+	mockUserRepo.On("Update", mock.Anything, uint(1), mock.MatchedBy(func(updates map[string]interface{}) bool {
+		_, ok := updates["verified_at"]
+		return ok
+	})).Return(nil)
+
+	require.NoError(t, service.Verify(context.Background(), token))
+	mockUserRepo.AssertExpectations(t)
+}
+
+func TestEmailVerificationService_AlreadyVerified(t *testing.T) {
+	service := NewEmailVerificationService(new(MockUserRepository), new(MockUserTokenRepository), &notify.LogNotifier{}, &config.Constants{})
+	verifiedAt := time.Now()
+
+	err := service.SendVerification(context.Background(), &models.User{ID: 1, VerifiedAt: &verifiedAt})
+
+	assert.ErrorIs(t, err, ErrAlreadyVerified)
+}
@@ -0,0 +1,71 @@
+package services
+
+import "errors"
+
+// Kinds of domain error. Services return them directly or wrapped in an
+// *Error with a more specific code, so callers can handle a whole class with
+// e.g. errors.Is(err, ErrNotFound), and handlers map each kind to a status.
+var (
+	ErrNotFound      = errors.New("resource not found")
+	ErrConflict      = errors.New("resource conflicts with an existing one")
+	ErrValidation    = errors.New("request is invalid")
+	ErrForbidden     = errors.New("you do not have permission to perform this action")
+	ErrUnauthorized  = errors.New("authentication failed")
+	ErrLimitReached  = errors.New("limit reached")
+	ErrUnprocessable = errors.New("request cannot be processed")
+	// ErrPreconditionFailed and ErrPreconditionRequired concern the version
+	// a conditional write names, see ErrVersionMismatch.
+	ErrPreconditionFailed   = errors.New("precondition failed")
+	ErrPreconditionRequired = errors.New("precondition required")
+)
+
+var (
+	ErrVersionMismatch = newError(ErrPreconditionFailed, "version_mismatch", "resource has changed since it was read")
+	ErrVersionRequired = newError(ErrPreconditionRequired, "version_required", "writes must name the version they change, e.g. with If-Match")
+)
+
+// Error is a domain error of a Kind above with a stable, machine readable
+// code, e.g. "product_not_found", that clients can match on.
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+	Fields  []FieldError // the rejected fields, for ErrValidation
+}
+
+// FieldError describes why the value of a request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func newError(kind error, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// NewValidationError returns an ErrValidation error listing the rejected
+// fields.
+func NewValidationError(message string, fields ...FieldError) *Error {
+	return &Error{Kind: ErrValidation, Code: "validation_failed", Message: message, Fields: fields}
+}
+
+// checkVersion checks the version a conditional write names against the
+// current one. Version 0 names none, which is allowed unless required.
+func checkVersion(version, current uint, required bool) error {
+	switch {
+	case version == 0 && required:
+		return ErrVersionRequired
+	case version != 0 && version != current:
+		return ErrVersionMismatch
+	}
+	return nil
+}
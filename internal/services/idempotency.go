@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/repository/interfaces"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/tracing"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIdempotencyKeyReused   = newError(ErrUnprocessable, "idempotency_key_reused", "idempotency key was already used for a different request")
+	ErrIdempotencyKeyInFlight = newError(ErrConflict, "idempotency_key_in_flight", "a request with this idempotency key is still being processed")
+
+	errIdempotencyKeyTakenOver = errors.New("idempotency key was taken over by another request")
+)
+
+// IdempotencyService keeps the responses to requests sent with an
+// idempotency key so retries can be answered with them. Keys are stored in
+// the database, so a retry that reaches another instance is answered too.
+type IdempotencyService struct {
+	repo        interfaces.IdempotencyKeyRepository
+	ttl         time.Duration
+	lockTimeout time.Duration
+	now         func() time.Time
+}
+
+func NewIdempotencyService(repo interfaces.IdempotencyKeyRepository, cfg *config.IdempotencyConfig) *IdempotencyService {
+	return &IdempotencyService{
+		repo:        repo,
+		ttl:         time.Duration(cfg.TTL) * time.Hour,
+		lockTimeout: time.Duration(cfg.LockTimeout) * time.Second,
+		now:         time.Now,
+	}
+}
+
+// Begin locks key in scope for a request with fingerprint and returns it;
+// the caller must then Complete or Release it. If the first request with key
+// has finished, Begin returns its completed record to replay instead. A key
+// held by an unfinished request is taken over once its lock expires.
+func (s *IdempotencyService) Begin(ctx context.Context, scope, key, fingerprint string) (*models.IdempotencyKey, error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Begin")
+	defer span.End()
+
+	token, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	// A second round is needed when an expired key was deleted to make room
+	for range 2 {
+		record := &models.IdempotencyKey{
+			Scope:       scope,
+			Key:         key,
+			Fingerprint: fingerprint,
+			LockedUntil: now.Add(s.lockTimeout),
+			LockToken:   token,
+			ExpiresAt:   now.Add(s.ttl),
+		}
+		created, err := s.repo.Create(ctx, record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store idempotency key: %w", err)
+		}
+		if created {
+			return record, nil
+		}
+
+		existing, err := s.repo.Get(ctx, scope, key)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+		}
+		if now.After(existing.ExpiresAt) {
+			if err := s.repo.Delete(ctx, existing.ID); err != nil {
+				return nil, fmt.Errorf("failed to delete expired idempotency key: %w", err)
+			}
+			continue
+		}
+		if existing.Fingerprint != fingerprint {
+			return nil, ErrIdempotencyKeyReused
+		}
+		if existing.Completed() {
+			return existing, nil
+		}
+
+		taken, err := s.repo.Relock(ctx, existing.ID, now, record.LockedUntil, token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to take over idempotency key: %w", err)
+		}
+		if !taken {
+			return nil, ErrIdempotencyKeyInFlight
+		}
+		existing.LockedUntil = record.LockedUntil
+		existing.LockToken = token
+		return existing, nil
+	}
+	return nil, ErrIdempotencyKeyInFlight
+}
+
+// Complete stores the response set on record by the request holding it, to
+// be replayed for retries until the key expires. It fails if another request
+// has taken the key over since, leaving that request's outcome in place.
+func (s *IdempotencyService) Complete(ctx context.Context, record *models.IdempotencyKey) error {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Complete")
+	defer span.End()
+
+	stored, err := s.repo.Complete(ctx, record)
+	if err != nil {
+		return err
+	}
+	if !stored {
+		return errIdempotencyKeyTakenOver
+	}
+	return nil
+}
+
+// Release unlocks record without storing a response, so a retry runs the
+// request again. A key another request has taken over is left alone.
+func (s *IdempotencyService) Release(ctx context.Context, record *models.IdempotencyKey) error {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Release")
+	defer span.End()
+
+	_, err := s.repo.Unlock(ctx, record)
+	return err
+}
+
+// PurgeExpired deletes keys whose responses are no longer replayed.
+func (s *IdempotencyService) PurgeExpired(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.PurgeExpired")
+	defer span.End()
+
+	return s.repo.DeleteExpired(ctx, s.now())
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type MockIdempotencyKeyRepository struct {
+	mock.Mock
+}
+
+func (m *MockIdempotencyKeyRepository) Create(ctx context.Context, key *models.IdempotencyKey) (bool, error) {
+	args := m.Called(ctx, key)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockIdempotencyKeyRepository) Get(ctx context.Context, scope, key string) (*models.IdempotencyKey, error) {
+	args := m.Called(ctx, scope, key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.IdempotencyKey), args.Error(1)
+}
+
+func (m *MockIdempotencyKeyRepository) Relock(ctx context.Context, id uint, now, until time.Time, token string) (bool, error) {
+	args := m.Called(ctx, id, now, until, token)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockIdempotencyKeyRepository) Complete(ctx context.Context, key *models.IdempotencyKey) (bool, error) {
+	args := m.Called(ctx, key)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockIdempotencyKeyRepository) Unlock(ctx context.Context, key *models.IdempotencyKey) (bool, error) {
+	args := m.Called(ctx, key)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockIdempotencyKeyRepository) Delete(ctx context.Context, id uint) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockIdempotencyKeyRepository) DeleteExpired(ctx context.Context, before time.Time) error {
+	args := m.Called(ctx, before)
+	return args.Error(0)
+}
+
+func newTestIdempotencyService(repo *MockIdempotencyKeyRepository, now time.Time) *IdempotencyService {
+	service := NewIdempotencyService(repo, &config.IdempotencyConfig{TTL: 24, LockTimeout: 60})
+	service.now = func() time.Time { return now }
+	return service
+}
+
+func TestIdempotencyService_BeginLocksNewKey(t *testing.T) {
+	repo := new(MockIdempotencyKeyRepository)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	service := newTestIdempotencyService(repo, now)
+
+	repo.On("Create", mock.Anything, mock.MatchedBy(func(key *models.IdempotencyKey) bool {
+		return key.Scope == "user:1" && key.Key == "k1" && key.Fingerprint == "fp" &&
+			key.LockedUntil.Equal(now.Add(time.Minute)) && key.ExpiresAt.Equal(now.Add(24*time.Hour)) && len(key.LockToken) == 32
+	})).Return(true, nil).Once()
+
+	record, err := service.Begin(context.Background(), "user:1", "k1", "fp")
+	require.NoError(t, err)
+	assert.False(t, record.Completed())
+	repo.AssertExpectations(t)
+}
+
+func TestIdempotencyService_BeginExistingKey(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	inFlight := &models.IdempotencyKey{ID: 4, Scope: "user:1", Key: "k1", Fingerprint: "fp", LockedUntil: now.Add(time.Second), ExpiresAt: now.Add(time.Hour)}
+
+	tests := []struct {
+		name     string
+		existing *models.IdempotencyKey
+		taken    bool // whether Relock succeeds
+		err      error
+		replay   bool
+	}{
+		{"different request", &models.IdempotencyKey{ID: 4, Fingerprint: "other", ExpiresAt: now.Add(time.Hour)}, false, ErrIdempotencyKeyReused, false},
+		{"completed", &models.IdempotencyKey{ID: 4, Fingerprint: "fp", StatusCode: 201, ExpiresAt: now.Add(time.Hour)}, false, nil, true},
+		{"in flight", inFlight, false, ErrIdempotencyKeyInFlight, false},
+		{"lock expired", inFlight, true, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(MockIdempotencyKeyRepository)
+			service := newTestIdempotencyService(repo, now)
+			repo.On("Create", mock.Anything, mock.Anything).Return(false, nil).Once()
+			repo.On("Get", mock.Anything, "user:1", "k1").Return(tt.existing, nil).Once()
+			repo.On("Relock", mock.Anything, uint(4), now, now.Add(time.Minute), mock.Anything).Return(tt.taken, nil).Maybe()
+
+			record, err := service.Begin(context.Background(), "user:1", "k1", "fp")
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.replay, record.Completed())
+		})
+	}
+}
+
+func TestIdempotencyService_BeginReplacesExpiredKey(t *testing.T) {
+	repo := new(MockIdempotencyKeyRepository)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	service := newTestIdempotencyService(repo, now)
+
+	expired := &models.IdempotencyKey{ID: 4, Fingerprint: "other", StatusCode: 201, ExpiresAt: now.Add(-time.Second)}
+	repo.On("Create", mock.Anything, mock.Anything).Return(false, nil).Once()
+	repo.On("Get", mock.Anything, "user:1", "k1").Return(expired, nil).Once()
+	repo.On("Delete", mock.Anything, uint(4)).Return(nil).Once()
+	repo.On("Create", mock.Anything, mock.Anything).Return(true, nil).Once()
+
+	record, err := service.Begin(context.Background(), "user:1", "k1", "fp")
+	require.NoError(t, err)
+	assert.Equal(t, "fp", record.Fingerprint)
+	repo.AssertExpectations(t)
+
+	repo.On("Get", mock.Anything, "user:1", "gone").Return(nil, gorm.ErrRecordNotFound)
+	repo.On("Create", mock.Anything, mock.Anything).Return(false, nil).Twice()
+	_, err = service.Begin(context.Background(), "user:1", "gone", "fp")
+	assert.ErrorIs(t, err, ErrIdempotencyKeyInFlight, "gives up after the key keeps changing under it")
+}
+
+func TestIdempotencyService_TakenOverKeyIsLeftAlone(t *testing.T) {
+	repo := new(MockIdempotencyKeyRepository)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	service := newTestIdempotencyService(repo, now)
+
+	// The first request held the key past its lock timeout
+	inFlight := &models.IdempotencyKey{ID: 4, Fingerprint: "fp", LockToken: "first", LockedUntil: now.Add(-time.Second), ExpiresAt: now.Add(time.Hour)}
+	repo.On("Create", mock.Anything, mock.Anything).Return(false, nil).Once()
+	repo.On("Get", mock.Anything, "user:1", "k1").Return(inFlight, nil).Once()
+	repo.On("Relock", mock.Anything, uint(4), now, now.Add(time.Minute), mock.Anything).Return(true, nil).Once()
+
+	record, err := service.Begin(context.Background(), "user:1", "k1", "fp")
+	require.NoError(t, err)
+	assert.NotEqual(t, "first", record.LockToken)
+
+	first := &models.IdempotencyKey{ID: 4, LockToken: "first"}
+	repo.On("Complete", mock.Anything, first).Return(false, nil).Once()
+	repo.On("Unlock", mock.Anything, first).Return(false, nil).Once()
+	assert.Error(t, service.Complete(context.Background(), first), "the response is not stored")
+	assert.NoError(t, service.Release(context.Background(), first))
+	repo.AssertExpectations(t)
+	repo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/repository/interfaces"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/tracing"
+
+	"gorm.io/gorm"
+)
+
+// LoginGuard slows down and then temporarily locks out repeated failed
+// logins, tracked separately per account and per client IP. Second-factor
+// codes checked for a signed-in user are limited per user the same way.
+type LoginGuard struct {
+	repo      interfaces.LoginThrottleRepository
+	constants *config.Constants
+	now       func() time.Time
+}
+
+func NewLoginGuard(repo interfaces.LoginThrottleRepository, constants *config.Constants) *LoginGuard {
+	return &LoginGuard{repo: repo, constants: constants, now: time.Now}
+}
+
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func mfaKey(userID uint) string {
+	return fmt.Sprintf("mfa:%d", userID)
+}
+
+// Check returns how long the caller must wait before another login attempt
+// for email from ip is allowed. Zero means the attempt may proceed.
+func (g *LoginGuard) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	ctx, span := tracing.Start(ctx, "LoginGuard.Check")
+	defer span.End()
+
+	cfg := g.constants.Auth.Lockout
+	accountWait, err := g.wait(ctx, emailKey(email), cfg.MaxFailures)
+	if err != nil {
+		return 0, err
+	}
+	ipWait, err := g.wait(ctx, ipKey(ip), cfg.MaxFailuresPerIP)
+	if err != nil {
+		return 0, err
+	}
+	return max(accountWait, ipWait), nil
+}
+
+func (g *LoginGuard) wait(ctx context.Context, key string, maxFailures int) (time.Duration, error) {
+	throttle, err := g.repo.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to check login throttle: %w", err)
+	}
+
+	now := g.now()
+	if throttle.LockedUntil != nil && now.Before(*throttle.LockedUntil) {
+		return throttle.LockedUntil.Sub(now), nil
+	}
+	if g.expired(throttle, now) {
+		return 0, nil
+	}
+	if next := throttle.LastFailedAt.Add(g.delay(throttle.Failures)); now.Before(next) {
+		return next.Sub(now), nil
+	}
+	return 0, nil
+}
+
+// delay is the progressive wait imposed after failures failed attempts.
+func (g *LoginGuard) delay(failures int) time.Duration {
+	cfg := g.constants.Auth.Lockout
+	if failures < cfg.DelayAfter || cfg.BaseDelay <= 0 {
+		return 0
+	}
+	delay := time.Duration(cfg.BaseDelay) * time.Second
+	maxDelay := time.Duration(cfg.MaxDelay) * time.Second
+	for i := cfg.DelayAfter; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+func (g *LoginGuard) expired(throttle *models.LoginThrottle, now time.Time) bool {
+	resetAfter := time.Duration(g.constants.Auth.Lockout.ResetAfter) * time.Minute
+	return resetAfter > 0 && now.Sub(throttle.LastFailedAt) > resetAfter
+}
+
+// RecordFailure counts a failed login for both the account and the IP and
+// starts a lockout once either reaches its limit.
+func (g *LoginGuard) RecordFailure(ctx context.Context, email, ip string) error {
+	ctx, span := tracing.Start(ctx, "LoginGuard.RecordFailure")
+	defer span.End()
+
+	cfg := g.constants.Auth.Lockout
+	if err := g.recordFailure(ctx, emailKey(email), cfg.MaxFailures); err != nil {
+		return err
+	}
+	return g.recordFailure(ctx, ipKey(ip), cfg.MaxFailuresPerIP)
+}
+
+func (g *LoginGuard) recordFailure(ctx context.Context, key string, maxFailures int) error {
+	now := g.now()
+
+	existing, err := g.repo.Get(ctx, key)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to get login throttle: %w", err)
+	}
+	// Counting starts over once failures are stale or a lockout has run out.
+	lockExpired := existing != nil && existing.LockedUntil != nil && !now.Before(*existing.LockedUntil)
+	if existing != nil && (lockExpired || g.expired(existing, now)) {
+		if err := g.repo.Reset(ctx, key); err != nil {
+			return fmt.Errorf("failed to reset login throttle: %w", err)
+		}
+	}
+
+	throttle, err := g.repo.IncrementFailures(ctx, key, now)
+	if err != nil {
+		return fmt.Errorf("failed to record login failure: %w", err)
+	}
+	if maxFailures > 0 && throttle.Failures >= maxFailures {
+		until := now.Add(time.Duration(g.constants.Auth.Lockout.Duration) * time.Minute)
+		if err := g.repo.Lock(ctx, key, until); err != nil {
+			return fmt.Errorf("failed to lock login: %w", err)
+		}
+	}
+	return nil
+}
+
+// RecordSuccess clears the account's failure count. The IP count is left
+// alone so one valid account cannot be used to reset a spraying client.
+func (g *LoginGuard) RecordSuccess(ctx context.Context, email string) error {
+	ctx, span := tracing.Start(ctx, "LoginGuard.RecordSuccess")
+	defer span.End()
+
+	return g.repo.Reset(ctx, emailKey(email))
+}
+
+// Unlock lifts a lockout on the account with email.
+func (g *LoginGuard) Unlock(ctx context.Context, email string) error {
+	ctx, span := tracing.Start(ctx, "LoginGuard.Unlock")
+	defer span.End()
+
+	return g.repo.Reset(ctx, emailKey(email))
+}
+
+// CheckMFA returns how long userID must wait before another two-factor code
+// is checked for their session. Zero means the attempt may proceed.
+func (g *LoginGuard) CheckMFA(ctx context.Context, userID uint) (time.Duration, error) {
+	ctx, span := tracing.Start(ctx, "LoginGuard.CheckMFA")
+	defer span.End()
+
+	return g.wait(ctx, mfaKey(userID), g.constants.Auth.Lockout.MaxFailures)
+}
+
+// RecordMFAFailure counts a wrong two-factor code sent by userID and starts
+// a lockout once the account limit is reached.
+func (g *LoginGuard) RecordMFAFailure(ctx context.Context, userID uint) error {
+	ctx, span := tracing.Start(ctx, "LoginGuard.RecordMFAFailure")
+	defer span.End()
+
+	return g.recordFailure(ctx, mfaKey(userID), g.constants.Auth.Lockout.MaxFailures)
+}
+
+// RecordMFASuccess clears the two-factor failure count of userID.
+func (g *LoginGuard) RecordMFASuccess(ctx context.Context, userID uint) error {
+	ctx, span := tracing.Start(ctx, "LoginGuard.RecordMFASuccess")
+	defer span.End()
+
+	return g.repo.Reset(ctx, mfaKey(userID))
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakeLoginThrottleRepository keeps throttles in memory, since the guard's
+// behaviour depends on counts accumulating across calls.
+type fakeLoginThrottleRepository struct {
+	throttles map[string]*models.LoginThrottle
+}
+
+func newFakeLoginThrottleRepository() *fakeLoginThrottleRepository {
+	return &fakeLoginThrottleRepository{throttles: map[string]*models.LoginThrottle{}}
+}
+
+func (r *fakeLoginThrottleRepository) Get(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	throttle, ok := r.throttles[key]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *throttle
+	return &copied, nil
+}
+
+func (r *fakeLoginThrottleRepository) IncrementFailures(ctx context.Context, key string, failedAt time.Time) (*models.LoginThrottle, error) {
+	throttle, ok := r.throttles[key]
+	if !ok {
+		throttle = &models.LoginThrottle{Key: key}
+		r.throttles[key] = throttle
+	}
+	throttle.Failures++
+	throttle.LastFailedAt = failedAt
+	return r.Get(ctx, key)
+}
+
+func (r *fakeLoginThrottleRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	r.throttles[key].LockedUntil = &until
+	return nil
+}
+
+func (r *fakeLoginThrottleRepository) Reset(ctx context.Context, key string) error {
+	delete(r.throttles, key)
+	return nil
+}
+
+func newTestLoginGuard(repo *fakeLoginThrottleRepository, now *time.Time) *LoginGuard {
+	guard := NewLoginGuard(repo, &config.Constants{
+		Auth: config.AuthConfig{
+			Lockout: config.LockoutConfig{
+				MaxFailures:      5,
+				MaxFailuresPerIP: 8,
+				Duration:         15,
+				DelayAfter:       2,
+				BaseDelay:        1,
+				MaxDelay:         4,
+				ResetAfter:       60,
+			},
+		},
+	})
+	guard.now = func() time.Time { return *now }
+	return guard
+}
+
+func TestLoginGuard_ProgressiveDelayThenLockout(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	guard := newTestLoginGuard(newFakeLoginThrottleRepository(), &now)
+
+	// Wait imposed after each of the first four failures; the fifth locks.
+	delays := []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second}
+	for i, want := range delays {
+		require.NoError(t, guard.RecordFailure(ctx, "john@example.com", "10.0.0.1"))
+		wait, err := guard.Check(ctx, "John@Example.com", "10.0.0.1")
+		require.NoError(t, err)
+		assert.Equal(t, want, wait, "delay after failure %d", i+1)
+		now = now.Add(wait)
+	}
+	require.NoError(t, guard.RecordFailure(ctx, "john@example.com", "10.0.0.1"))
+
+	wait, err := guard.Check(ctx, "john@example.com", "10.0.0.2")
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, wait)
+
+	now = now.Add(15 * time.Minute)
+	wait, err = guard.Check(ctx, "john@example.com", "10.0.0.2")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestLoginGuard_LocksOutIPAcrossAccounts(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	guard := newTestLoginGuard(newFakeLoginThrottleRepository(), &now)
+
+	for i := range 8 {
+		email := string(rune('a'+i)) + "@example.com"
+		require.NoError(t, guard.RecordFailure(ctx, email, "10.0.0.1"))
+	}
+
+	wait, err := guard.Check(ctx, "new@example.com", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, wait)
+
+	wait, err = guard.Check(ctx, "new@example.com", "10.0.0.2")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestLoginGuard_SuccessAndUnlockClearAccount(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	repo := newFakeLoginThrottleRepository()
+	guard := newTestLoginGuard(repo, &now)
+
+	for range 5 {
+		require.NoError(t, guard.RecordFailure(ctx, "john@example.com", "10.0.0.1"))
+	}
+	wait, err := guard.Check(ctx, "john@example.com", "10.0.0.9")
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, wait)
+
+	require.NoError(t, guard.Unlock(ctx, "JOHN@example.com"))
+	wait, err = guard.Check(ctx, "john@example.com", "10.0.0.9")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	require.NoError(t, guard.RecordSuccess(ctx, "john@example.com"))
+	assert.Contains(t, repo.throttles, "ip:10.0.0.1", "success must not clear the IP counter")
+}
+
+func TestLoginGuard_StaleFailuresAreForgotten(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	repo := newFakeLoginThrottleRepository()
+	guard := newTestLoginGuard(repo, &now)
+
+	for range 4 {
+		require.NoError(t, guard.RecordFailure(ctx, "john@example.com", "10.0.0.1"))
+	}
+	now = now.Add(2 * time.Hour)
+
+	wait, err := guard.Check(ctx, "john@example.com", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	require.NoError(t, guard.RecordFailure(ctx, "john@example.com", "10.0.0.1"))
+	assert.Equal(t, 1, repo.throttles["email:john@example.com"].Failures)
+	assert.Nil(t, repo.throttles["email:john@example.com"].LockedUntil)
+}
+
+func TestLoginGuard_MFAFailuresAreCountedPerUser(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	guard := newTestLoginGuard(newFakeLoginThrottleRepository(), &now)
+
+	for range 5 {
+		require.NoError(t, guard.RecordMFAFailure(ctx, 1))
+	}
+	wait, err := guard.CheckMFA(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, wait)
+
+	wait, err = guard.CheckMFA(ctx, 2)
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+	wait, err = guard.Check(ctx, "john@example.com", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, wait, "passwords are counted separately")
+
+	require.NoError(t, guard.RecordMFASuccess(ctx, 1))
+	wait, err = guard.CheckMFA(ctx, 1)
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/repository/interfaces"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/totp"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/tracing"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrMFAAlreadyEnabled = newError(ErrConflict, "mfa_already_enabled", "two-factor authentication is already enabled")
+	ErrMFANotEnabled     = newError(ErrValidation, "mfa_not_enabled", "two-factor authentication is not enabled")
+	ErrMFANotEnrolled    = newError(ErrValidation, "mfa_not_enrolled", "no pending two-factor enrolment")
+	ErrInvalidMFACode    = newError(ErrValidation, "invalid_mfa_code", "invalid two-factor code")
+)
+
+// totpSkew is how many 30 second steps of clock drift are tolerated.
+const totpSkew = 1
+
+type MFAService struct {
+	userRepo  interfaces.UserRepository
+	codeRepo  interfaces.RecoveryCodeRepository
+	constants *config.Constants
+}
+
+func NewMFAService(userRepo interfaces.UserRepository, codeRepo interfaces.RecoveryCodeRepository, constants *config.Constants) *MFAService {
+	return &MFAService{
+		userRepo:  userRepo,
+		codeRepo:  codeRepo,
+		constants: constants,
+	}
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_url"`
+}
+
+// Enroll generates a new TOTP secret for the user. It takes effect only
+// after Confirm is called with a code from the authenticator.
+func (s *MFAService) Enroll(ctx context.Context, userID uint) (*TOTPEnrollment, error) {
+	ctx, span := tracing.Start(ctx, "MFAService.Enroll")
+	defer span.End()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.MFAEnabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	if err := s.userRepo.Update(ctx, user.ID, map[string]interface{}{"totp_secret": secret, "totp_last_used_step": 0}); err != nil {
+		return nil, fmt.Errorf("failed to store secret: %w", err)
+	}
+
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.constants.Auth.MFA.Issuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm enables MFA once the user proves their authenticator works and
+// returns freshly generated recovery codes. They are only shown this once.
+func (s *MFAService) Confirm(ctx context.Context, userID uint, code string) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "MFAService.Confirm")
+	defer span.End()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.MFAEnabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, err := s.generateRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.userRepo.Update(ctx, user.ID, map[string]interface{}{
+		"mfa_enabled_at":      time.Now(),
+		"totp_last_used_step": step,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable MFA: %w", err)
+	}
+	return codes, nil
+}
+
+// Disable turns MFA off after checking a current TOTP or recovery code.
+func (s *MFAService) Disable(ctx context.Context, userID uint, code string) error {
+	ctx, span := tracing.Start(ctx, "MFAService.Disable")
+	defer span.End()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if !user.MFAEnabled() {
+		return ErrMFANotEnabled
+	}
+	if err := s.Verify(ctx, user, code); err != nil {
+		return err
+	}
+
+	if err := s.codeRepo.DeleteForUser(ctx, user.ID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	return s.userRepo.Update(ctx, user.ID, map[string]interface{}{
+		"mfa_enabled_at":      nil,
+		"totp_secret":         "",
+		"totp_last_used_step": 0,
+	})
+}
+
+// VerifyLogin completes the second step of a login for userID.
+func (s *MFAService) VerifyLogin(ctx context.Context, userID uint, code string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "MFAService.VerifyLogin")
+	defer span.End()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidMFACode
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if !user.MFAEnabled() {
+		return nil, ErrMFANotEnabled
+	}
+	if err := s.Verify(ctx, user, code); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Verify accepts either a current TOTP code or an unused recovery code.
+// Each TOTP code and each recovery code works only once.
+func (s *MFAService) Verify(ctx context.Context, user *models.User, code string) error {
+	ctx, span := tracing.Start(ctx, "MFAService.Verify")
+	defer span.End()
+
+	code = strings.TrimSpace(code)
+
+	if step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), totpSkew); ok {
+		if step <= user.TOTPLastUsedStep {
+			return ErrInvalidMFACode
+		}
+		// The stored step may have moved on since user was loaded
+		recorded, err := s.userRepo.RecordTOTPStep(ctx, user.ID, step)
+		if err != nil {
+			return fmt.Errorf("failed to record TOTP use: %w", err)
+		}
+		if !recorded {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	recovery, err := s.codeRepo.GetUnusedByHash(ctx, user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidMFACode
+		}
+		return fmt.Errorf("failed to check recovery code: %w", err)
+	}
+	used, err := s.codeRepo.MarkUsed(ctx, recovery.ID)
+	if err != nil {
+		return fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (s *MFAService) generateRecoveryCodes(ctx context.Context, userID uint) ([]string, error) {
+	count := s.constants.Auth.MFA.RecoveryCodes
+	codes := make([]string, 0, count)
+	records := make([]*models.RecoveryCode, 0, count)
+
+	for i := 0; i < count; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes = append(codes, raw[:4]+"-"+raw[4:])
+		records = append(records, &models.RecoveryCode{UserID: userID, CodeHash: hashToken(raw)})
+	}
+
+	if err := s.codeRepo.ReplaceForUser(ctx, userID, records); err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.ReplaceAll(code, "-", ""), " ", ""))
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/totp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type MockRecoveryCodeRepository struct {
+	mock.Mock
+}
+
+func (m *MockRecoveryCodeRepository) ReplaceForUser(ctx context.Context, userID uint, codes []*models.RecoveryCode) error {
+	args := m.Called(ctx, userID, codes)
+	return args.Error(0)
+}
+
+func (m *MockRecoveryCodeRepository) GetUnusedByHash(ctx context.Context, userID uint, hash string) (*models.RecoveryCode, error) {
+	args := m.Called(ctx, userID, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.RecoveryCode), args.Error(1)
+}
+
+func (m *MockRecoveryCodeRepository) MarkUsed(ctx context.Context, id uint) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRecoveryCodeRepository) DeleteForUser(ctx context.Context, userID uint) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func newTestMFAService() (*MFAService, *MockUserRepository, *MockRecoveryCodeRepository) {
+	mockUserRepo := new(MockUserRepository)
+	mockCodeRepo := new(MockRecoveryCodeRepository)
+	constants := &config.Constants{
+		Auth: config.AuthConfig{MFA: config.MFAConfig{Issuer: "Marketplace", RecoveryCodes: 10}},
+	}
+	return NewMFAService(mockUserRepo, mockCodeRepo, constants), mockUserRepo, mockCodeRepo
+}
+
+func TestMFAService_ConfirmReturnsHashedRecoveryCodes(t *testing.T) {
+	service, mockUserRepo, mockCodeRepo := newTestMFAService()
+
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	code, err := totp.GenerateCode(secret, time.Now())
+	require.NoError(t, err)
+
+	var stored []*models.RecoveryCode
+	mockUserRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.User{ID: 1, TOTPSecret: secret}, nil)
+	mockCodeRepo.On("ReplaceForUser", mock.Anything, uint(1), mock.Anything).
+		Run(func(args mock.Arguments) { stored = args.Get(2).([]*models.RecoveryCode) }).Return(nil)
+	mockUserRepo.On("Update", mock.Anything, uint(1), mock.MatchedBy(func(updates map[string]interface{}) bool {
+		return updates["mfa_enabled_at"] != nil
+	})).Return(nil)
+
+	codes, err := service.Confirm(context.Background(), 1, code)
+
+	require.NoError(t, err)
+	assert.Len(t, codes, 10)
+	require.Len(t, stored, 10)
+	assert.Equal(t, hashToken(normalizeRecoveryCode(codes[0])), stored[0].CodeHash)
+	mockUserRepo.AssertExpectations(t)
+}
+
+func TestMFAService_VerifyRejectsReplayedCode(t *testing.T) {
+	service, mockUserRepo, mockCodeRepo := newTestMFAService()
+
+	secret, _ := totp.GenerateSecret()
+	now := time.Now()
+	code, _ := totp.GenerateCode(secret, now)
+	enabledAt := now
+	user := &models.User{ID: 1, TOTPSecret: secret, MFAEnabledAt: &enabledAt, TOTPLastUsedStep: totp.Step(now)}
+
+	mockCodeRepo.On("GetUnusedByHash", mock.Anything, uint(1), mock.Anything).Return(nil, gorm.ErrRecordNotFound)
+
+	assert.ErrorIs(t, service.Verify(context.Background(), user, code), ErrInvalidMFACode)
+	mockUserRepo.AssertNotCalled(t, "RecordTOTPStep", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestMFAService_VerifyRejectsCodeUsedConcurrently(t *testing.T) {
+	service, mockUserRepo, _ := newTestMFAService()
+
+	secret, _ := totp.GenerateSecret()
+	now := time.Now()
+	code, _ := totp.GenerateCode(secret, now)
+	enabledAt := now
+	user := &models.User{ID: 1, TOTPSecret: secret, MFAEnabledAt: &enabledAt}
+
+	// Another request recorded the step after user was loaded
+	mockUserRepo.On("RecordTOTPStep", mock.Anything, uint(1), mock.AnythingOfType("int64")).Return(false, nil)
+
+	assert.ErrorIs(t, service.Verify(context.Background(), user, code), ErrInvalidMFACode)
+}
+
+func TestMFAService_VerifyAcceptsRecoveryCodeOnce(t *testing.T) {
+	service, _, mockCodeRepo := newTestMFAService()
+	user := &models.User{ID: 1, TOTPSecret: "JBSWY3DPEHPK3PXP"}
+
+	recovery := &models.RecoveryCode{ID: 9, UserID: 1}
+	mockCodeRepo.On("GetUnusedByHash", mock.Anything, uint(1), hashToken("abcdefgh")).Return(recovery, nil)
+	mockCodeRepo.On("MarkUsed", mock.Anything, uint(9)).Return(true, nil).Once()
+	mockCodeRepo.On("MarkUsed", mock.Anything, uint(9)).Return(false, nil)
+
+	assert.NoError(t, service.Verify(context.Background(), user, "ABCD-EFGH"))
+	assert.ErrorIs(t, service.Verify(context.Background(), user, "abcd-efgh"), ErrInvalidMFACode)
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/notify"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/repository/interfaces"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/tracing"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidResetToken = newError(ErrValidation, "invalid_reset_token", "invalid or expired reset token")
+	ErrPasswordTooShort  = newError(ErrValidation, "password_too_short", "password is too short")
+)
+
+type PasswordResetService struct {
+	reloadableConstants
+	userRepo    interfaces.UserRepository
+	tokenRepo   interfaces.UserTokenRepository
+	authService *AuthService
+	notifier    notify.Notifier
+}
+
+func NewPasswordResetService(userRepo interfaces.UserRepository, tokenRepo interfaces.UserTokenRepository, authService *AuthService, notifier notify.Notifier, constants *config.Constants) *PasswordResetService {
+	s := &PasswordResetService{
+		userRepo:    userRepo,
+		tokenRepo:   tokenRepo,
+		authService: authService,
+		notifier:    notifier,
+	}
+	s.SetConstants(constants)
+	return s
+}
+
+// RequestReset mails a reset token to the account with email. Unknown
+// addresses are silently ignored so callers cannot probe for accounts.
+func (s *PasswordResetService) RequestReset(ctx context.Context, email string) error {
+	ctx, span := tracing.Start(ctx, "PasswordResetService.RequestReset")
+	defer span.End()
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// Only the most recent reset token is usable
+	if err := s.tokenRepo.InvalidateForUser(ctx, user.ID, models.TokenPurposePasswordReset); err != nil {
+		return fmt.Errorf("failed to invalidate reset tokens: %w", err)
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	expiry := time.Duration(s.constants().Auth.PasswordResetExpiration) * time.Minute
+	err = s.tokenRepo.Create(ctx, &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposePasswordReset,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(expiry),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store reset token: %w", err)
+	}
+
+	return s.notifier.Send(ctx, notify.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Use this token to reset your password: %s\n\nIt expires in %d minutes. If you did not ask for a reset, ignore this message.",
+			token, s.constants().Auth.PasswordResetExpiration),
+	})
+}
+
+// ResetPassword consumes a reset token, sets the new password and revokes
+// the user's existing sessions.
+func (s *PasswordResetService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	ctx, span := tracing.Start(ctx, "PasswordResetService.ResetPassword")
+	defer span.End()
+
+	if len(newPassword) < s.constants().Validation.MinPasswordLength {
+		return ErrPasswordTooShort
+	}
+
+	stored, err := s.tokenRepo.GetByHash(ctx, models.TokenPurposePasswordReset, hashToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		return fmt.Errorf("failed to get reset token: %w", err)
+	}
+	if stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	used, err := s.tokenRepo.MarkUsed(ctx, stored.ID)
+	if err != nil {
+		return fmt.Errorf("failed to consume reset token: %w", err)
+	}
+	if !used {
+		return ErrInvalidResetToken
+	}
+
+	hash, err := s.authService.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.userRepo.Update(ctx, stored.UserID, map[string]interface{}{"password": hash}); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	return s.authService.RevokeUserSessions(ctx, stored.UserID)
+}
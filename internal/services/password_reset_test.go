@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/notify"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type MockUserTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserTokenRepository) Create(ctx context.Context, token *models.UserToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockUserTokenRepository) GetByHash(ctx context.Context, purpose models.TokenPurpose, hash string) (*models.UserToken, error) {
+	args := m.Called(ctx, purpose, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.UserToken), args.Error(1)
+}
+
+func (m *MockUserTokenRepository) MarkUsed(ctx context.Context, id uint) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserTokenRepository) InvalidateForUser(ctx context.Context, userID uint, purpose models.TokenPurpose) error {
+	args := m.Called(ctx, userID, purpose)
+	return args.Error(0)
+}
+
+func newTestPasswordResetService(t *testing.T) (*PasswordResetService, *MockUserRepository, *MockUserTokenRepository, *MockTokenRepository, *notify.FileNotifier) {
+	mockUserRepo := new(MockUserRepository)
+	mockUserTokenRepo := new(MockUserTokenRepository)
+	mockTokenRepo := new(MockTokenRepository)
+	notifier := notify.NewFileNotifier(filepath.Join(t.TempDir(), "notifications.log"))
+
+	constants := &config.Constants{
+		Validation: config.ValidationConfig{MinPasswordLength: 8},
+		Auth:       config.AuthConfig{PasswordCost: 4, PasswordResetExpiration: 30},
+	}
+	authService := newTestAuthService(mockUserRepo, mockTokenRepo)
+	service := NewPasswordResetService(mockUserRepo, mockUserTokenRepo, authService, notifier, constants)
+	return service, mockUserRepo, mockUserTokenRepo, mockTokenRepo, notifier
+}
+
+func TestPasswordResetService_RequestAndReset(t *testing.T) {
+	service, mockUserRepo, mockUserTokenRepo, mockTokenRepo, notifier := newTestPasswordResetService(t)
+
+	var stored *models.UserToken
+	mockUserRepo.On("GetByEmail", mock.Anything, "test@example.com").Return(&models.User{ID: 1, Email: "test@example.com"}, nil)
+	mockUserTokenRepo.On("InvalidateForUser", mock.Anything, uint(1), models.TokenPurposePasswordReset).Return(nil)
+	mockUserTokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.UserToken")).
+		Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*models.UserToken)
+			stored.ID = 3
+		}).Return(nil)
+
+	require.NoError(t, service.RequestReset(context.Background(), "test@example.com"))
+
+	messages, err := notifier.Messages()
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "test@example.com", messages[0].To)
+
+	// The mailed token is never stored in plain text
+	body := messages[0].Body
+	token := strings.Fields(body[strings.Index(body, ":")+1:])[0]
+	assert.NotEqual(t, token, stored.TokenHash)
+	assert.Equal(t, hashToken(token), stored.TokenHash)
+
+	mockUserTokenRepo.On("GetByHash", mock.Anything, models.TokenPurposePasswordReset, stored.TokenHash).Return(stored, nil)
+	mockUserTokenRepo.On("MarkUsed", mock.Anything, uint(3)).Return(true, nil)
+	mockUserRepo.On("Update", mock.Anything, uint(1), mock.Anything).Return(nil)
+	mockTokenRepo.On("RevokeUserRefreshTokens", mock.Anything, uint(1)).Return(nil)
+
+	require.NoError(t, service.ResetPassword(context.Background(), token, "new-password"))
+	mockUserRepo.AssertExpectations(t)
+	mockTokenRepo.AssertExpectations(t)
+}
+
+func TestPasswordResetService_UnknownEmailSendsNothing(t *testing.T) {
+	service, mockUserRepo, _, _, notifier := newTestPasswordResetService(t)
+	mockUserRepo.On("GetByEmail", mock.Anything, "nobody@example.com").Return(nil, gorm.ErrRecordNotFound)
+
+	require.NoError(t, service.RequestReset(context.Background(), "nobody@example.com"))
+
+	messages, err := notifier.Messages()
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+}
+
+func TestPasswordResetService_RejectsUsedAndExpiredTokens(t *testing.T) {
+	service, _, mockUserTokenRepo, _, _ := newTestPasswordResetService(t)
+
+	usedAt := time.Now()
+	mockUserTokenRepo.On("GetByHash", mock.Anything, models.TokenPurposePasswordReset, hashToken("used")).
+		Return(&models.UserToken{ID: 1, UserID: 1, ExpiresAt: time.Now().Add(time.Hour), UsedAt: &usedAt}, nil)
+	mockUserTokenRepo.On("GetByHash", mock.Anything, models.TokenPurposePasswordReset, hashToken("expired")).
+		Return(&models.UserToken{ID: 2, UserID: 1, ExpiresAt: time.Now().Add(-time.Minute)}, nil)
+
+	assert.ErrorIs(t, service.ResetPassword(context.Background(), "used", "new-password"), ErrInvalidResetToken)
+	assert.ErrorIs(t, service.ResetPassword(context.Background(), "expired", "new-password"), ErrInvalidResetToken)
+	mockUserTokenRepo.AssertNotCalled(t, "MarkUsed", mock.Anything, mock.Anything)
+}
@@ -7,77 +7,164 @@ import (
 	"math"
 
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/metrics"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/policy"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/repository/interfaces"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/tracing"
 
 	"gorm.io/gorm"
 )
 
+var (
+	ErrProductNotFound     = newError(ErrNotFound, "product_not_found", "product not found")
+	ErrProductCodeTaken    = newError(ErrConflict, "product_code_taken", "product code is already in use")
+	ErrProductLimitReached = newError(ErrLimitReached, "product_limit_reached", "user has reached the maximum number of products")
+)
+
+const auditResourceProduct = "product"
+
+// ProductUpdate lists the product fields clients may change. Nil fields are
+// left as they are; UserID needs policy.CanChangeProductOwner.
+type ProductUpdate struct {
+	Code        *string
+	Name        *string
+	Description *string
+	Price       *uint
+	Status      *string
+	UserID      *uint
+}
+
+// changes returns the columns update would change on product.
+func (u ProductUpdate) changes(product *models.Product) map[string]interface{} {
+	updates := map[string]interface{}{}
+	if u.Code != nil && *u.Code != product.Code {
+		updates["code"] = *u.Code
+	}
+	if u.Name != nil && *u.Name != product.Name {
+		updates["name"] = *u.Name
+	}
+	if u.Description != nil && *u.Description != product.Description {
+		updates["description"] = *u.Description
+	}
+	if u.Price != nil && *u.Price != product.Price {
+		updates["price"] = *u.Price
+	}
+	if u.Status != nil && *u.Status != product.Status {
+		updates["status"] = *u.Status
+	}
+	if u.UserID != nil && *u.UserID != product.UserID {
+		updates["user_id"] = *u.UserID
+	}
+	return updates
+}
+
 type ProductService struct {
-	repo      interfaces.ProductRepository
-	userRepo  interfaces.UserRepository
-	constants *config.Constants
+	reloadableConstants
+	repo     interfaces.ProductRepository
+	userRepo interfaces.UserRepository
+	audit    *AuditService
 }
 
-func NewProductService(repo interfaces.ProductRepository, userRepo interfaces.UserRepository, constants *config.Constants) *ProductService {
-	return &ProductService{
-		repo:      repo,
-		userRepo:  userRepo,
-		constants: constants,
+func NewProductService(repo interfaces.ProductRepository, userRepo interfaces.UserRepository, audit *AuditService, constants *config.Constants) *ProductService {
+	s := &ProductService{
+		repo:     repo,
+		userRepo: userRepo,
+		audit:    audit,
 	}
+	s.SetConstants(constants)
+	return s
 }
 
-func (s *ProductService) CreateProduct(ctx context.Context, product *models.Product) error {
+// CreateProduct creates product owned by actor, whatever owner the client sent.
+func (s *ProductService) CreateProduct(ctx context.Context, actor policy.Actor, product *models.Product) error {
+	ctx, span := tracing.Start(ctx, "ProductService.CreateProduct")
+	defer span.End()
+
+	product.UserID = actor.UserID
+
 	// Validate user exists
-	_, err := s.userRepo.GetByID(ctx, product.UserID)
+	user, err := s.userRepo.GetByID(ctx, product.UserID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("user not found")
+			return ErrUserNotFound
 		}
 		return fmt.Errorf("failed to validate user: %w", err)
 	}
 
+	if s.constants().Auth.EmailVerification.RequiredForProducts && !user.IsVerified() {
+		return ErrEmailNotVerified
+	}
+
 	// Check if user has reached product limit
 	userProducts, _, err := s.repo.GetByUserID(ctx, product.UserID, nil)
 	if err != nil {
 		return fmt.Errorf("failed to check user products: %w", err)
 	}
 
-	if len(userProducts) >= s.constants.BusinessRules.MaxProductsPerUser {
-		return fmt.Errorf("user has reached maximum products limit")
+	if len(userProducts) >= s.constants().BusinessRules.MaxProductsPerUser {
+		return ErrProductLimitReached
 	}
 
-	// Check if product with same code exists
+	// Check if product with same code exists, for a friendly error; the unique
+	// index still decides between concurrent requests
 	existingProduct, err := s.repo.GetByCode(ctx, product.Code)
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return fmt.Errorf("failed to check existing product: %w", err)
 	}
 	if existingProduct != nil {
-		return fmt.Errorf("product with code %s already exists", product.Code)
+		return fmt.Errorf("%w: %s", ErrProductCodeTaken, product.Code)
 	}
 
 	// Set default status if not provided
 	if product.Status == "" {
-		product.Status = s.constants.BusinessRules.DefaultProductStatus
+		product.Status = s.constants().BusinessRules.DefaultProductStatus
 	}
+	// The column default, set here so drivers without RETURNING report it too
+	product.Version = 1
 
-	return s.repo.Create(ctx, product)
+	if err := s.repo.Create(ctx, product); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return fmt.Errorf("%w: %s", ErrProductCodeTaken, product.Code)
+		}
+		return err
+	}
+	metrics.ProductOperations.WithLabelValues("create").Inc()
+	return nil
 }
 
 func (s *ProductService) GetProduct(ctx context.Context, id uint) (*models.Product, error) {
-	return s.repo.GetByID(ctx, id)
+	ctx, span := tracing.Start(ctx, "ProductService.GetProduct")
+	defer span.End()
+
+	product, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+	return product, nil
 }
 
 func (s *ProductService) GetProductByCode(ctx context.Context, code string) (*models.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.GetProductByCode")
+	defer span.End()
+
 	return s.repo.GetByCode(ctx, code)
 }
 
 func (s *ProductService) ListProducts(ctx context.Context, filter *models.ProductFilter, pagination *models.PaginationParams) (*models.PaginatedResponse, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.ListProducts")
+	defer span.End()
+
+	limits := s.constants().Pagination
+
 	// Set default pagination if not provided
 	if pagination == nil {
 		pagination = &models.PaginationParams{
 			Page:     1,
-			PageSize: s.constants.Pagination.DefaultPageSize,
+			PageSize: limits.DefaultPageSize,
 		}
 	}
 
@@ -86,10 +173,10 @@ func (s *ProductService) ListProducts(ctx context.Context, filter *models.Produc
 		pagination.Page = 1
 	}
 	if pagination.PageSize < 1 {
-		pagination.PageSize = s.constants.Pagination.DefaultPageSize
+		pagination.PageSize = limits.DefaultPageSize
 	}
-	if pagination.PageSize > s.constants.Pagination.MaxPageSize {
-		pagination.PageSize = s.constants.Pagination.MaxPageSize
+	if pagination.PageSize > limits.MaxPageSize {
+		pagination.PageSize = limits.MaxPageSize
 	}
 
 	products, total, err := s.repo.List(ctx, filter, pagination)
@@ -108,39 +195,105 @@ func (s *ProductService) ListProducts(ctx context.Context, filter *models.Produc
 	}, nil
 }
 
-func (s *ProductService) UpdateProduct(ctx context.Context, id uint, updates map[string]interface{}) error {
-	// Check if product exists
-	_, err := s.repo.GetByID(ctx, id)
+// authorize loads product id and checks actor may manage it, auditing denials.
+func (s *ProductService) authorize(ctx context.Context, actor policy.Actor, action string, id uint) (*models.Product, error) {
+	product, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("product not found")
+			return nil, ErrProductNotFound
 		}
-		return fmt.Errorf("failed to get product: %w", err)
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	if !policy.CanManageProduct(actor, product) {
+		s.audit.Record(ctx, actor, action, auditResourceProduct, id, models.AuditOutcomeDenied)
+		return nil, ErrForbidden
 	}
+	return product, nil
+}
 
-	// If updating code, check for duplicates
-	if code, ok := updates["code"]; ok {
-		existingProduct, err := s.repo.GetByCode(ctx, code.(string))
+// UpdateProduct applies update to product id and returns the product as
+// stored. Fields equal to the current values are not written, so sending the
+// current owner back needs no permission to change it. A non-zero version
+// makes the update conditional on the product still being at that version.
+func (s *ProductService) UpdateProduct(ctx context.Context, actor policy.Actor, id, version uint, update ProductUpdate) (*models.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.UpdateProduct")
+	defer span.End()
+
+	product, err := s.authorize(ctx, actor, "update", id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(version, product.Version, s.constants().BusinessRules.RequireIfMatch); err != nil {
+		return nil, err
+	}
+
+	updates := update.changes(product)
+	if _, ok := updates["user_id"]; ok && !policy.CanChangeProductOwner(actor) {
+		s.audit.Record(ctx, actor, "change_owner", auditResourceProduct, id, models.AuditOutcomeDenied)
+		return nil, ErrForbidden
+	}
+	if len(updates) == 0 {
+		return product, nil
+	}
+
+	// If updating code, check for duplicates; a concurrent rename can still
+	// win the unique index, which is mapped below
+	if update.Code != nil && *update.Code != product.Code {
+		existingProduct, err := s.repo.GetByCode(ctx, *update.Code)
 		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("failed to check existing product: %w", err)
+			return nil, fmt.Errorf("failed to check existing product: %w", err)
 		}
 		if existingProduct != nil && existingProduct.ID != id {
-			return fmt.Errorf("product with code %s already exists", code)
+			return nil, fmt.Errorf("%w: %s", ErrProductCodeTaken, *update.Code)
 		}
 	}
 
-	return s.repo.Update(ctx, id, updates)
+	if version == 0 {
+		err = s.repo.Update(ctx, id, updates)
+	} else {
+		var updated bool
+		updated, err = s.repo.UpdateIfVersion(ctx, id, version, updates)
+		if err == nil && !updated {
+			return nil, ErrVersionMismatch
+		}
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) && update.Code != nil {
+			return nil, fmt.Errorf("%w: %s", ErrProductCodeTaken, *update.Code)
+		}
+		return nil, err
+	}
+	metrics.ProductOperations.WithLabelValues("update").Inc()
+	return s.GetProduct(ctx, id)
 }
 
-func (s *ProductService) DeleteProduct(ctx context.Context, id uint) error {
-	// Check if product exists
-	_, err := s.repo.GetByID(ctx, id)
+// DeleteProduct deletes product id, only if it is still at version unless
+// version is 0.
+func (s *ProductService) DeleteProduct(ctx context.Context, actor policy.Actor, id, version uint) error {
+	ctx, span := tracing.Start(ctx, "ProductService.DeleteProduct")
+	defer span.End()
+
+	product, err := s.authorize(ctx, actor, "delete", id)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("product not found")
-		}
-		return fmt.Errorf("failed to get product: %w", err)
+		return err
+	}
+	if err := checkVersion(version, product.Version, s.constants().BusinessRules.RequireIfMatch); err != nil {
+		return err
 	}
 
-	return s.repo.Delete(ctx, id)
+	if version == 0 {
+		err = s.repo.Delete(ctx, id)
+	} else {
+		var deleted bool
+		deleted, err = s.repo.DeleteIfVersion(ctx, id, version)
+		if err == nil && !deleted {
+			return ErrVersionMismatch
+		}
+	}
+	if err != nil {
+		return err
+	}
+	metrics.ProductOperations.WithLabelValues("delete").Inc()
+	return nil
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/policy"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -47,11 +48,26 @@ func (m *MockUserRepository) Update(ctx context.Context, id uint, updates map[st
     return args.Error(0)
 }
 
+func (m *MockUserRepository) UpdateIfVersion(ctx context.Context, id, version uint, updates map[string]interface{}) (bool, error) {
+    args := m.Called(ctx, id, version, updates)
+    return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserRepository) RecordTOTPStep(ctx context.Context, id uint, step int64) (bool, error) {
+    args := m.Called(ctx, id, step)
+    return args.Bool(0), args.Error(1)
+}
+
 func (m *MockUserRepository) Delete(ctx context.Context, id uint) error {
     args := m.Called(ctx, id)
     return args.Error(0)
 }
 
+func (m *MockUserRepository) DeleteIfVersion(ctx context.Context, id, version uint) (bool, error) {
+    args := m.Called(ctx, id, version)
+    return args.Bool(0), args.Error(1)
+}
+
 type MockProductRepository struct {
 	mock.Mock
 }
@@ -84,16 +100,35 @@ func (m *MockProductRepository) Update(ctx context.Context, id uint, updates map
 	return args.Error(0)
 }
 
+func (m *MockProductRepository) UpdateIfVersion(ctx context.Context, id, version uint, updates map[string]interface{}) (bool, error) {
+	args := m.Called(ctx, id, version, updates)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *MockProductRepository) Delete(ctx context.Context, id uint) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
+func (m *MockProductRepository) DeleteIfVersion(ctx context.Context, id, version uint) (bool, error) {
+	args := m.Called(ctx, id, version)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *MockProductRepository) GetByUserID(ctx context.Context, userID uint, pagination *models.PaginationParams) ([]*models.Product, int64, error) {
 	args := m.Called(ctx, userID, pagination)
 	return args.Get(0).([]*models.Product), args.Get(1).(int64), args.Error(2)
 }
 
+type MockAuditLogRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuditLogRepository) Create(ctx context.Context, entry *models.AuditLog) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
 func TestProductService_CreateProduct(t *testing.T) {
 	mockRepo := new(MockProductRepository)
 	mockUserRepo := new(MockUserRepository)
@@ -105,13 +140,14 @@ func TestProductService_CreateProduct(t *testing.T) {
 		},
 	}
 
-	service := NewProductService(mockRepo, mockUserRepo, constants)
+	service := NewProductService(mockRepo, mockUserRepo, NewAuditService(new(MockAuditLogRepository)), constants)
 
+	// The owner sent by the client is ignored in favour of the caller.
 	product := &models.Product{
 		Code:   "TEST001",
 		Name:   "Test Product",
 		Price:  100,
-		UserID: 1,
+		UserID: 2,
 	}
 
 	// Mock user exists
@@ -126,10 +162,180 @@ func TestProductService_CreateProduct(t *testing.T) {
 	// Mock successful creation
 	mockRepo.On("Create", mock.Anything, product).Return(nil)
 
-	err := service.CreateProduct(context.Background(), product)
+	err := service.CreateProduct(context.Background(), policy.Actor{UserID: 1, Role: models.RoleUser}, product)
 
 	assert.NoError(t, err)
 	assert.Equal(t, "active", product.Status)
+	assert.Equal(t, uint(1), product.UserID)
 	mockRepo.AssertExpectations(t)
 	mockUserRepo.AssertExpectations(t)
 }
+
+func TestProductService_CreateProductCodeRace(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	mockUserRepo := new(MockUserRepository)
+	constants := &config.Constants{BusinessRules: config.BusinessRulesConfig{MaxProductsPerUser: 1000}}
+	service := NewProductService(mockRepo, mockUserRepo, NewAuditService(new(MockAuditLogRepository)), constants)
+
+	mockUserRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.User{ID: 1}, nil)
+	mockRepo.On("GetByUserID", mock.Anything, uint(1), (*models.PaginationParams)(nil)).Return([]*models.Product{}, int64(0), nil)
+	// The pre-check passes, but another request inserts the code first
+	mockRepo.On("GetByCode", mock.Anything, "TEST001").Return(nil, gorm.ErrRecordNotFound)
+	mockRepo.On("Create", mock.Anything, mock.Anything).Return(gorm.ErrDuplicatedKey)
+
+	err := service.CreateProduct(context.Background(), policy.Actor{UserID: 1, Role: models.RoleUser}, &models.Product{Code: "TEST001"})
+
+	assert.ErrorIs(t, err, ErrProductCodeTaken)
+}
+
+func TestProductService_CreateProductRequiresVerifiedEmail(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	mockUserRepo := new(MockUserRepository)
+
+	constants := &config.Constants{
+		BusinessRules: config.BusinessRulesConfig{
+			MaxProductsPerUser:   1000,
+			DefaultProductStatus: "active",
+		},
+		Auth: config.AuthConfig{
+			EmailVerification: config.EmailVerificationConfig{RequiredForProducts: true},
+		},
+	}
+
+	service := NewProductService(mockRepo, mockUserRepo, NewAuditService(new(MockAuditLogRepository)), constants)
+
+	mockUserRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.User{ID: 1}, nil)
+
+	err := service.CreateProduct(context.Background(), policy.Actor{UserID: 1, Role: models.RoleUser}, &models.Product{Code: "TEST001"})
+
+	assert.ErrorIs(t, err, ErrEmailNotVerified)
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestProductService_UpdateProductOwnership(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	mockAuditRepo := new(MockAuditLogRepository)
+	service := NewProductService(mockRepo, new(MockUserRepository), NewAuditService(mockAuditRepo), &config.Constants{})
+
+	mockRepo.On("GetByID", mock.Anything, uint(7)).Return(&models.Product{ID: 7, UserID: 1}, nil)
+	mockAuditRepo.On("Create", mock.Anything, mock.MatchedBy(func(entry *models.AuditLog) bool {
+		return entry.ActorID == 2 && entry.Action == "update" && entry.ResourceID == 7 && entry.Outcome == models.AuditOutcomeDenied
+	})).Return(nil).Once()
+
+	stolen, renamed := "Stolen", "Renamed"
+	_, err := service.UpdateProduct(context.Background(), policy.Actor{UserID: 2, Role: models.RoleUser}, 7, 0, ProductUpdate{Name: &stolen})
+	assert.ErrorIs(t, err, ErrForbidden)
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+	mockAuditRepo.AssertExpectations(t)
+
+	mockRepo.On("Update", mock.Anything, uint(7), map[string]interface{}{"name": "Renamed"}).Return(nil).Twice()
+
+	_, err = service.UpdateProduct(context.Background(), policy.Actor{UserID: 1, Role: models.RoleUser}, 7, 0, ProductUpdate{Name: &renamed})
+	assert.NoError(t, err)
+
+	_, err = service.UpdateProduct(context.Background(), policy.Actor{UserID: 3, Role: models.RoleAdmin, Permissions: []string{models.PermissionAll}}, 7, 0, ProductUpdate{Name: &renamed})
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestProductService_UpdateProductOwnerChangeRequiresAdmin(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	mockAuditRepo := new(MockAuditLogRepository)
+	service := NewProductService(mockRepo, new(MockUserRepository), NewAuditService(mockAuditRepo), &config.Constants{})
+
+	mockRepo.On("GetByID", mock.Anything, uint(7)).Return(&models.Product{ID: 7, UserID: 1}, nil)
+	mockAuditRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.AuditLog")).Return(nil)
+
+	newOwner := uint(2)
+	_, err := service.UpdateProduct(context.Background(), policy.Actor{UserID: 1, Role: models.RoleUser}, 7, 0, ProductUpdate{UserID: &newOwner})
+	assert.ErrorIs(t, err, ErrForbidden)
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+
+	// Sending the current owner back, as a full replacement does, is no change
+	owner := uint(1)
+	product, err := service.UpdateProduct(context.Background(), policy.Actor{UserID: 1, Role: models.RoleUser}, 7, 0, ProductUpdate{UserID: &owner})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(7), product.ID)
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestProductService_UpdateProductVersion(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	constants := &config.Constants{BusinessRules: config.BusinessRulesConfig{RequireIfMatch: true}}
+	service := NewProductService(mockRepo, new(MockUserRepository), NewAuditService(new(MockAuditLogRepository)), constants)
+	owner := policy.Actor{UserID: 1, Role: models.RoleUser}
+	name := "Renamed"
+
+	mockRepo.On("GetByID", mock.Anything, uint(7)).Return(&models.Product{ID: 7, UserID: 1, Version: 3}, nil)
+
+	_, err := service.UpdateProduct(context.Background(), owner, 7, 0, ProductUpdate{Name: &name})
+	assert.ErrorIs(t, err, ErrVersionRequired)
+	_, err = service.UpdateProduct(context.Background(), owner, 7, 2, ProductUpdate{Name: &name})
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+	mockRepo.AssertNotCalled(t, "UpdateIfVersion", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// Another write got in between reading and writing the product
+	mockRepo.On("UpdateIfVersion", mock.Anything, uint(7), uint(3), map[string]interface{}{"name": name}).Return(false, nil).Once()
+	_, err = service.UpdateProduct(context.Background(), owner, 7, 3, ProductUpdate{Name: &name})
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+
+	mockRepo.On("DeleteIfVersion", mock.Anything, uint(7), uint(3)).Return(true, nil).Once()
+	assert.NoError(t, service.DeleteProduct(context.Background(), owner, 7, 3))
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestProductService_UpdateProductCodeRace(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	service := NewProductService(mockRepo, new(MockUserRepository), NewAuditService(new(MockAuditLogRepository)), &config.Constants{})
+	code := "TEST002"
+
+	mockRepo.On("GetByID", mock.Anything, uint(7)).Return(&models.Product{ID: 7, UserID: 1, Code: "TEST001"}, nil)
+	mockRepo.On("GetByCode", mock.Anything, code).Return(nil, gorm.ErrRecordNotFound)
+	mockRepo.On("Update", mock.Anything, uint(7), map[string]interface{}{"code": code}).Return(gorm.ErrDuplicatedKey)
+
+	_, err := service.UpdateProduct(context.Background(), policy.Actor{UserID: 1, Role: models.RoleUser}, 7, 0, ProductUpdate{Code: &code})
+
+	assert.ErrorIs(t, err, ErrProductCodeTaken)
+}
+
+func TestProductService_DeleteProductOwnership(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	mockAuditRepo := new(MockAuditLogRepository)
+	service := NewProductService(mockRepo, new(MockUserRepository), NewAuditService(mockAuditRepo), &config.Constants{})
+
+	mockRepo.On("GetByID", mock.Anything, uint(7)).Return(&models.Product{ID: 7, UserID: 1}, nil)
+	mockAuditRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.AuditLog")).Return(nil).Once()
+
+	err := service.DeleteProduct(context.Background(), policy.Actor{UserID: 2, Role: models.RoleUser}, 7, 0)
+	assert.ErrorIs(t, err, ErrForbidden)
+	mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+
+	mockRepo.On("Delete", mock.Anything, uint(7)).Return(nil).Once()
+	err = service.DeleteProduct(context.Background(), policy.Actor{UserID: 1, Role: models.RoleUser}, 7, 0)
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockAuditRepo.AssertExpectations(t)
+}
+
+func TestProductService_SetConstantsAppliesToListProducts(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	constants := &config.Constants{}
+	constants.Pagination.DefaultPageSize = 10
+	constants.Pagination.MaxPageSize = 100
+	service := NewProductService(mockRepo, new(MockUserRepository), NewAuditService(new(MockAuditLogRepository)), constants)
+
+	mockRepo.On("List", mock.Anything, mock.Anything, mock.Anything).Return([]*models.Product{}, int64(0), nil)
+
+	response, err := service.ListProducts(context.Background(), nil, &models.PaginationParams{Page: 1, PageSize: 50})
+	assert.NoError(t, err)
+	assert.Equal(t, 50, response.PageSize)
+
+	reloaded := *constants
+	reloaded.Pagination.MaxPageSize = 20
+	service.SetConstants(&reloaded)
+
+	response, err = service.ListProducts(context.Background(), nil, &models.PaginationParams{Page: 1, PageSize: 50})
+	assert.NoError(t, err)
+	assert.Equal(t, 20, response.PageSize)
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/policy"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/repository/interfaces"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/tracing"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoleNotFound      = newError(ErrNotFound, "role_not_found", "role not found")
+	ErrRoleExists        = newError(ErrConflict, "role_exists", "role already exists")
+	ErrRoleBuiltIn       = newError(ErrForbidden, "role_built_in", "built-in roles are defined in configuration and cannot be changed")
+	ErrRoleInUse         = newError(ErrConflict, "role_in_use", "role is still assigned to users")
+	ErrInvalidRoleName   = newError(ErrValidation, "invalid_role_name", "role name must be 2-50 lowercase letters, digits, '-' or '_'")
+	ErrInvalidPermission = newError(ErrValidation, "invalid_permission", "invalid permission")
+	ErrPermissionNotHeld = newError(ErrForbidden, "permission_not_held", "cannot grant or revoke a permission you do not hold")
+	ErrOwnRole           = newError(ErrForbidden, "own_role", "cannot change your own role")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,49}$`)
+
+// RBACService resolves roles to permissions. Built-in roles come from the
+// rbac section of the constants; other roles are managed through the API
+// and stored in the database.
+type RBACService struct {
+	roleRepo  interfaces.RoleRepository
+	userRepo  interfaces.UserRepository
+	constants *config.Constants
+}
+
+func NewRBACService(roleRepo interfaces.RoleRepository, userRepo interfaces.UserRepository, constants *config.Constants) *RBACService {
+	return &RBACService{
+		roleRepo:  roleRepo,
+		userRepo:  userRepo,
+		constants: constants,
+	}
+}
+
+func (s *RBACService) builtIn(name models.Role) (*models.RoleDefinition, bool) {
+	permissions, ok := s.constants.RBAC.Roles[string(name)]
+	if !ok {
+		return nil, false
+	}
+	return &models.RoleDefinition{
+		Name:        name,
+		Permissions: strings.Join(permissions, " "),
+		BuiltIn:     true,
+	}, true
+}
+
+// GetRole returns the built-in or stored role called name.
+func (s *RBACService) GetRole(ctx context.Context, name models.Role) (*models.RoleDefinition, error) {
+	ctx, span := tracing.Start(ctx, "RBACService.GetRole")
+	defer span.End()
+
+	if role, ok := s.builtIn(name); ok {
+		return role, nil
+	}
+	role, err := s.roleRepo.GetByName(ctx, name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+	return role, nil
+}
+
+// Permissions returns what role grants. An unknown role grants nothing.
+func (s *RBACService) Permissions(ctx context.Context, name models.Role) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "RBACService.Permissions")
+	defer span.End()
+
+	role, err := s.GetRole(ctx, name)
+	if err != nil {
+		if errors.Is(err, ErrRoleNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return role.PermissionList(), nil
+}
+
+func (s *RBACService) HasPermission(ctx context.Context, name models.Role, permission string) (bool, error) {
+	ctx, span := tracing.Start(ctx, "RBACService.HasPermission")
+	defer span.End()
+
+	permissions, err := s.Permissions(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	return models.GrantsPermission(permissions, permission), nil
+}
+
+// ListRoles returns the built-in roles followed by the stored ones.
+func (s *RBACService) ListRoles(ctx context.Context) ([]*models.RoleDefinition, error) {
+	ctx, span := tracing.Start(ctx, "RBACService.ListRoles")
+	defer span.End()
+
+	names := make([]string, 0, len(s.constants.RBAC.Roles))
+	for name := range s.constants.RBAC.Roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	roles := make([]*models.RoleDefinition, 0, len(names))
+	for _, name := range names {
+		role, _ := s.builtIn(models.Role(name))
+		roles = append(roles, role)
+	}
+
+	stored, err := s.roleRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	return append(roles, stored...), nil
+}
+
+// CreateRole stores a new role. actor must hold every permission it grants.
+func (s *RBACService) CreateRole(ctx context.Context, actor policy.Actor, name models.Role, description string, permissions []string) (*models.RoleDefinition, error) {
+	ctx, span := tracing.Start(ctx, "RBACService.CreateRole")
+	defer span.End()
+
+	if !roleNamePattern.MatchString(string(name)) {
+		return nil, ErrInvalidRoleName
+	}
+	if _, ok := s.builtIn(name); ok {
+		return nil, ErrRoleExists
+	}
+	if err := validatePermissions(permissions); err != nil {
+		return nil, err
+	}
+	if err := checkGrantable(actor, permissions); err != nil {
+		return nil, err
+	}
+
+	_, err := s.roleRepo.GetByName(ctx, name)
+	if err == nil {
+		return nil, ErrRoleExists
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to check existing role: %w", err)
+	}
+
+	role := &models.RoleDefinition{
+		Name:        name,
+		Description: description,
+		Permissions: strings.Join(permissions, " "),
+	}
+	if err := s.roleRepo.Create(ctx, role); err != nil {
+		return nil, fmt.Errorf("failed to create role: %w", err)
+	}
+	return role, nil
+}
+
+// UpdateRole replaces the description and permissions of a stored role.
+// actor must hold every permission the role grants, before and after.
+func (s *RBACService) UpdateRole(ctx context.Context, actor policy.Actor, name models.Role, description string, permissions []string) (*models.RoleDefinition, error) {
+	ctx, span := tracing.Start(ctx, "RBACService.UpdateRole")
+	defer span.End()
+
+	if _, ok := s.builtIn(name); ok {
+		return nil, ErrRoleBuiltIn
+	}
+	if err := validatePermissions(permissions); err != nil {
+		return nil, err
+	}
+	if err := checkGrantable(actor, permissions); err != nil {
+		return nil, err
+	}
+	existing, err := s.GetRole(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	// Otherwise a weaker caller could strip permissions it does not hold
+	if err := checkGrantable(actor, existing.PermissionList()); err != nil {
+		return nil, err
+	}
+
+	err = s.roleRepo.Update(ctx, name, map[string]interface{}{
+		"description": description,
+		"permissions": strings.Join(permissions, " "),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update role: %w", err)
+	}
+	return s.GetRole(ctx, name)
+}
+
+func (s *RBACService) DeleteRole(ctx context.Context, name models.Role) error {
+	ctx, span := tracing.Start(ctx, "RBACService.DeleteRole")
+	defer span.End()
+
+	if _, ok := s.builtIn(name); ok {
+		return ErrRoleBuiltIn
+	}
+	if _, err := s.GetRole(ctx, name); err != nil {
+		return err
+	}
+	count, err := s.roleRepo.CountUsers(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to count role users: %w", err)
+	}
+	if count > 0 {
+		return ErrRoleInUse
+	}
+	return s.roleRepo.Delete(ctx, name)
+}
+
+// AssignRole gives the user role. Neither the new role nor the user's
+// current one may grant anything actor does not hold, and actor cannot
+// change its own role. Access tokens already issued keep the old role until
+// they are refreshed.
+func (s *RBACService) AssignRole(ctx context.Context, actor policy.Actor, userID uint, name models.Role) error {
+	ctx, span := tracing.Start(ctx, "RBACService.AssignRole")
+	defer span.End()
+
+	if userID == actor.UserID {
+		return ErrOwnRole
+	}
+	role, err := s.GetRole(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := checkGrantable(actor, role.PermissionList()); err != nil {
+		return err
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	// Demoting the user revokes what the current role grants
+	current, err := s.Permissions(ctx, user.Role)
+	if err != nil {
+		return err
+	}
+	if err := checkGrantable(actor, current); err != nil {
+		return err
+	}
+	return s.userRepo.Update(ctx, userID, map[string]interface{}{"role": name})
+}
+
+func validatePermissions(permissions []string) error {
+	for _, permission := range permissions {
+		if permission != models.PermissionAll && !slices.Contains(models.Permissions, permission) {
+			return fmt.Errorf("%w: %s", ErrInvalidPermission, permission)
+		}
+	}
+	return nil
+}
+
+// checkGrantable rejects permissions actor does not hold, so roles:write
+// cannot be used to hand out or take away more access than the caller has.
+// Granting or revoking "*" requires holding "*".
+func checkGrantable(actor policy.Actor, permissions []string) error {
+	for _, permission := range permissions {
+		if !actor.Can(permission) {
+			return fmt.Errorf("%w: %s", ErrPermissionNotHeld, permission)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/policy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type MockRoleRepository struct {
+	mock.Mock
+}
+
+func (m *MockRoleRepository) Create(ctx context.Context, role *models.RoleDefinition) error {
+	args := m.Called(ctx, role)
+	return args.Error(0)
+}
+
+func (m *MockRoleRepository) GetByName(ctx context.Context, name models.Role) (*models.RoleDefinition, error) {
+	args := m.Called(ctx, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.RoleDefinition), args.Error(1)
+}
+
+func (m *MockRoleRepository) List(ctx context.Context) ([]*models.RoleDefinition, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]*models.RoleDefinition), args.Error(1)
+}
+
+func (m *MockRoleRepository) Update(ctx context.Context, name models.Role, updates map[string]interface{}) error {
+	args := m.Called(ctx, name, updates)
+	return args.Error(0)
+}
+
+func (m *MockRoleRepository) Delete(ctx context.Context, name models.Role) error {
+	args := m.Called(ctx, name)
+	return args.Error(0)
+}
+
+func (m *MockRoleRepository) CountUsers(ctx context.Context, name models.Role) (int64, error) {
+	args := m.Called(ctx, name)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+var testAdmin = policy.Actor{UserID: 9, Role: models.RoleAdmin, Permissions: []string{models.PermissionAll}}
+
+func newTestRBACService(roleRepo *MockRoleRepository, userRepo *MockUserRepository) *RBACService {
+	return NewRBACService(roleRepo, userRepo, &config.Constants{
+		RBAC: config.RBACConfig{
+			Roles: map[string][]string{
+				"admin": {models.PermissionAll},
+				"user":  {models.PermissionProductsRead, models.PermissionProductsWrite},
+			},
+		},
+	})
+}
+
+func TestRBACService_HasPermission(t *testing.T) {
+	mockRoleRepo := new(MockRoleRepository)
+	service := newTestRBACService(mockRoleRepo, new(MockUserRepository))
+	ctx := context.Background()
+
+	mockRoleRepo.On("GetByName", mock.Anything, models.Role("support")).
+		Return(&models.RoleDefinition{Name: "support", Permissions: "users:read orders:refund"}, nil)
+	mockRoleRepo.On("GetByName", mock.Anything, models.Role("ghost")).Return(nil, gorm.ErrRecordNotFound)
+
+	tests := []struct {
+		role       models.Role
+		permission string
+		want       bool
+	}{
+		{"admin", models.PermissionOrdersRefund, true},
+		{"user", models.PermissionProductsWrite, true},
+		{"user", models.PermissionUsersRead, false},
+		{"support", models.PermissionOrdersRefund, true},
+		{"support", models.PermissionProductsWrite, false},
+		{"ghost", models.PermissionProductsRead, false},
+	}
+	for _, tt := range tests {
+		got, err := service.HasPermission(ctx, tt.role, tt.permission)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, "%s %s", tt.role, tt.permission)
+	}
+}
+
+func TestRBACService_CreateRole(t *testing.T) {
+	mockRoleRepo := new(MockRoleRepository)
+	service := newTestRBACService(mockRoleRepo, new(MockUserRepository))
+	ctx := context.Background()
+
+	_, err := service.CreateRole(ctx, testAdmin, "admin", "", nil)
+	assert.ErrorIs(t, err, ErrRoleExists)
+
+	_, err = service.CreateRole(ctx, testAdmin, "Bad Name", "", nil)
+	assert.ErrorIs(t, err, ErrInvalidRoleName)
+
+	_, err = service.CreateRole(ctx, testAdmin, "moderator", "", []string{"products:delete_everything"})
+	assert.ErrorIs(t, err, ErrInvalidPermission)
+
+	mockRoleRepo.On("GetByName", mock.Anything, models.Role("moderator")).Return(nil, gorm.ErrRecordNotFound)
+	mockRoleRepo.On("Create", mock.Anything, mock.MatchedBy(func(role *models.RoleDefinition) bool {
+		return role.Name == "moderator" && role.Permissions == "products:read products:manage_any"
+	})).Return(nil)
+
+	role, err := service.CreateRole(ctx, testAdmin, "moderator", "Keeps the catalogue clean", []string{models.PermissionProductsRead, models.PermissionProductsManageAny})
+	require.NoError(t, err)
+	assert.True(t, role.Grants(models.PermissionProductsManageAny))
+	mockRoleRepo.AssertExpectations(t)
+}
+
+func TestRBACService_RejectsEscalation(t *testing.T) {
+	mockRoleRepo := new(MockRoleRepository)
+	mockUserRepo := new(MockUserRepository)
+	service := newTestRBACService(mockRoleRepo, mockUserRepo)
+	ctx := context.Background()
+	// Manages roles, but holds nothing else of note
+	manager := policy.Actor{UserID: 2, Role: "role-manager", Permissions: []string{models.PermissionRolesWrite, models.PermissionProductsRead}}
+
+	_, err := service.CreateRole(ctx, manager, "root", "", []string{models.PermissionAll})
+	assert.ErrorIs(t, err, ErrPermissionNotHeld)
+	_, err = service.CreateRole(ctx, manager, "support", "", []string{models.PermissionProductsRead, models.PermissionUsersWrite})
+	assert.ErrorIs(t, err, ErrPermissionNotHeld)
+	_, err = service.UpdateRole(ctx, manager, "support", "", []string{models.PermissionUsersWrite})
+	assert.ErrorIs(t, err, ErrPermissionNotHeld)
+	// Nor take away what the manager does not hold
+	mockRoleRepo.On("GetByName", mock.Anything, models.Role("support")).Return(&models.RoleDefinition{Name: "support", Permissions: "products:read users:write"}, nil)
+	_, err = service.UpdateRole(ctx, manager, "support", "", []string{models.PermissionProductsRead})
+	assert.ErrorIs(t, err, ErrPermissionNotHeld)
+	mockRoleRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+
+	mockRoleRepo.On("GetByName", mock.Anything, models.Role("viewer")).Return(&models.RoleDefinition{Name: "viewer", Permissions: models.PermissionProductsRead}, nil)
+	mockUserRepo.On("GetByID", mock.Anything, uint(4)).Return(&models.User{ID: 4, Role: models.RoleAdmin}, nil)
+	assert.ErrorIs(t, service.AssignRole(ctx, manager, 5, models.RoleAdmin), ErrPermissionNotHeld)
+	assert.ErrorIs(t, service.AssignRole(ctx, manager, 4, "viewer"), ErrPermissionNotHeld, "demoting an admin")
+	assert.ErrorIs(t, service.AssignRole(ctx, manager, 2, "viewer"), ErrOwnRole)
+	mockRoleRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	mockUserRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+
+	// Roles within what the manager holds can still be handed out
+	mockRoleRepo.On("GetByName", mock.Anything, models.Role("guest")).Return(&models.RoleDefinition{Name: "guest"}, nil)
+	mockUserRepo.On("GetByID", mock.Anything, uint(3)).Return(&models.User{ID: 3, Role: "guest"}, nil)
+	mockUserRepo.On("Update", mock.Anything, uint(3), map[string]interface{}{"role": models.Role("viewer")}).Return(nil)
+	assert.NoError(t, service.AssignRole(ctx, manager, 3, "viewer"))
+}
+
+func TestRBACService_DeleteRole(t *testing.T) {
+	mockRoleRepo := new(MockRoleRepository)
+	service := newTestRBACService(mockRoleRepo, new(MockUserRepository))
+	ctx := context.Background()
+
+	assert.ErrorIs(t, service.DeleteRole(ctx, "user"), ErrRoleBuiltIn)
+
+	mockRoleRepo.On("GetByName", mock.Anything, models.Role("seller")).Return(&models.RoleDefinition{Name: "seller"}, nil)
+	mockRoleRepo.On("CountUsers", mock.Anything, models.Role("seller")).Return(int64(2), nil).Once()
+	assert.ErrorIs(t, service.DeleteRole(ctx, "seller"), ErrRoleInUse)
+
+	mockRoleRepo.On("CountUsers", mock.Anything, models.Role("seller")).Return(int64(0), nil).Once()
+	mockRoleRepo.On("Delete", mock.Anything, models.Role("seller")).Return(nil)
+	assert.NoError(t, service.DeleteRole(ctx, "seller"))
+	mockRoleRepo.AssertExpectations(t)
+}
+
+func TestRBACService_AssignRole(t *testing.T) {
+	mockRoleRepo := new(MockRoleRepository)
+	mockUserRepo := new(MockUserRepository)
+	service := newTestRBACService(mockRoleRepo, mockUserRepo)
+	ctx := context.Background()
+
+	mockRoleRepo.On("GetByName", mock.Anything, models.Role("ghost")).Return(nil, gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, service.AssignRole(ctx, testAdmin, 1, "ghost"), ErrRoleNotFound)
+
+	mockUserRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.User{ID: 1, Role: models.RoleUser}, nil)
+	mockUserRepo.On("Update", mock.Anything, uint(1), map[string]interface{}{"role": models.RoleAdmin}).Return(nil)
+	assert.NoError(t, service.AssignRole(ctx, testAdmin, 1, models.RoleAdmin))
+	mockUserRepo.AssertExpectations(t)
+}
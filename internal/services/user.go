@@ -7,50 +7,121 @@ import (
 
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/policy"
 	"github.com/MikeTeddyOmondi/marketplace-api/internal/repository/interfaces"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/tracing"
 
 	"gorm.io/gorm"
 )
 
+var (
+	ErrUserNotFound    = newError(ErrNotFound, "user_not_found", "user not found")
+	ErrEmailTaken      = newError(ErrConflict, "email_taken", "email address is already in use")
+	ErrInvalidPassword = newError(ErrValidation, "invalid_password", "current password is incorrect")
+)
+
+const auditResourceUser = "user"
+
+// ProfileUpdate lists the fields a user may change on their own account.
+// Nil fields are left as they are.
+type ProfileUpdate struct {
+	Name  *string
+	Email *string
+}
+
 type UserService struct {
+    reloadableConstants
     repo        interfaces.UserRepository
     authService *AuthService
-    constants   *config.Constants
+    audit       *AuditService
 }
 
-func NewUserService(repo interfaces.UserRepository, authService *AuthService, constants *config.Constants) *UserService {
-    return &UserService{
+func NewUserService(repo interfaces.UserRepository, authService *AuthService, audit *AuditService, constants *config.Constants) *UserService {
+    s := &UserService{
         repo:        repo,
         authService: authService,
-        constants:   constants,
+        audit:       audit,
     }
+    s.SetConstants(constants)
+    return s
 }
 
 func (s *UserService) CreateUser(ctx context.Context, user *models.User) error {
+	ctx, span := tracing.Start(ctx, "UserService.CreateUser")
+	defer span.End()
+
 	existingUser, err := s.repo.GetByEmail(ctx, user.Email)
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return fmt.Errorf("failed to check existing user: %w", err)
 	}
 	if existingUser != nil {
-		return fmt.Errorf("user with email %s already exists", user.Email)
+		return ErrEmailTaken
 	}
 
 	return s.repo.Create(ctx, user)
 }
 
+// CreateUserWithPassword creates user with the bcrypt hash of password.
+func (s *UserService) CreateUserWithPassword(ctx context.Context, user *models.User, password string) error {
+	ctx, span := tracing.Start(ctx, "UserService.CreateUserWithPassword")
+	defer span.End()
+
+	hash, err := s.authService.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	user.Password = hash
+	return s.CreateUser(ctx, user)
+}
+
 func (s *UserService) GetUser(ctx context.Context, id uint) (*models.User, error) {
-	return s.repo.GetByID(ctx, id)
+	ctx, span := tracing.Start(ctx, "UserService.GetUser")
+	defer span.End()
+
+	return s.getUser(ctx, id)
+}
+
+// GetUserFor returns user id if actor may see it: their own account, or any
+// account with users:read.
+func (s *UserService) GetUserFor(ctx context.Context, actor policy.Actor, id uint) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserFor")
+	defer span.End()
+
+	if !policy.CanViewUser(actor, id) {
+		s.audit.Record(ctx, actor, "read", auditResourceUser, id, models.AuditOutcomeDenied)
+		return nil, ErrForbidden
+	}
+	return s.getUser(ctx, id)
+}
+
+func (s *UserService) getUser(ctx context.Context, id uint) (*models.User, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
 }
 
 func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserByEmail")
+	defer span.End()
+
 	return s.repo.GetByEmail(ctx, email)
 }
 
 func (s *UserService) ListUsers(ctx context.Context, filter *models.User, pagination *models.PaginationParams) (*models.PaginatedResponse, error) {
+	ctx, span := tracing.Start(ctx, "UserService.ListUsers")
+	defer span.End()
+
+	limits := s.constants().Pagination
+
 	if pagination == nil {
 		pagination = &models.PaginationParams{
 			Page:     1,
-			PageSize: s.constants.Pagination.DefaultPageSize,
+			PageSize: limits.DefaultPageSize,
 		}
 	}
 
@@ -58,10 +129,10 @@ func (s *UserService) ListUsers(ctx context.Context, filter *models.User, pagina
 		pagination.Page = 1
 	}
 	if pagination.PageSize < 1 {
-		pagination.PageSize = s.constants.Pagination.DefaultPageSize
+		pagination.PageSize = limits.DefaultPageSize
 	}
-	if pagination.PageSize > s.constants.Pagination.MaxPageSize {
-		pagination.PageSize = s.constants.Pagination.MaxPageSize
+	if pagination.PageSize > limits.MaxPageSize {
+		pagination.PageSize = limits.MaxPageSize
 	}
 
 	users, total, err := s.repo.List(ctx, filter, pagination)
@@ -80,20 +151,118 @@ func (s *UserService) ListUsers(ctx context.Context, filter *models.User, pagina
 	}, nil
 }
 
-func (s *UserService) UpdateUser(ctx context.Context, id uint, updates map[string]interface{}) error {
-	if email, ok := updates["email"]; ok {
-		existingUser, err := s.repo.GetByEmail(ctx, email.(string))
+// UpdateUser applies update to user id on behalf of actor, who must be the
+// user or hold users:write. Changing the email address marks it unverified.
+// A non-zero version makes the update conditional on the user still being at
+// that version.
+func (s *UserService) UpdateUser(ctx context.Context, actor policy.Actor, id, version uint, update ProfileUpdate) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateUser")
+	defer span.End()
+
+	if !policy.CanManageUser(actor, id) {
+		s.audit.Record(ctx, actor, "update", auditResourceUser, id, models.AuditOutcomeDenied)
+		return nil, ErrForbidden
+	}
+
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(version, user.Version, s.constants().BusinessRules.RequireIfMatch); err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if update.Name != nil && *update.Name != user.Name {
+		updates["name"] = *update.Name
+	}
+	if update.Email != nil && *update.Email != user.Email {
+		existingUser, err := s.repo.GetByEmail(ctx, *update.Email)
 		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("failed to check existing user: %w", err)
+			return nil, fmt.Errorf("failed to check existing user: %w", err)
 		}
-		if existingUser != nil && existingUser.ID != id {
-			return fmt.Errorf("user with email %s already exists", email)
+		if existingUser != nil {
+			return nil, ErrEmailTaken
 		}
+		updates["email"] = *update.Email
+		updates["verified_at"] = nil
+	}
+	if len(updates) == 0 {
+		return user, nil
 	}
 
-	return s.repo.Update(ctx, id, updates)
+	if version == 0 {
+		err = s.repo.Update(ctx, id, updates)
+	} else {
+		var updated bool
+		updated, err = s.repo.UpdateIfVersion(ctx, id, version, updates)
+		if err == nil && !updated {
+			return nil, ErrVersionMismatch
+		}
+	}
+	if err != nil {
+		// Another account took the address between the check and the write
+		if errors.Is(err, gorm.ErrDuplicatedKey) && update.Email != nil {
+			return nil, ErrEmailTaken
+		}
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	return s.getUser(ctx, id)
 }
 
-func (s *UserService) DeleteUser(ctx context.Context, id uint) error {
-	return s.repo.Delete(ctx, id)
+// ChangePassword replaces the password of user id after checking the current
+// one, and signs the user out everywhere, including the current session.
+func (s *UserService) ChangePassword(ctx context.Context, id uint, currentPassword, newPassword string) error {
+	ctx, span := tracing.Start(ctx, "UserService.ChangePassword")
+	defer span.End()
+
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !s.authService.VerifyPassword(user, currentPassword) {
+		return ErrInvalidPassword
+	}
+	if len(newPassword) < s.constants().Validation.MinPasswordLength {
+		return ErrPasswordTooShort
+	}
+
+	hash, err := s.authService.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.repo.Update(ctx, id, map[string]interface{}{"password": hash}); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	return s.authService.RevokeUserSessions(ctx, id)
+}
+
+// DeleteUser deletes user id, only if it is still at version unless version
+// is 0, and signs the user out everywhere.
+func (s *UserService) DeleteUser(ctx context.Context, id, version uint) error {
+	ctx, span := tracing.Start(ctx, "UserService.DeleteUser")
+	defer span.End()
+
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(version, user.Version, s.constants().BusinessRules.RequireIfMatch); err != nil {
+		return err
+	}
+
+	if version == 0 {
+		err = s.repo.Delete(ctx, id)
+	} else {
+		var deleted bool
+		deleted, err = s.repo.DeleteIfVersion(ctx, id, version)
+		if err == nil && !deleted {
+			return ErrVersionMismatch
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return s.authService.RevokeUserSessions(ctx, id)
 }
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/policy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestUserService(userRepo *MockUserRepository, tokenRepo *MockTokenRepository, auditRepo *MockAuditLogRepository) *UserService {
+	constants := &config.Constants{
+		Validation: config.ValidationConfig{MinPasswordLength: 8},
+	}
+	return NewUserService(userRepo, newTestAuthService(userRepo, tokenRepo), NewAuditService(auditRepo), constants)
+}
+
+func TestUserService_UpdateUserRequiresSelfOrPermission(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	mockAuditRepo := new(MockAuditLogRepository)
+	service := newTestUserService(mockUserRepo, new(MockTokenRepository), mockAuditRepo)
+	name := "Mallory"
+
+	mockAuditRepo.On("Create", mock.Anything, mock.MatchedBy(func(entry *models.AuditLog) bool {
+		return entry.ActorID == 2 && entry.Resource == "user" && entry.ResourceID == 1 && entry.Outcome == models.AuditOutcomeDenied
+	})).Return(nil).Once()
+
+	_, err := service.UpdateUser(context.Background(), policy.Actor{UserID: 2, Role: models.RoleUser}, 1, 0, ProfileUpdate{Name: &name})
+	assert.ErrorIs(t, err, ErrForbidden)
+	mockUserRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+	mockAuditRepo.AssertExpectations(t)
+
+	mockUserRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.User{ID: 1, Name: "John"}, nil)
+	mockUserRepo.On("Update", mock.Anything, uint(1), map[string]interface{}{"name": "Mallory"}).Return(nil).Once()
+
+	admin := policy.Actor{UserID: 3, Role: models.RoleAdmin, Permissions: []string{models.PermissionAll}}
+	_, err = service.UpdateUser(context.Background(), admin, 1, 0, ProfileUpdate{Name: &name})
+	assert.NoError(t, err)
+	mockUserRepo.AssertExpectations(t)
+}
+
+func TestUserService_UpdateUserEmailResetsVerification(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	service := newTestUserService(mockUserRepo, new(MockTokenRepository), new(MockAuditLogRepository))
+	self := policy.Actor{UserID: 1, Role: models.RoleUser}
+
+	mockUserRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.User{ID: 1, Email: "john@example.com"}, nil)
+
+	taken := "jane@example.com"
+	mockUserRepo.On("GetByEmail", mock.Anything, taken).Return(&models.User{ID: 2, Email: taken}, nil)
+	_, err := service.UpdateUser(context.Background(), self, 1, 0, ProfileUpdate{Email: &taken})
+	assert.ErrorIs(t, err, ErrEmailTaken)
+
+	email := "john@new.example.com"
+	mockUserRepo.On("GetByEmail", mock.Anything, email).Return(nil, gorm.ErrRecordNotFound)
+	mockUserRepo.On("Update", mock.Anything, uint(1), map[string]interface{}{"email": email, "verified_at": nil}).Return(nil).Once()
+
+	_, err = service.UpdateUser(context.Background(), self, 1, 0, ProfileUpdate{Email: &email})
+	assert.NoError(t, err)
+
+	// The unique index catches a concurrent change the pre-check missed
+	raced := "race@example.com"
+	mockUserRepo.On("GetByEmail", mock.Anything, raced).Return(nil, gorm.ErrRecordNotFound)
+	mockUserRepo.On("Update", mock.Anything, uint(1), map[string]interface{}{"email": raced, "verified_at": nil}).Return(gorm.ErrDuplicatedKey).Once()
+	_, err = service.UpdateUser(context.Background(), self, 1, 0, ProfileUpdate{Email: &raced})
+	assert.ErrorIs(t, err, ErrEmailTaken)
+	mockUserRepo.AssertExpectations(t)
+}
+
+func TestUserService_ChangePassword(t *testing.T) {
+	mockUserRepo := new(MockUserRepository)
+	mockTokenRepo := new(MockTokenRepository)
+	service := newTestUserService(mockUserRepo, mockTokenRepo, new(MockAuditLogRepository))
+	ctx := context.Background()
+
+	hash, err := service.authService.HashPassword("old-password")
+	require.NoError(t, err)
+	mockUserRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.User{ID: 1, Password: hash}, nil)
+
+	assert.ErrorIs(t, service.ChangePassword(ctx, 1, "wrong-password", "new-password"), ErrInvalidPassword)
+	assert.ErrorIs(t, service.ChangePassword(ctx, 1, "old-password", "short"), ErrPasswordTooShort)
+
+	mockUserRepo.On("Update", mock.Anything, uint(1), mock.MatchedBy(func(updates map[string]interface{}) bool {
+		newHash, ok := updates["password"].(string)
+		return ok && service.authService.CheckPasswordHash("new-password", newHash)
+	})).Return(nil).Once()
+	mockUserRepo.On("Update", mock.Anything, uint(1), mock.MatchedBy(func(updates map[string]interface{}) bool {
+		_, ok := updates["tokens_valid_after"]
+		return ok
+	})).Return(nil).Once()
+	mockTokenRepo.On("RevokeUserRefreshTokens", mock.Anything, uint(1)).Return(nil).Once()
+
+	assert.NoError(t, service.ChangePassword(ctx, 1, "old-password", "new-password"))
+	mockUserRepo.AssertExpectations(t)
+	mockTokenRepo.AssertExpectations(t)
+}
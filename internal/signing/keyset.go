@@ -0,0 +1,187 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a single JWT signing key. Retired keys only carry the public half
+// and are kept so tokens they signed still verify until they expire.
+type Key struct {
+	KID        string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+// KeySet signs tokens with the active key and verifies them with any known
+// key. Without configured keys it falls back to HS256 with the shared secret.
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+	order  []*Key
+	secret []byte
+}
+
+func LoadKeySet(cfg *config.AuthConfig) (*KeySet, error) {
+	if len(cfg.Signing.Keys) == 0 {
+		if cfg.JWTSecret == "" {
+			return nil, errors.New("jwt_secret is required when no signing keys are configured")
+		}
+		return &KeySet{secret: []byte(cfg.JWTSecret)}, nil
+	}
+
+	ks := &KeySet{keys: make(map[string]*Key, len(cfg.Signing.Keys))}
+	for _, keyCfg := range cfg.Signing.Keys {
+		if keyCfg.KID == "" {
+			return nil, fmt.Errorf("signing key %s has no kid", keyCfg.Path)
+		}
+		if _, exists := ks.keys[keyCfg.KID]; exists {
+			return nil, fmt.Errorf("duplicate signing key kid %q", keyCfg.KID)
+		}
+		key, err := loadKey(keyCfg.KID, keyCfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		ks.keys[key.KID] = key
+		ks.order = append(ks.order, key)
+	}
+
+	active, ok := ks.keys[cfg.Signing.ActiveKey]
+	if !ok {
+		return nil, fmt.Errorf("active signing key %q is not configured", cfg.Signing.ActiveKey)
+	}
+	if active.PrivateKey == nil {
+		return nil, fmt.Errorf("active signing key %q has no private key", active.KID)
+	}
+	ks.active = active
+
+	return ks, nil
+}
+
+func loadKey(kid, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key %q: %w", kid, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %q is not PEM encoded", kid)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("signing key %q has unsupported PEM type %q", kid, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %q: %w", kid, err)
+	}
+
+	key := &Key{KID: kid}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.PrivateKey, key.PublicKey = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.PublicKey = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.PrivateKey, key.PublicKey = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.PublicKey = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("signing key %q must be RSA or Ed25519, got %T", kid, parsed)
+	}
+	return key, nil
+}
+
+// Sign signs claims with the active key and sets the kid header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if ks.active == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.secret)
+	}
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.KID
+	return token.SignedString(ks.active.PrivateKey)
+}
+
+// Parse verifies tokenString against the key named by its kid header.
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, ks.keyfunc, jwt.WithValidMethods(ks.validMethods()))
+}
+
+func (ks *KeySet) keyfunc(token *jwt.Token) (interface{}, error) {
+	if ks.active == nil {
+		return ks.secret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("signing key %q does not use %s", kid, token.Method.Alg())
+	}
+	return key.PublicKey, nil
+}
+
+func (ks *KeySet) validMethods() []string {
+	if ks.active == nil {
+		return []string{jwt.SigningMethodHS256.Alg()}
+	}
+	return []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+}
+
+// JWK is a public key in RFC 7517 form.
+type JWK struct {
+	KTY string `json:"kty"`
+	KID string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every configured key. The shared HS256
+// secret is never published, so the set is empty in that mode.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range ks.order {
+		jwk := JWK{KID: key.KID, Use: "sig", Alg: key.Method.Alg()}
+		switch pub := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KTY = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KTY = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
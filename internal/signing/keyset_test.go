@@ -0,0 +1,98 @@
+package signing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKey(t *testing.T, dir, kid, alg string) string {
+	t.Helper()
+	pemBytes, err := GenerateKey(alg)
+	require.NoError(t, err)
+	path := filepath.Join(dir, kid+".pem")
+	require.NoError(t, os.WriteFile(path, pemBytes, 0o600))
+	return path
+}
+
+func TestKeySet_RotationKeepsRetiredKeysVerifying(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := writeKey(t, dir, "old", "RS256")
+	newPath := writeKey(t, dir, "new", "EdDSA")
+
+	oldKeys, err := LoadKeySet(&config.AuthConfig{Signing: config.SigningConfig{
+		ActiveKey: "old",
+		Keys:      []config.SigningKeyConfig{{KID: "old", Path: oldPath}},
+	}})
+	require.NoError(t, err)
+	oldToken, err := oldKeys.Sign(jwt.RegisteredClaims{Subject: "user"})
+	require.NoError(t, err)
+
+	rotated, err := LoadKeySet(&config.AuthConfig{Signing: config.SigningConfig{
+		ActiveKey: "new",
+		Keys: []config.SigningKeyConfig{
+			{KID: "new", Path: newPath},
+			{KID: "old", Path: oldPath},
+		},
+	}})
+	require.NoError(t, err)
+
+	newToken, err := rotated.Sign(jwt.RegisteredClaims{Subject: "user"})
+	require.NoError(t, err)
+
+	for _, tokenString := range []string{oldToken, newToken} {
+		token, err := rotated.Parse(tokenString, &jwt.RegisteredClaims{})
+		require.NoError(t, err)
+		assert.True(t, token.Valid)
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &jwt.RegisteredClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "new", parsed.Header["kid"])
+	assert.Equal(t, "EdDSA", parsed.Method.Alg())
+
+	jwks := rotated.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "OKP", jwks.Keys[0].KTY)
+	assert.Equal(t, "RSA", jwks.Keys[1].KTY)
+	assert.Equal(t, "AQAB", jwks.Keys[1].E)
+}
+
+func TestKeySet_RejectsUnknownKid(t *testing.T) {
+	dir := t.TempDir()
+	path := writeKey(t, dir, "a", "EdDSA")
+	otherPath := writeKey(t, dir, "b", "EdDSA")
+
+	signer, err := LoadKeySet(&config.AuthConfig{Signing: config.SigningConfig{
+		ActiveKey: "b",
+		Keys:      []config.SigningKeyConfig{{KID: "b", Path: otherPath}},
+	}})
+	require.NoError(t, err)
+	verifier, err := LoadKeySet(&config.AuthConfig{Signing: config.SigningConfig{
+		ActiveKey: "a",
+		Keys:      []config.SigningKeyConfig{{KID: "a", Path: path}},
+	}})
+	require.NoError(t, err)
+
+	token, err := signer.Sign(jwt.RegisteredClaims{Subject: "user"})
+	require.NoError(t, err)
+	_, err = verifier.Parse(token, &jwt.RegisteredClaims{})
+	assert.Error(t, err)
+}
+
+func TestKeySet_HMACFallbackPublishesNoKeys(t *testing.T) {
+	keys, err := LoadKeySet(&config.AuthConfig{JWTSecret: "secret"})
+	require.NoError(t, err)
+
+	token, err := keys.Sign(jwt.RegisteredClaims{Subject: "user"})
+	require.NoError(t, err)
+	_, err = keys.Parse(token, &jwt.RegisteredClaims{})
+	assert.NoError(t, err)
+	assert.Empty(t, keys.JWKS().Keys)
+}
@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSetupWithFileExporter(t *testing.T) {
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	path := filepath.Join(t.TempDir(), "traces", "spans.json")
+
+	shutdown, err := Setup(context.Background(), &config.TracingConfig{
+		Enabled:     true,
+		ServiceName: "marketplace-test",
+		Exporter:    "file",
+		SampleRatio: 1,
+		FilePath:    path,
+	})
+	require.NoError(t, err)
+
+	ctx, parent := Start(context.Background(), "ProductService.CreateProduct")
+	_, child := Start(ctx, "gorm.Create", trace.WithSpanKind(trace.SpanKindClient))
+	child.End()
+	parent.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var names []string
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	for decoder.More() {
+		var span struct {
+			Name   string
+			Parent struct{ SpanID string }
+		}
+		require.NoError(t, decoder.Decode(&span))
+		names = append(names, span.Name)
+		if span.Name == "gorm.Create" {
+			assert.Equal(t, parent.SpanContext().SpanID().String(), span.Parent.SpanID)
+		}
+	}
+	assert.Equal(t, []string{"gorm.Create", "ProductService.CreateProduct"}, names)
+	assert.Contains(t, string(data), "marketplace-test")
+}
+
+func TestSetupDisabled(t *testing.T) {
+	shutdown, err := Setup(context.Background(), &config.TracingConfig{})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, span := Start(context.Background(), "ProductService.CreateProduct")
+	assert.False(t, span.IsRecording())
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), &config.TracingConfig{Enabled: true, Exporter: "zipkin"})
+	assert.ErrorContains(t, err, "unsupported trace exporter: zipkin")
+}
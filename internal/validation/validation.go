@@ -0,0 +1,133 @@
+// Package validation registers the rules request DTOs use in their binding
+// tags beyond the validator's built-in ones, and explains failed rules.
+// Length limits come from the validation config and follow reloads.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/models"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// MaxPasswordBytes is the longest password bcrypt can hash.
+const MaxPasswordBytes = 72
+
+// productCodePattern allows 1 to 50 letters, digits, "-" and "_", starting
+// with a letter or digit. 50 is the size of the code column.
+var productCodePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,49}$`)
+
+// defaultLimits apply until SetLimits is called.
+var defaultLimits = config.ValidationConfig{MinPasswordLength: 8, MaxNameLength: 100, MaxDescriptionLength: 2000}
+
+var limits atomic.Pointer[config.ValidationConfig]
+
+// SetLimits replaces the limits checked by the length rules, e.g. after a
+// config reload.
+func SetLimits(cfg *config.ValidationConfig) {
+	limits.Store(cfg)
+}
+
+// Limits returns the limits the length rules currently check.
+func Limits() *config.ValidationConfig {
+	if current := limits.Load(); current != nil {
+		return current
+	}
+	return &defaultLimits
+}
+
+// rules are the custom binding tags:
+//
+//	name_length         a non-blank name of at most max_name_length characters
+//	password_length     at least min_password_length characters and at most MaxPasswordBytes bytes
+//	description_length at most max_description_length characters
+//	product_code        see productCodePattern
+//	product_status      one of models.ProductStatuses
+var rules = map[string]validator.Func{
+	"name_length": func(fl validator.FieldLevel) bool {
+		name := fl.Field().String()
+		return strings.TrimSpace(name) != "" && utf8.RuneCountInString(name) <= Limits().MaxNameLength
+	},
+	"password_length": func(fl validator.FieldLevel) bool {
+		password := fl.Field().String()
+		return utf8.RuneCountInString(password) >= Limits().MinPasswordLength && len(password) <= MaxPasswordBytes
+	},
+	"description_length": func(fl validator.FieldLevel) bool {
+		return utf8.RuneCountInString(fl.Field().String()) <= Limits().MaxDescriptionLength
+	},
+	"product_code": func(fl validator.FieldLevel) bool {
+		return productCodePattern.MatchString(fl.Field().String())
+	},
+	"product_status": func(fl validator.FieldLevel) bool {
+		return slices.Contains(models.ProductStatuses, fl.Field().String())
+	},
+}
+
+func init() {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	// Report fields by the names clients send rather than Go field names
+	engine.RegisterTagNameFunc(fieldName)
+	for tag, rule := range rules {
+		if err := engine.RegisterValidation(tag, rule); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Message explains a failed rule to the client.
+func Message(err validator.FieldError) string {
+	unit := ""
+	if err.Kind() == reflect.String {
+		unit = " characters"
+	}
+	switch err.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min", "gte":
+		return fmt.Sprintf("must be at least %s%s", err.Param(), unit)
+	case "max", "lte":
+		return fmt.Sprintf("must be at most %s%s", err.Param(), unit)
+	case "len":
+		return fmt.Sprintf("must be exactly %s%s", err.Param(), unit)
+	case "gt":
+		return "must be greater than " + err.Param()
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(err.Param()), ", ")
+	case "name_length":
+		return fmt.Sprintf("must not be blank or longer than %d characters", Limits().MaxNameLength)
+	case "password_length":
+		return fmt.Sprintf("must be at least %d characters and at most %d bytes", Limits().MinPasswordLength, MaxPasswordBytes)
+	case "description_length":
+		return fmt.Sprintf("must be at most %d characters", Limits().MaxDescriptionLength)
+	case "product_code":
+		return "must be 1 to 50 letters, digits, '-' or '_', starting with a letter or digit"
+	case "product_status":
+		return "must be one of " + strings.Join(models.ProductStatuses, ", ")
+	}
+	return fmt.Sprintf("failed the %s rule", err.Tag())
+}
+
+// fieldName returns the JSON or query name of a struct field.
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
@@ -0,0 +1,65 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MikeTeddyOmondi/marketplace-api/internal/config"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type request struct {
+	Name     string `json:"name" binding:"name_length"`
+	Password string `json:"password" binding:"password_length"`
+	Code     string `json:"code" binding:"product_code"`
+	Status   string `json:"status" binding:"omitempty,product_status"`
+}
+
+// failed returns "field:tag" for every rule req breaks.
+func failed(t *testing.T, req request) []string {
+	t.Helper()
+	err := binding.Validator.ValidateStruct(req)
+	if err == nil {
+		return nil
+	}
+	var fieldErrs validator.ValidationErrors
+	require.True(t, errors.As(err, &fieldErrs), err)
+	var fields []string
+	for _, fieldErr := range fieldErrs {
+		fields = append(fields, fieldErr.Field()+":"+fieldErr.Tag())
+	}
+	return fields
+}
+
+func TestRules(t *testing.T) {
+	valid := request{Name: "Widget", Password: "password1", Code: "ABC-123_x"}
+	assert.Empty(t, failed(t, valid))
+
+	invalid := request{Name: "   ", Password: "short", Code: "-ABC", Status: "archived"}
+	assert.Equal(t, []string{"name:name_length", "password:password_length", "code:product_code", "status:product_status"}, failed(t, invalid))
+
+	tooLong := valid
+	tooLong.Name = strings.Repeat("é", 101)
+	tooLong.Password = strings.Repeat("p", MaxPasswordBytes+1)
+	tooLong.Code = strings.Repeat("C", 51)
+	assert.Equal(t, []string{"name:name_length", "password:password_length", "code:product_code"}, failed(t, tooLong))
+}
+
+func TestSetLimits(t *testing.T) {
+	defer limits.Store(nil)
+	req := request{Name: "Twelve chars", Password: "four", Code: "A"}
+	assert.Equal(t, []string{"password:password_length"}, failed(t, req))
+
+	SetLimits(&config.ValidationConfig{MinPasswordLength: 4, MaxNameLength: 10, MaxDescriptionLength: 10})
+	assert.Equal(t, []string{"name:name_length"}, failed(t, req))
+
+	err := binding.Validator.ValidateStruct(req)
+	var fieldErrs validator.ValidationErrors
+	require.True(t, errors.As(err, &fieldErrs))
+	assert.Equal(t, "must not be blank or longer than 10 characters", Message(fieldErrs[0]))
+}
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS products (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(50) UNIQUE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    price BIGINT UNSIGNED NOT NULL,
+    status VARCHAR(20) DEFAULT 'active',
+    user_id BIGINT UNSIGNED NOT NULL,
+    created_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3),
+    updated_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3),
+    deleted_at DATETIME(3),
+    INDEX idx_products_deleted_at (deleted_at),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
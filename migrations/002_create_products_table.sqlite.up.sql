@@ -11,3 +11,4 @@ CREATE TABLE IF NOT EXISTS products (
     deleted_at DATETIME,
     FOREIGN KEY (user_id) REFERENCES users(id)
 );
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products(deleted_at);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    purpose VARCHAR(32) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at DATETIME(3) NOT NULL,
+    used_at DATETIME(3),
+    created_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3),
+    INDEX idx_user_tokens_user_id (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
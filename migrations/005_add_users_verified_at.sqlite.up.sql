@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN verified_at DATETIME;
+-- Accounts created before verification existed are treated as verified
+UPDATE users SET verified_at = CURRENT_TIMESTAMP;
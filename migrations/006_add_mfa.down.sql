@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS recovery_codes;
+ALTER TABLE refresh_tokens DROP COLUMN amr;
+ALTER TABLE users DROP COLUMN mfa_enabled_at;
+ALTER TABLE users DROP COLUMN totp_last_used_step;
+ALTER TABLE users DROP COLUMN totp_secret;
@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN totp_secret VARCHAR(64);
+ALTER TABLE users ADD COLUMN totp_last_used_step BIGINT DEFAULT 0;
+ALTER TABLE users ADD COLUMN mfa_enabled_at DATETIME(3);
+ALTER TABLE refresh_tokens ADD COLUMN amr VARCHAR(64);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at DATETIME(3),
+    created_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3),
+    INDEX idx_recovery_codes_user_id (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
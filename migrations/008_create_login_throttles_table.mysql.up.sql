@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS login_throttles (
+    throttle_key VARCHAR(255) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failed_at DATETIME(3) NOT NULL,
+    locked_until DATETIME(3),
+    updated_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3)
+);
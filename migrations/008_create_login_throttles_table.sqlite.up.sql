@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS login_throttles (
+    throttle_key VARCHAR(255) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failed_at DATETIME NOT NULL,
+    locked_until DATETIME,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    actor_id BIGINT UNSIGNED,
+    actor_role VARCHAR(50),
+    action VARCHAR(50) NOT NULL,
+    resource VARCHAR(50) NOT NULL,
+    resource_id BIGINT UNSIGNED,
+    outcome VARCHAR(20) NOT NULL,
+    created_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3),
+    INDEX idx_audit_logs_actor_id (actor_id),
+    INDEX idx_audit_logs_created_at (created_at)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN tokens_valid_after;
+ALTER TABLE products DROP COLUMN version;
+ALTER TABLE users DROP COLUMN version;
@@ -0,0 +1,5 @@
+-- Bumped on every write, for ETags and conditional updates
+ALTER TABLE users ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE products ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+-- Access tokens issued before this are rejected, set when sessions are revoked
+ALTER TABLE users ADD COLUMN tokens_valid_after TIMESTAMPTZ;
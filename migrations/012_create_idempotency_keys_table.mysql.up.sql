@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    scope VARCHAR(64) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    fingerprint VARCHAR(64) NOT NULL,
+    status_code INT NOT NULL DEFAULT 0,
+    content_type VARCHAR(255),
+    location VARCHAR(2048),
+    etag VARCHAR(255),
+    body MEDIUMBLOB,
+    locked_until DATETIME(3) NOT NULL,
+    lock_token VARCHAR(32) NOT NULL DEFAULT '',
+    expires_at DATETIME(3) NOT NULL,
+    created_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP(3),
+    UNIQUE INDEX idx_idempotency_keys_scope_key (scope, idempotency_key),
+    INDEX idx_idempotency_keys_expires_at (expires_at)
+);
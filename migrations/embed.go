@@ -0,0 +1,12 @@
+// Package migrations holds the numbered SQL migrations, embedded into the
+// binary so it can migrate a database without the source tree.
+//
+// Files are named <version>_<name>[.<driver>].<up|down>.sql. A file with a
+// driver (sqlite, postgres or mysql) takes precedence over the plain one for
+// that driver.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
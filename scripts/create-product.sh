@@ -1,12 +1,15 @@
 echo "Create Product..."
 
+# MARKETPLACE_API_KEY needs the products:write scope; keys created without scopes
+# are read-only
+
 curl -X POST http://localhost:8080/api/v1/products \
+  -H "X-API-Key: $MARKETPLACE_API_KEY" \
   -H "Content-Type: application/json" \
   -d '{
     "code": "P001",
     "name": "HP 15 Laptop",
     "description": "High-performance laptop",
-    "price": 12000,
-    "user_id": 1
+    "price": 12000
   }'
 
@@ -1,6 +1,10 @@
 echo "Create User..."
 
+# MARKETPLACE_API_KEY needs the users:write scope; keys created without scopes
+# are read-only
+
 curl -X POST http://localhost:8080/api/v1/users \
+  -H "X-API-Key: $MARKETPLACE_API_KEY" \
   -H "Content-Type: application/json" \
   -d '{
     "name": "Jon Doe",
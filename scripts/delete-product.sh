@@ -1,3 +1,12 @@
 echo "Delete Product..."
 
-curl -X DELETE http://localhost:8080/api/v1/products/1
+# MARKETPLACE_API_KEY needs the products:write scope; keys created without scopes
+# are read-only
+
+# Changes must name the version they apply to, so fetch its ETag first
+ETAG=$(curl -s -o /dev/null -D - http://localhost:8080/api/v1/products/1 \
+  -H "X-API-Key: $MARKETPLACE_API_KEY" | awk 'tolower($1) == "etag:" { print $2 }' | tr -d '\r')
+
+curl -X DELETE http://localhost:8080/api/v1/products/1 \
+  -H "X-API-Key: $MARKETPLACE_API_KEY" \
+  -H "If-Match: $ETAG"
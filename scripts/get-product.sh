@@ -1,4 +1,5 @@
 echo "Get Product..."
 
-curl http://localhost:8080/api/v1/products/1
+curl http://localhost:8080/api/v1/products/1 \
+  -H "X-API-Key: $MARKETPLACE_API_KEY"
 
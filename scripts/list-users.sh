@@ -1,4 +1,5 @@
 echo "List Users..."
 
-curl "http://localhost:8080/api/v1/users?page=1&page_size=5&name=John"
+curl "http://localhost:8080/api/v1/users?page=1&page_size=5&name=John" \
+  -H "X-API-Key: $MARKETPLACE_API_KEY"
 
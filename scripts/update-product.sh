@@ -1,8 +1,17 @@
 echo "Update Product..."
 
-curl -X PUT http://localhost:8080/api/v1/products/1 \
-  -H "Content-Type: application/json" \
+# MARKETPLACE_API_KEY needs the products:write scope; keys created without scopes
+# are read-only
+
+# Changes must name the version they apply to, so fetch its ETag first
+ETAG=$(curl -s -o /dev/null -D - http://localhost:8080/api/v1/products/1 \
+  -H "X-API-Key: $MARKETPLACE_API_KEY" | awk 'tolower($1) == "etag:" { print $2 }' | tr -d '\r')
+
+curl -X PATCH http://localhost:8080/api/v1/products/1 \
+  -H "X-API-Key: $MARKETPLACE_API_KEY" \
+  -H "If-Match: $ETAG" \
+  -H "Content-Type: application/merge-patch+json" \
   -d '{
     "price": 11000,
-    "description": Super High Performance PC"
-  }'
\ No newline at end of file
+    "description": "Super High Performance PC"
+  }'